@@ -0,0 +1,240 @@
+// Package agent implements a small RPC agent that runs
+// on remote nodes and executes named Go handlers on behalf
+// of a client.
+//
+// The agent is a Go program deployed on the node with
+// the gorun package. It talks with its client through
+// the standard input and output of the SSH session that
+// runs it, using length prefixed JSON frames.
+//
+// An agent program registers its handlers and then serves requests:
+//
+//	func main() {
+//		a := agent.New("v1.2.0")
+//		agent.RegisterFS(a, "/")
+//		a.Register("greet", func(ctx context.Context, name string) (string, error) {
+//			return "hello " + name, nil
+//		})
+//		a.Main()
+//	}
+//
+// The client deploys and starts it, then invokes its handlers:
+//
+//	client, err := agent.Start(ctx, runner, gorun.Program{Package: "./cmd/myagent"}, "v1.2.0")
+//	var greeting string
+//	err = client.Call(ctx, "greet", "world", &greeting)
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Handler is the function that serves a method
+// of an agent. It receives the JSON encoded
+// arguments of the call, and returns a result
+// that is JSON encoded to the client.
+type Handler func(ctx context.Context, args json.RawMessage) (interface{}, error)
+
+// Agent serves the requests of a client,
+// dispatching them to the registered handlers.
+type Agent struct {
+	// Version identifies the build of the agent. Clients
+	// redeploy agents whose version differ from the expected one.
+	Version string
+
+	lock     sync.RWMutex
+	handlers map[string]Handler
+}
+
+// New returns an agent with the given version
+// and no handlers registered.
+func New(version string) *Agent {
+	return &Agent{
+		Version:  version,
+		handlers: map[string]Handler{},
+	}
+}
+
+// Handle registers the handler for the given method.
+func (a *Agent) Handle(method string, handler Handler) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.handlers[method] = handler
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Register registers fn as the handler for the given method.
+// fn must be a function with signature
+//
+//	func(ctx context.Context, args A) (R, error)
+//
+// where A and R are types that can be encoded as JSON.
+// The arguments of calls are decoded in a new value of
+// type A and the result is encoded back to the client.
+// Register panics if fn does not have the expected signature.
+func (a *Agent) Register(method string, fn interface{}) {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	if fnType.Kind() != reflect.Func ||
+		fnType.NumIn() != 2 || fnType.In(0) != contextType ||
+		fnType.NumOut() != 2 || fnType.Out(1) != errorType {
+		panic(fmt.Sprintf("agent: handler for %s must be a func(context.Context, A) (R, error), got %s", method, fnType))
+	}
+	argsType := fnType.In(1)
+
+	a.Handle(method, func(ctx context.Context, rawArgs json.RawMessage) (interface{}, error) {
+		args := reflect.New(argsType)
+		if len(rawArgs) > 0 {
+			if err := json.Unmarshal(rawArgs, args.Interface()); err != nil {
+				return nil, fmt.Errorf("invalid arguments for %s: %w", method, err)
+			}
+		}
+		out := fnValue.Call([]reflect.Value{reflect.ValueOf(ctx), args.Elem()})
+		if err, _ := out[1].Interface().(error); err != nil {
+			return nil, err
+		}
+		return out[0].Interface(), nil
+	})
+}
+
+// Methods returns the sorted names of the registered methods.
+func (a *Agent) Methods() []string {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	methods := make([]string, 0, len(a.handlers))
+	for method := range a.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Serve announces the agent on w, then reads requests
+// from r and writes their responses on w, until r is
+// exhausted or ctx is done. Requests are served concurrently.
+// When ctx is done, r is closed if it implements io.Closer,
+// to stop the read in progress, and Serve returns the error
+// of ctx without waiting for the requests being served.
+func (a *Agent) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	// handlers is cancelled when Serve returns,
+	// or when a response cannot be written.
+	handlers, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var writeLock sync.Mutex
+	send := func(msg *message) error {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		return writeFrame(w, msg)
+	}
+
+	helloResult, err := json.Marshal(hello{
+		Protocol: ProtocolVersion,
+		Version:  a.Version,
+		Handlers: a.Methods(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := send(&message{Method: helloMethod, Result: helloResult}); err != nil {
+		return err
+	}
+
+	requests := make(chan *message)
+	readErr := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			req, err := readFrame(r)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var running sync.WaitGroup
+	for {
+		select {
+		case req := <-requests:
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				res := a.dispatch(handlers, req)
+				if err := send(res); err != nil {
+					cancel()
+				}
+			}()
+		case err := <-readErr:
+			running.Wait()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			if closer, ok := r.(io.Closer); ok {
+				closer.Close()
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+func (a *Agent) dispatch(ctx context.Context, req *message) (res *message) {
+	res = &message{ID: req.ID}
+
+	a.lock.RLock()
+	handler, ok := a.handlers[req.Method]
+	a.lock.RUnlock()
+	if !ok {
+		res.Error = &RemoteError{Code: "invalid", Msg: fmt.Sprintf("unknown method %s", req.Method)}
+		return res
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			res.Result = nil
+			res.Error = &RemoteError{Msg: fmt.Sprintf("handler %s panicked: %v", req.Method, r)}
+		}
+	}()
+
+	result, err := handler(ctx, req.Args)
+	if err != nil {
+		res.Error = newRemoteError(err)
+		return res
+	}
+	res.Result, err = json.Marshal(result)
+	if err != nil {
+		res.Error = newRemoteError(err)
+	}
+	return res
+}
+
+// Main serves requests on the standard input and output
+// of the process, then exits. It's meant to be called
+// by the main function of agent programs.
+func (a *Agent) Main() {
+	if err := a.Serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(0)
+}
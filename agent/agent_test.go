@@ -0,0 +1,265 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parro-it/vs/gorun"
+	"github.com/parro-it/vs/sshfs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/stretchr/testify/assert"
+)
+
+type sumArgs struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+// connect serves a with an in memory pipe
+// and returns a client connected to it.
+func connect(t *testing.T, a *Agent) *Client {
+	reqR, reqW := io.Pipe()
+	resR, resW := io.Pipe()
+	go func() {
+		a.Serve(context.Background(), reqR, resW)
+		resW.Close()
+	}()
+	client, err := NewClient(resR, reqW)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return client
+}
+
+func TestAgent(t *testing.T) {
+	a := New("v1")
+	a.Register("sum", func(ctx context.Context, args sumArgs) (int, error) {
+		return args.A + args.B, nil
+	})
+	a.Register("fail", func(ctx context.Context, name string) (struct{}, error) {
+		return struct{}{}, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	})
+	a.Register("slow", func(ctx context.Context, d time.Duration) (string, error) {
+		time.Sleep(d)
+		return "done", nil
+	})
+	a.Register("panic", func(ctx context.Context, args struct{}) (struct{}, error) {
+		panic("boom")
+	})
+
+	client := connect(t, a)
+	defer client.Close()
+	ctx := context.Background()
+
+	t.Run("announce version and methods", func(t *testing.T) {
+		assert.Equal(t, "v1", client.Version())
+		assert.Equal(t, []string{"fail", "panic", "slow", "sum"}, client.Methods())
+		assert.True(t, client.isCurrent("v1"))
+		assert.False(t, client.isCurrent("v2"))
+	})
+
+	t.Run("call handlers with typed arguments and results", func(t *testing.T) {
+		var res int
+		err := client.Call(ctx, "sum", sumArgs{A: 40, B: 2}, &res)
+		assert.NoError(t, err)
+		assert.Equal(t, 42, res)
+	})
+
+	t.Run("return handler errors as *RemoteError", func(t *testing.T) {
+		err := client.Call(ctx, "fail", "afile", nil)
+		var remote *RemoteError
+		assert.True(t, errors.As(err, &remote))
+		assert.Equal(t, "open afile: file does not exist", err.Error())
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("classify writefs errors", func(t *testing.T) {
+		remote := newRemoteError(&fs.PathError{Op: "remove", Path: "adir", Err: writefs.ErrNotEmpty})
+		assert.Equal(t, "not_empty", remote.Code)
+		assert.True(t, errors.Is(remote, writefs.ErrNotEmpty))
+		assert.False(t, errors.Is(remote, fs.ErrInvalid))
+		assert.False(t, errors.Is(remote, writefs.ErrIsDir))
+	})
+
+	t.Run("return error for unknown methods", func(t *testing.T) {
+		err := client.Call(ctx, "unknown", nil, nil)
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+		assert.Equal(t, "unknown method unknown", err.Error())
+	})
+
+	t.Run("recover handler panics", func(t *testing.T) {
+		err := client.Call(ctx, "panic", struct{}{}, nil)
+		assert.Equal(t, "handler panic panicked: boom", err.Error())
+	})
+
+	t.Run("serve calls concurrently", func(t *testing.T) {
+		done := make(chan string)
+		go func() {
+			var res string
+			client.Call(ctx, "slow", 200*time.Millisecond, &res)
+			done <- res
+		}()
+		var res int
+		start := time.Now()
+		err := client.Call(ctx, "sum", sumArgs{A: 1, B: 1}, &res)
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(start), 150*time.Millisecond)
+		assert.Equal(t, "done", <-done)
+	})
+
+	t.Run("calls are cancelled with their context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		err := client.Call(ctx, "slow", time.Second, nil)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("Register panics on bad handler signature", func(t *testing.T) {
+		assert.Panics(t, func() {
+			a.Register("bad", func(args int) int { return args })
+		})
+	})
+
+	t.Run("Serve returns when its context is done while idle", func(t *testing.T) {
+		reqR, reqW := io.Pipe()
+		resR, resW := io.Pipe()
+		ctx, cancel := context.WithCancel(ctx)
+		served := make(chan error, 1)
+		go func() {
+			served <- a.Serve(ctx, reqR, resW)
+		}()
+		_, err := NewClient(resR, reqW)
+		assert.NoError(t, err)
+
+		cancel()
+		select {
+		case err := <-served:
+			assert.True(t, errors.Is(err, context.Canceled))
+		case <-time.After(time.Second):
+			t.Fatal("Serve didn't return after its context was done")
+		}
+		_, err = reqW.Write([]byte("{}"))
+		assert.True(t, errors.Is(err, io.ErrClosedPipe))
+		resW.Close()
+	})
+
+	t.Run("closed clients return ErrClosed", func(t *testing.T) {
+		client := connect(t, a)
+		assert.NoError(t, client.Close())
+		err := client.Call(ctx, "sum", sumArgs{}, nil)
+		assert.True(t, errors.Is(err, ErrClosed))
+	})
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFSHandlers(t *testing.T) {
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "dir/sub"), 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(root, "dir/file1"), []byte("ciao\n"), 0640)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(root, "dir/sub/file2"), []byte("miao\n"), 0644)
+	assert.NoError(t, err)
+
+	a := New(Version)
+	RegisterFS(a, root)
+	client := connect(t, a)
+	defer client.Close()
+	ctx := context.Background()
+
+	t.Run("fs.stat", func(t *testing.T) {
+		info, err := client.Stat(ctx, "dir/file1")
+		assert.NoError(t, err)
+		assert.Equal(t, "file1", info.Name)
+		assert.Equal(t, int64(5), info.Size)
+		assert.Equal(t, fs.FileMode(0640), info.Mode)
+
+		_, err = client.Stat(ctx, "dir/unknown")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+		_, err = client.Stat(ctx, "/etc/passwd")
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+
+	t.Run("fs.copy", func(t *testing.T) {
+		n, err := client.Copy(ctx, "dir/file1", "dir/copy")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), n)
+		buf, err := os.ReadFile(filepath.Join(root, "dir/copy"))
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao\n", string(buf))
+	})
+
+	t.Run("fs.checksum", func(t *testing.T) {
+		sums, err := client.Checksum(ctx, "dir")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"dir/copy":      sha256Hex("ciao\n"),
+			"dir/file1":     sha256Hex("ciao\n"),
+			"dir/sub/file2": sha256Hex("miao\n"),
+		}, sums)
+	})
+
+	t.Run("fs.move", func(t *testing.T) {
+		err := client.Move(ctx, "dir/copy", "dir/moved")
+		assert.NoError(t, err)
+		_, err = client.Stat(ctx, "dir/copy")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+		_, err = client.Stat(ctx, "dir/moved")
+		assert.NoError(t, err)
+	})
+
+	t.Run("fs.remove", func(t *testing.T) {
+		err := client.Remove(ctx, "dir/sub", false)
+		assert.Error(t, err)
+
+		err = client.Remove(ctx, "dir/sub", true)
+		assert.NoError(t, err)
+		_, err = client.Stat(ctx, "dir/sub")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+		err = client.Remove(ctx, "dir/sub", true)
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+}
+
+func TestStart(t *testing.T) {
+	fsys, err := sshfs.ConnectFromConfig("/var/fixtures", "fakehost")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fsys.Disconnect()
+	runner := &gorun.Runner{FS: fsys, CacheDir: ".agent-test"}
+	defer fsys.Command("rm", "-rf", ".agent-test").Run()
+	ctx := context.Background()
+
+	t.Run("deploy and start the built-in agent", func(t *testing.T) {
+		client, err := StartFS(ctx, runner)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer client.Close()
+
+		assert.Equal(t, Version, client.Version())
+		sums, err := client.Checksum(ctx, "new-dir")
+		assert.NoError(t, err)
+		assert.Len(t, sums, 4)
+	})
+
+	t.Run("redeploy stale agents", func(t *testing.T) {
+		_, err := Start(ctx, runner, gorun.Program{Package: VSAgentPackage}, "another version")
+		assert.True(t, errors.Is(err, ErrVersionMismatch))
+	})
+}
@@ -0,0 +1,237 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/parro-it/vs/gorun"
+	"github.com/parro-it/vs/sshfs"
+	"github.com/parro-it/vs/writefs"
+)
+
+// ErrVersionMismatch is returned when the version of
+// an agent differs from the one expected by the client.
+var ErrVersionMismatch = errors.New("agent version mismatch")
+
+// ErrClosed is returned by calls on a closed client.
+var ErrClosed = errors.New("agent client closed")
+
+// Client invokes the handlers of an agent.
+type Client struct {
+	w io.WriteCloser
+
+	lock    sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *message
+	err     error
+
+	hello hello
+	cmd   *sshfs.Cmd
+}
+
+// NewClient returns a client that talks with an agent,
+// reading its responses from r and writing requests to w.
+// It waits for the agent to announce itself.
+func NewClient(r io.Reader, w io.WriteCloser) (*Client, error) {
+	msg, err := readFrame(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read agent hello: %w", err)
+	}
+	if msg.Method != helloMethod {
+		return nil, fmt.Errorf("unexpected first message from agent: %s", msg.Method)
+	}
+
+	c := &Client{
+		w:       w,
+		pending: map[uint64]chan *message{},
+	}
+	if err := json.Unmarshal(msg.Result, &c.hello); err != nil {
+		return nil, fmt.Errorf("invalid agent hello: %w", err)
+	}
+
+	go c.readLoop(r)
+	return c, nil
+}
+
+func (c *Client) readLoop(r io.Reader) {
+	for {
+		res, err := readFrame(r)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrClosed
+			}
+			c.fail(err)
+			return
+		}
+
+		c.lock.Lock()
+		ch, ok := c.pending[res.ID]
+		delete(c.pending, res.ID)
+		c.lock.Unlock()
+		if ok {
+			ch <- res
+		}
+	}
+}
+
+// fail terminates all pending calls with err.
+func (c *Client) fail(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err == nil {
+		c.err = err
+	}
+	for id, ch := range c.pending {
+		ch <- &message{ID: id, Error: &RemoteError{Code: "closed", Msg: c.err.Error()}}
+		delete(c.pending, id)
+	}
+}
+
+// Version returns the version announced by the agent.
+func (c *Client) Version() string {
+	return c.hello.Version
+}
+
+// Methods returns the methods announced by the agent.
+func (c *Client) Methods() []string {
+	return c.hello.Handlers
+}
+
+// Call invokes method on the agent, passing it args
+// encoded as JSON, and decodes its result in result,
+// unless it's nil. Errors returned by the handler
+// are of type *RemoteError.
+func (c *Client) Call(ctx context.Context, method string, args interface{}, result interface{}) error {
+	rawArgs, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan *message, 1)
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	err = writeFrame(c.w, &message{ID: id, Method: method, Args: rawArgs})
+	c.lock.Unlock()
+
+	if err != nil {
+		c.fail(err)
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.lock.Lock()
+		delete(c.pending, id)
+		c.lock.Unlock()
+		return ctx.Err()
+	case res := <-ch:
+		if res.Error != nil {
+			return res.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(res.Result, result)
+	}
+}
+
+// Close closes the connection with the agent.
+// If the agent was started by Start, Close waits
+// for it to exit.
+func (c *Client) Close() error {
+	err := c.w.Close()
+	if c.cmd != nil {
+		if waitErr := c.cmd.Wait(); err == nil {
+			err = waitErr
+		}
+		c.cmd = nil
+	}
+	c.fail(ErrClosed)
+	return err
+}
+
+// Start deploys the agent program prog on the node
+// runner is connected to, runs it and returns a client
+// connected to it.
+// If the running agent speaks a different protocol or
+// reports a version different from version, the cached
+// binary is removed, the agent is redeployed and started again.
+// If the version is still different, ErrVersionMismatch is returned.
+func Start(ctx context.Context, runner *gorun.Runner, prog gorun.Program, version string) (*Client, error) {
+	client, name, err := start(ctx, runner, prog)
+	if err != nil {
+		return nil, err
+	}
+	if client.isCurrent(version) {
+		return client, nil
+	}
+
+	// the agent is stale: remove its binary
+	// from the cache and deploy it again.
+	client.Close()
+	if err := writefs.Remove(runner.FS, name); err != nil {
+		return nil, err
+	}
+	if prog.Binary != "" && prog.Package != "" {
+		// a prebuilt binary produced the stale agent,
+		// build it again from its sources.
+		prog.Binary = ""
+	}
+
+	client, _, err = start(ctx, runner, prog)
+	if err != nil {
+		return nil, err
+	}
+	if !client.isCurrent(version) {
+		client.Close()
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrVersionMismatch, version, client.Version())
+	}
+	return client, nil
+}
+
+func (c *Client) isCurrent(version string) bool {
+	return c.hello.Protocol == ProtocolVersion && c.hello.Version == version
+}
+
+func start(ctx context.Context, runner *gorun.Runner, prog gorun.Program) (*Client, string, error) {
+	name, err := runner.Deploy(ctx, prog)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the agent lifetime is bound to the client,
+	// not to ctx, which is used only to deploy it.
+	cmd := runner.FS.Command(path.Join(runner.FS.Root(), name))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, "", err
+	}
+
+	client, err := NewClient(stdout, stdin)
+	if err != nil {
+		stdin.Close()
+		cmd.Wait()
+		return nil, "", err
+	}
+	client.cmd = cmd
+	return client, name, nil
+}
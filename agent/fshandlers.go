@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/parro-it/vs/gorun"
+)
+
+// Version is the version of the built-in vsagent program.
+const Version = "1"
+
+// VSAgentPackage is the import path of the built-in
+// agent program, that serves the fs handlers.
+const VSAgentPackage = "github.com/parro-it/vs/agent/vsagent"
+
+// FileInfo describes a file on the disk of an agent.
+type FileInfo struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+}
+
+// PathArgs are the arguments of the
+// fs handlers that operate on a single file.
+type PathArgs struct {
+	Path string `json:"path"`
+	// Recursive is used by fs.remove to
+	// remove directories and their content.
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+// CopyArgs are the arguments of fs.copy and fs.move.
+type CopyArgs struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+}
+
+// CopyResult is the result of fs.copy.
+type CopyResult struct {
+	Bytes int64 `json:"bytes"`
+}
+
+// RegisterFS registers on a the built-in fs handlers,
+// that operate on the local disk of the agent.
+// All paths are slash separated and relative to root,
+// and must satisfy fs.ValidPath.
+//
+// The handlers are:
+//
+//	fs.stat      PathArgs -> FileInfo
+//	fs.copy      CopyArgs -> CopyResult
+//	fs.move      CopyArgs -> nothing
+//	fs.remove    PathArgs -> nothing
+//	fs.checksum  PathArgs -> map of file paths to their SHA-256
+func RegisterFS(a *Agent, root string) {
+	h := fsHandlers{root}
+	a.Register("fs.stat", h.stat)
+	a.Register("fs.copy", h.copy)
+	a.Register("fs.move", h.move)
+	a.Register("fs.remove", h.remove)
+	a.Register("fs.checksum", h.checksum)
+}
+
+type fsHandlers struct {
+	root string
+}
+
+func (h fsHandlers) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(h.root, filepath.FromSlash(name)), nil
+}
+
+func (h fsHandlers) stat(ctx context.Context, args PathArgs) (FileInfo, error) {
+	realPath, err := h.resolve("stat", args.Path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info, err := os.Stat(realPath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (h fsHandlers) copy(ctx context.Context, args CopyArgs) (CopyResult, error) {
+	src, err := h.resolve("copy", args.Src)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	dst, err := h.resolve("copy", args.Dst)
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return CopyResult{}, err
+	}
+	n, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return CopyResult{Bytes: n}, err
+}
+
+func (h fsHandlers) move(ctx context.Context, args CopyArgs) (struct{}, error) {
+	src, err := h.resolve("move", args.Src)
+	if err != nil {
+		return struct{}{}, err
+	}
+	dst, err := h.resolve("move", args.Dst)
+	if err != nil {
+		return struct{}{}, err
+	}
+	return struct{}{}, os.Rename(src, dst)
+}
+
+func (h fsHandlers) remove(ctx context.Context, args PathArgs) (struct{}, error) {
+	realPath, err := h.resolve("remove", args.Path)
+	if err != nil {
+		return struct{}{}, err
+	}
+	if args.Recursive {
+		if _, err := os.Lstat(realPath); err != nil {
+			return struct{}{}, err
+		}
+		return struct{}{}, os.RemoveAll(realPath)
+	}
+	return struct{}{}, os.Remove(realPath)
+}
+
+func (h fsHandlers) checksum(ctx context.Context, args PathArgs) (map[string]string, error) {
+	if _, err := h.resolve("checksum", args.Path); err != nil {
+		return nil, err
+	}
+	fsys := os.DirFS(h.root)
+	sums := map[string]string{}
+	err := fs.WalkDir(fsys, args.Path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		sum, err := sha256File(fsys, name)
+		if err != nil {
+			return err
+		}
+		sums[path.Clean(name)] = sum
+		return nil
+	})
+	return sums, err
+}
+
+func sha256File(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// StartFS deploys and starts the built-in vsagent program
+// on the node runner is connected to. Its fs handlers operate
+// on the root directory of runner.FS.
+func StartFS(ctx context.Context, runner *gorun.Runner) (*Client, error) {
+	return Start(ctx, runner, gorun.Program{Package: VSAgentPackage}, Version)
+}
+
+// Stat calls the fs.stat handler of the agent.
+func (c *Client) Stat(ctx context.Context, name string) (FileInfo, error) {
+	var info FileInfo
+	err := c.Call(ctx, "fs.stat", PathArgs{Path: name}, &info)
+	return info, err
+}
+
+// Copy calls the fs.copy handler of the agent,
+// and returns the number of bytes copied.
+func (c *Client) Copy(ctx context.Context, src, dst string) (int64, error) {
+	var res CopyResult
+	err := c.Call(ctx, "fs.copy", CopyArgs{Src: src, Dst: dst}, &res)
+	return res.Bytes, err
+}
+
+// Move calls the fs.move handler of the agent.
+func (c *Client) Move(ctx context.Context, src, dst string) error {
+	return c.Call(ctx, "fs.move", CopyArgs{Src: src, Dst: dst}, nil)
+}
+
+// Remove calls the fs.remove handler of the agent.
+func (c *Client) Remove(ctx context.Context, name string, recursive bool) error {
+	return c.Call(ctx, "fs.remove", PathArgs{Path: name, Recursive: recursive}, nil)
+}
+
+// Checksum calls the fs.checksum handler of the agent,
+// and returns the SHA-256 of all regular files in the
+// tree rooted at name, keyed by their path.
+func (c *Client) Checksum(ctx context.Context, name string) (map[string]string, error) {
+	var sums map[string]string
+	err := c.Call(ctx, "fs.checksum", PathArgs{Path: name}, &sums)
+	return sums, err
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// ProtocolVersion is the version of the wire protocol
+// spoken by agents and clients. Agents speaking a different
+// protocol version are considered stale.
+const ProtocolVersion = 1
+
+// maxFrameSize is the maximum size of a single frame.
+const maxFrameSize = 64 << 20
+
+// helloMethod is the method of the first message
+// sent by an agent, announcing its versions and handlers.
+const helloMethod = "agent.hello"
+
+// message is the unit of communication between
+// agents and clients. Requests have a Method, responses
+// have the ID of their request and either a Result or an Error.
+type message struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Args   json.RawMessage `json:"args,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RemoteError    `json:"error,omitempty"`
+}
+
+// hello is the payload of the first message
+// sent by an agent.
+type hello struct {
+	Protocol int      `json:"protocol"`
+	Version  string   `json:"version"`
+	Handlers []string `json:"handlers"`
+}
+
+// writeFrame writes msg to w as a JSON document
+// prefixed by its length as a big endian uint32.
+func writeFrame(w io.Writer, msg *message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxFrameSize {
+		return fmt.Errorf("frame too large: %d bytes", len(payload))
+	}
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame reads a frame written by writeFrame.
+func readFrame(r io.Reader) (*message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, fmt.Errorf("invalid frame: %w", err)
+	}
+	return &msg, nil
+}
+
+// RemoteError is an error returned by a handler
+// running on an agent.
+type RemoteError struct {
+	// Code classifies the error, so that
+	// errors.Is works with the fs.Err* sentinels.
+	Code string `json:"code,omitempty"`
+	Msg  string `json:"msg"`
+}
+
+func (e *RemoteError) Error() string {
+	return e.Msg
+}
+
+// Is allows errors.Is to compare remote errors
+// with the sentinel they were originated from.
+func (e *RemoteError) Is(target error) bool {
+	sentinel := writefs.CodeError(e.Code)
+	return sentinel != nil && errors.Is(sentinel, target)
+}
+
+func newRemoteError(err error) *RemoteError {
+	var remote *RemoteError
+	if errors.As(err, &remote) {
+		return remote
+	}
+	return &RemoteError{Code: writefs.ErrorCode(err), Msg: err.Error()}
+}
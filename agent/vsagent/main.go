@@ -0,0 +1,11 @@
+// Command vsagent is the built-in agent program.
+// It serves the fs handlers on the directory it runs in.
+package main
+
+import "github.com/parro-it/vs/agent"
+
+func main() {
+	a := agent.New(agent.Version)
+	agent.RegisterFS(a, ".")
+	a.Main()
+}
@@ -0,0 +1,411 @@
+// Package diff compares two fs.FS trees and reports
+// the entries that differ between them.
+//
+//	changes, err := diff.Trees(osfs.DirWriteFS("build"), remote, diff.Options{
+//		Compare: diff.ByHash,
+//		Ignore:  []string{"*.tmp", ".git"},
+//	})
+//	diff.WriteText(os.Stdout, changes)
+package diff
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// Kind is the kind of a change.
+type Kind int
+
+const (
+	// Added entries exist only in the new tree.
+	Added Kind = iota
+	// Removed entries exist only in the old tree.
+	Removed
+	// Modified entries have different content
+	// or type in the two trees.
+	Modified
+	// ModeChanged entries have the same content
+	// but different permissions in the two trees.
+	ModeChanged
+)
+
+var kindNames = map[Kind]string{
+	Added:       "added",
+	Removed:     "removed",
+	Modified:    "modified",
+	ModeChanged: "mode",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (k Kind) MarshalText() ([]byte, error) {
+	if _, ok := kindNames[k]; !ok {
+		return nil, fmt.Errorf("unknown change kind %d", int(k))
+	}
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (k *Kind) UnmarshalText(text []byte) error {
+	for kind, name := range kindNames {
+		if name == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown change kind `%s`", text)
+}
+
+// Compare selects how the content of
+// files is compared.
+type Compare int
+
+const (
+	// BySizeModTime considers two files equal
+	// when they have the same size and modification time.
+	BySizeModTime Compare = iota
+	// ByHash considers two files equal when
+	// they have the same size and checksum.
+	ByHash
+	// BySizeModTimeAndHash considers two files equal when
+	// they have the same size and either the same modification
+	// time or the same checksum. Checksums are computed only
+	// for files with different modification times.
+	BySizeModTimeAndHash
+)
+
+// Options configures a comparison.
+type Options struct {
+	// Compare selects how the content
+	// of files is compared.
+	Compare Compare
+	// Hash is the algorithm used to compute checksums,
+	// one of the writefs hash algorithms. It defaults
+	// to writefs.SHA256.
+	Hash string
+	// ModTimeWindow is the maximum difference between
+	// the modification times of two files considered
+	// equal. It defaults to one second, because sftp
+	// servers report modification times in seconds.
+	ModTimeWindow time.Duration
+	// Ignore are path.Match patterns of entries excluded
+	// from the comparison. A pattern is matched both
+	// against the base name and the path of each entry.
+	// The content of ignored directories is ignored too.
+	Ignore []string
+}
+
+// Ignored reports whether name matches
+// any of the ignore patterns of opts.
+func (opts Options) Ignored(name string) bool {
+	for _, pattern := range opts.Ignore {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry describes a file or directory in a tree.
+type Entry struct {
+	Mode    fs.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mtime"`
+	// Hash is the checksum of the file. It's set only
+	// for files whose checksum was computed.
+	Hash HexBytes `json:"hash,omitempty"`
+}
+
+// HexBytes is a byte slice encoded
+// in JSON as an hexadecimal string.
+type HexBytes []byte
+
+// MarshalText implements encoding.TextMarshaler
+func (b HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (b *HexBytes) UnmarshalText(text []byte) error {
+	res, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*b = res
+	return nil
+}
+
+// Change is a difference between two trees.
+type Change struct {
+	Kind Kind `json:"kind"`
+	// Path is the slash separated path of
+	// the entry, relative to the roots of the trees.
+	Path string `json:"path"`
+	// Old describes the entry in the old tree.
+	// It's nil for Added entries.
+	Old *Entry `json:"old,omitempty"`
+	// New describes the entry in the new tree.
+	// It's nil for Removed entries.
+	New *Entry `json:"new,omitempty"`
+}
+
+// String formats c as a line of the text format.
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return "+ " + c.Path
+	case Removed:
+		return "- " + c.Path
+	case ModeChanged:
+		return fmt.Sprintf("m %s (%s -> %s)", c.Path, c.Old.Mode, c.New.Mode)
+	default:
+		return "M " + c.Path
+	}
+}
+
+// WriteText writes changes to w, one per line, each
+// prefixed by `+` for added entries, `-` for removed
+// entries, `M` for modified entries and `m` for entries
+// whose permissions changed.
+func WriteText(w io.Writer, changes []Change) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintln(w, c.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes changes to w as a JSON array.
+func WriteJSON(w io.Writer, changes []Change) error {
+	if changes == nil {
+		changes = []Change{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(changes)
+}
+
+// Trees compares the tree rooted at oldFS with the one
+// rooted at newFS, and returns the changes that turn
+// the first in the second. Changes are in depth first
+// order, with the entries of each directory sorted by name.
+// All entries of added or removed directories are reported.
+func Trees(oldFS, newFS fs.FS, opts Options) ([]Change, error) {
+	for _, pattern := range opts.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern `%s`: %w", pattern, err)
+		}
+	}
+	if opts.Hash == "" {
+		opts.Hash = writefs.SHA256
+	}
+	if _, err := writefs.NewHash(opts.Hash); err != nil {
+		return nil, err
+	}
+	if opts.ModTimeWindow == 0 {
+		opts.ModTimeWindow = time.Second
+	}
+
+	d := &differ{oldFS: oldFS, newFS: newFS, opts: opts}
+	if err := d.dir("."); err != nil {
+		return nil, err
+	}
+	return d.changes, nil
+}
+
+type differ struct {
+	oldFS   fs.FS
+	newFS   fs.FS
+	opts    Options
+	changes []Change
+}
+
+func readDir(fsys fs.FS, name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read `%s`: %w", name, err)
+	}
+	return entries, nil
+}
+
+// dir compares the content of the directory
+// name, that exists in both trees.
+func (d *differ) dir(name string) error {
+	oldEntries, err := readDir(d.oldFS, name)
+	if err != nil {
+		return err
+	}
+	newEntries, err := readDir(d.newFS, name)
+	if err != nil {
+		return err
+	}
+
+	// entries are sorted by name: merge them
+	for len(oldEntries) > 0 || len(newEntries) > 0 {
+		var oldEntry, newEntry fs.DirEntry
+		switch {
+		case len(newEntries) == 0 ||
+			len(oldEntries) > 0 && oldEntries[0].Name() < newEntries[0].Name():
+			oldEntry, oldEntries = oldEntries[0], oldEntries[1:]
+		case len(oldEntries) == 0 ||
+			newEntries[0].Name() < oldEntries[0].Name():
+			newEntry, newEntries = newEntries[0], newEntries[1:]
+		default:
+			oldEntry, oldEntries = oldEntries[0], oldEntries[1:]
+			newEntry, newEntries = newEntries[0], newEntries[1:]
+		}
+
+		var entryName string
+		if oldEntry != nil {
+			entryName = path.Join(name, oldEntry.Name())
+		} else {
+			entryName = path.Join(name, newEntry.Name())
+		}
+		if d.opts.Ignored(entryName) {
+			continue
+		}
+
+		if err := d.entry(entryName, oldEntry, newEntry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) entry(name string, oldEntry, newEntry fs.DirEntry) error {
+	switch {
+	case newEntry == nil:
+		return d.all(Removed, d.oldFS, name, oldEntry)
+	case oldEntry == nil:
+		return d.all(Added, d.newFS, name, newEntry)
+	}
+
+	oldInfo, err := oldEntry.Info()
+	if err != nil {
+		return err
+	}
+	newInfo, err := newEntry.Info()
+	if err != nil {
+		return err
+	}
+	before, after := entryOf(oldInfo), entryOf(newInfo)
+
+	if oldInfo.IsDir() != newInfo.IsDir() {
+		d.add(Modified, name, before, after)
+		return nil
+	}
+
+	if oldInfo.IsDir() {
+		if before.Mode != after.Mode {
+			d.add(ModeChanged, name, before, after)
+		}
+		return d.dir(name)
+	}
+
+	equal, err := d.sameContent(name, before, after)
+	if err != nil {
+		return err
+	}
+	if !equal {
+		d.add(Modified, name, before, after)
+	} else if before.Mode != after.Mode {
+		d.add(ModeChanged, name, before, after)
+	}
+	return nil
+}
+
+func (d *differ) sameContent(name string, before, after *Entry) (bool, error) {
+	if before.Size != after.Size {
+		return false, nil
+	}
+
+	sameModTime := absDuration(before.ModTime.Sub(after.ModTime)) < d.opts.ModTimeWindow
+	switch d.opts.Compare {
+	case BySizeModTime:
+		return sameModTime, nil
+	case BySizeModTimeAndHash:
+		if sameModTime {
+			return true, nil
+		}
+	}
+
+	var err error
+	if before.Hash, err = writefs.Hash(d.oldFS, name, d.opts.Hash); err != nil {
+		return false, err
+	}
+	if after.Hash, err = writefs.Hash(d.newFS, name, d.opts.Hash); err != nil {
+		return false, err
+	}
+	return bytes.Equal(before.Hash, after.Hash), nil
+}
+
+// all adds a change of the given kind for
+// the entry name and, if it's a directory,
+// for all of its content.
+func (d *differ) all(kind Kind, fsys fs.FS, name string, entry fs.DirEntry) error {
+	info, err := entry.Info()
+	if err != nil {
+		return err
+	}
+	e := entryOf(info)
+	if kind == Added {
+		d.add(kind, name, nil, e)
+	} else {
+		d.add(kind, name, e, nil)
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+	entries, err := readDir(fsys, name)
+	if err != nil {
+		return err
+	}
+	for _, child := range entries {
+		childName := path.Join(name, child.Name())
+		if d.opts.Ignored(childName) {
+			continue
+		}
+		if err := d.all(kind, fsys, childName, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) add(kind Kind, name string, before, after *Entry) {
+	d.changes = append(d.changes, Change{Kind: kind, Path: name, Old: before, New: after})
+}
+
+func entryOf(info fs.FileInfo) *Entry {
+	return &Entry{
+		Mode:    info.Mode(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,162 @@
+package diff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrees(t *testing.T) {
+	mtime := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content), Mode: 0644, ModTime: mtime}
+	}
+
+	oldFS := fstest.MapFS{
+		"same":          file("ciao\n"),
+		"modified":      file("ciao\n"),
+		"chmod":         file("ciao\n"),
+		"removed":       file("ciao\n"),
+		"olddir/afile":  file("ciao\n"),
+		"touched":       file("ciao\n"),
+		"sub/nested":    file("ciao\n"),
+		"ignored.tmp":   file("ciao\n"),
+		"skip/inside":   file("ciao\n"),
+		"typechange":    file("ciao\n"),
+		"sub/same-size": file("ciao\n"),
+	}
+	newFS := fstest.MapFS{
+		"same":          file("ciao\n"),
+		"modified":      file("miao, ciao\n"),
+		"chmod":         {Data: []byte("ciao\n"), Mode: 0600, ModTime: mtime},
+		"added":         file("ciao\n"),
+		"newdir/afile":  file("ciao\n"),
+		"touched":       {Data: []byte("ciao\n"), Mode: 0644, ModTime: mtime.Add(time.Hour)},
+		"sub/nested":    file("ciao\n"),
+		"typechange/x":  file("ciao\n"),
+		"sub/same-size": {Data: []byte("miao\n"), Mode: 0644, ModTime: mtime.Add(time.Hour)},
+		"skip/other":    file("ciao\n"),
+	}
+
+	summary := func(changes []Change) []string {
+		var res []string
+		for _, c := range changes {
+			res = append(res, c.String())
+		}
+		return res
+	}
+
+	t.Run("compare by size and mtime", func(t *testing.T) {
+		changes, err := Trees(oldFS, newFS, Options{Ignore: []string{"*.tmp", "skip"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"+ added",
+			"m chmod (-rw-r--r-- -> -rw-------)",
+			"M modified",
+			"+ newdir",
+			"+ newdir/afile",
+			"- olddir",
+			"- olddir/afile",
+			"- removed",
+			"M sub/same-size",
+			"M touched",
+			"M typechange",
+		}, summary(changes))
+	})
+
+	t.Run("compare by hash", func(t *testing.T) {
+		changes, err := Trees(oldFS, newFS, Options{Compare: ByHash, Ignore: []string{"*.tmp", "skip"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"+ added",
+			"m chmod (-rw-r--r-- -> -rw-------)",
+			"M modified",
+			"+ newdir",
+			"+ newdir/afile",
+			"- olddir",
+			"- olddir/afile",
+			"- removed",
+			"M sub/same-size",
+			"M typechange",
+		}, summary(changes))
+
+		for _, c := range changes {
+			if c.Path == "sub/same-size" {
+				expected := sha256.Sum256([]byte("miao\n"))
+				assert.Equal(t, HexBytes(expected[:]), c.New.Hash)
+			}
+		}
+	})
+
+	t.Run("compare by size, mtime and hash", func(t *testing.T) {
+		changes, err := Trees(oldFS, newFS, Options{Compare: BySizeModTimeAndHash, Ignore: []string{"*.tmp", "skip"}})
+		assert.NoError(t, err)
+		assert.NotContains(t, summary(changes), "M touched")
+		assert.Contains(t, summary(changes), "M sub/same-size")
+		for _, c := range changes {
+			if c.Path == "modified" {
+				// size differs: no need to hash
+				assert.Nil(t, c.New.Hash)
+			}
+		}
+	})
+
+	t.Run("ignore patterns match paths", func(t *testing.T) {
+		changes, err := Trees(oldFS, newFS, Options{Ignore: []string{"*.tmp", "skip/other", "sub/*", "*dir"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"+ added",
+			"m chmod (-rw-r--r-- -> -rw-------)",
+			"M modified",
+			"- removed",
+			"- skip/inside",
+			"M touched",
+			"M typechange",
+		}, summary(changes))
+	})
+
+	t.Run("return error for invalid patterns", func(t *testing.T) {
+		_, err := Trees(oldFS, newFS, Options{Ignore: []string{"[-"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("return no changes for equal trees", func(t *testing.T) {
+		changes, err := Trees(oldFS, oldFS, Options{Compare: ByHash})
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("WriteText", func(t *testing.T) {
+		var buf bytes.Buffer
+		changes, err := Trees(oldFS, newFS, Options{Ignore: []string{"*.tmp", "skip", "sub", "*dir", "typechange"}})
+		assert.NoError(t, err)
+		assert.NoError(t, WriteText(&buf, changes))
+		assert.Equal(t, "+ added\nm chmod (-rw-r--r-- -> -rw-------)\nM modified\n- removed\nM touched\n", buf.String())
+	})
+
+	t.Run("WriteJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		changes, err := Trees(oldFS, newFS, Options{Compare: ByHash, Ignore: []string{"*.tmp", "skip", "sub", "*dir", "typechange"}})
+		assert.NoError(t, err)
+		assert.NoError(t, WriteJSON(&buf, changes))
+
+		var decoded []Change
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, len(changes), len(decoded))
+		assert.Equal(t, Added, decoded[0].Kind)
+		assert.Equal(t, "added", decoded[0].Path)
+		assert.Nil(t, decoded[0].Old)
+		assert.Equal(t, Modified, decoded[2].Kind)
+		assert.Equal(t, changes[2].New.Hash, decoded[2].New.Hash)
+		assert.Contains(t, buf.String(), `"kind": "modified"`)
+
+		buf.Reset()
+		assert.NoError(t, WriteJSON(&buf, nil))
+		assert.Equal(t, "[]\n", buf.String())
+	})
+}
@@ -0,0 +1,141 @@
+package faultfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/parro-it/vs/internal/wrap"
+)
+
+// ErrDisconnected is a convenience error
+// to simulate lost connections.
+var ErrDisconnected = errors.New("connection lost")
+
+// Fault describes a fault to inject in the
+// operations of a file system.
+//
+// Operations are identified by the names used as
+// Op in the errors they return: "open" (for Open and
+// OpenFile), "mkdir", "remove", "rename", "stat",
+// "readdir", "chmod", "chtimes", "statvfs", "hash",
+// "readlink", "watch" and "glob" for file system
+// operations, and
+// "read", "write", "seek", "truncate", "stat", "readdir"
+// and "close" for operations on open files.
+type Fault struct {
+	// Op is the name of the operation the fault applies
+	// to. An empty Op matches all operations.
+	Op string
+	// Pattern is a path.Match pattern for the names
+	// of the files the fault applies to. An empty
+	// Pattern matches all files.
+	Pattern string
+	// Probability is the probability that the fault is
+	// injected in a matching operation, drawn from the
+	// seeded source of the file system. Zero means
+	// that the fault is always injected.
+	Probability float64
+	// Times is the maximum number of times the
+	// fault is injected. Zero means no limit.
+	Times int
+
+	// Latency delays the operation.
+	Latency time.Duration
+	// Err is the error returned by the operation,
+	// wrapped in a *fs.PathError. When it's nil,
+	// the operation is executed after Latency.
+	Err error
+	// Limit is the maximum number of bytes transferred
+	// by a read or write, causing a short transfer.
+	// When Err is not nil, it's returned after the bytes
+	// are transferred. Zero means no limit.
+	Limit int
+	// After is the number of bytes a file transfers
+	// before the fault applies to its reads or writes.
+	// The transfer that crosses it stops at After bytes
+	// and, when Err is not nil, the file becomes broken
+	// and all its later operations fail with Err, as on
+	// a connection lost mid-stream.
+	After int64
+}
+
+// Injection records a fault injected
+// in an operation on a file.
+type Injection struct {
+	Op    string
+	Path  string
+	Fault Fault
+}
+
+// state is shared by a file system, by
+// its files and by the file systems
+// returned by its Sub method.
+type state struct {
+	lock   sync.Mutex
+	rules  []*rule
+	random *rand.Rand
+	log    []Injection
+}
+
+// rule is a fault along with the
+// number of times it was injected.
+type rule struct {
+	fault    Fault
+	injected int
+}
+
+// match returns the first fault to inject in op on
+// the named file, or nil if there is none. When applies
+// is not nil, faults for which it returns false are
+// skipped. Returned faults are recorded in the log.
+func (s *state) match(op string, name string, applies func(Fault) bool) *Fault {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, r := range s.rules {
+		fault := r.fault
+		if fault.Op != "" && fault.Op != op {
+			continue
+		}
+		if fault.Pattern != "" {
+			if ok, _ := path.Match(fault.Pattern, name); !ok {
+				continue
+			}
+		}
+		if fault.Times != 0 && r.injected >= fault.Times {
+			continue
+		}
+		if applies != nil && !applies(fault) {
+			continue
+		}
+		if fault.Probability != 0 && s.random.Float64() >= fault.Probability {
+			continue
+		}
+
+		r.injected++
+		s.log = append(s.log, Injection{Op: op, Path: name, Fault: fault})
+		return &fault
+	}
+	return nil
+}
+
+// inject injects the faults of op on the named file,
+// waiting for their latency or for ctx to be done.
+func (s *state) inject(ctx context.Context, op string, name string) error {
+	fault := s.match(op, name, nil)
+	if fault == nil {
+		return nil
+	}
+	if err := wrap.Sleep(ctx, fault.Latency); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if fault.Err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fault.Err}
+	}
+	return nil
+}
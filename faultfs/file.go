@@ -0,0 +1,131 @@
+package faultfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/parro-it/vs/internal/wrap"
+	"github.com/parro-it/vs/writefs"
+)
+
+// file injects faults in the
+// operations of an open file.
+type file struct {
+	state *state
+	name  string
+
+	// lock protects transferred and broken
+	lock sync.Mutex
+	// transferred is the number of bytes
+	// read and written through the file
+	transferred int64
+	// broken is the error returned by all operations
+	// after a fault with After and Err is injected
+	broken error
+}
+
+var _ wrap.Hooks = &file{}
+
+// faultOps are the operations matched by
+// the faults injected in file operations.
+var faultOps = map[wrap.Op]string{
+	wrap.Read:     "read",
+	wrap.ReadAt:   "read",
+	wrap.Write:    "write",
+	wrap.WriteAt:  "write",
+	wrap.Seek:     "seek",
+	wrap.Truncate: "truncate",
+	wrap.ReadDir:  "readdir",
+	wrap.Stat:     "stat",
+	wrap.Close:    "close",
+}
+
+// shortErrors are the errors returned when a fault
+// shortens a transfer without an error.
+var shortErrors = map[wrap.Op]error{
+	wrap.ReadAt:  io.ErrUnexpectedEOF,
+	wrap.Write:   io.ErrShortWrite,
+	wrap.WriteAt: io.ErrShortWrite,
+}
+
+// newFile wraps f, so that the faults of state
+// are injected in its operations.
+func newFile(state *state, name string, f fs.File) writefs.FileWriter {
+	return wrap.NewFile(f, name, &file{state: state, name: name})
+}
+
+// check returns the error of a broken file,
+// or injects the faults of op otherwise.
+func (f *file) check(op string) error {
+	f.lock.Lock()
+	broken := f.broken
+	f.lock.Unlock()
+	if broken != nil {
+		return broken
+	}
+	return f.state.inject(context.Background(), op, f.name)
+}
+
+// Call implements wrap.Hooks
+// Broken files are closed and
+// return their error.
+func (f *file) Call(op wrap.Op, do func() error) error {
+	if err := f.check(faultOps[op]); err != nil {
+		if op == wrap.Close {
+			do()
+		}
+		return err
+	}
+	return do()
+}
+
+// Transfer implements wrap.Hooks
+func (f *file) Transfer(op wrap.Op, buf []byte, do func([]byte) (int, error)) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.broken != nil {
+		return 0, f.broken
+	}
+
+	name := faultOps[op]
+	transferred := f.transferred
+	fault := f.state.match(name, f.name, func(fault Fault) bool {
+		return fault.After == 0 ||
+			transferred < fault.After && transferred+int64(len(buf)) > fault.After
+	})
+	if fault == nil {
+		n, err := do(buf)
+		f.transferred += int64(n)
+		return n, err
+	}
+
+	if err := wrap.Sleep(context.Background(), fault.Latency); err != nil {
+		return 0, err
+	}
+	limit := len(buf)
+	if fault.Limit > 0 && fault.Limit < limit {
+		limit = fault.Limit
+	}
+	if fault.After > 0 && fault.After-transferred < int64(limit) {
+		limit = int(fault.After - transferred)
+	}
+
+	n, err := do(buf[:limit])
+	f.transferred += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if fault.Err != nil {
+		err = &fs.PathError{Op: name, Path: f.name, Err: fault.Err}
+		if fault.After > 0 {
+			f.broken = err
+		}
+		return n, err
+	}
+	if short := shortErrors[op]; n < len(buf) && short != nil {
+		return n, &fs.PathError{Op: name, Path: f.name, Err: short}
+	}
+	return n, nil
+}
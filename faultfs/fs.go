@@ -0,0 +1,301 @@
+// Package faultfs provides a file system wrapper
+// that injects faults in the operations of the
+// file system it wraps, to test error handling.
+//
+// Unlike the wrappers of syncfs and lazyfs, New returns
+// the exported FS type rather than a writefs.WriteFS:
+// tests need its methods to change the injected
+// faults and to inspect the log of the injections.
+package faultfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"math/rand"
+	"time"
+
+	"github.com/parro-it/vs/internal/wrap"
+	"github.com/parro-it/vs/writefs"
+)
+
+// FS wraps a file system and injects faults in its
+// operations and in the operations on its open files.
+// Faults that don't return an error delay the operations,
+// or shorten their transfers, and then forward them
+// to the wrapped file system.
+type FS struct {
+	// state is shared with the
+	// file systems returned by Sub
+	state  *state
+	wrapfs fs.FS
+}
+
+// New returns a file system that injects faults in
+// the operations of fsys. Random faults are drawn from
+// a source initialized with seed, so that the faults
+// injected by a sequence of operations are reproducible.
+func New(fsys fs.FS, seed int64, faults ...Fault) *FS {
+	wrapped := &FS{
+		state:  &state{random: rand.New(rand.NewSource(seed))},
+		wrapfs: fsys,
+	}
+	wrapped.Inject(faults...)
+	return wrapped
+}
+
+var (
+	_ fs.StatFS     = &FS{}
+	_ fs.ReadFileFS = &FS{}
+	_ fs.SubFS      = &FS{}
+	_ fs.ReadDirFS  = &FS{}
+	_ fs.GlobFS     = &FS{}
+
+	_ writefs.WriteFS     = &FS{}
+	_ writefs.RemoveFS    = &FS{}
+	_ writefs.MkDirFS     = &FS{}
+	_ writefs.StatVFSFS   = &FS{}
+	_ writefs.HashFS      = &FS{}
+	_ writefs.RangeHashFS = &FS{}
+	_ writefs.ChmodFS     = &FS{}
+	_ writefs.ChtimesFS   = &FS{}
+	_ writefs.WatchFS     = &FS{}
+	_ writefs.ReadLinkFS  = &FS{}
+	_ writefs.RenameFS    = &FS{}
+
+	_ writefs.OpenFileContextFS = &FS{}
+	_ writefs.MkDirContextFS    = &FS{}
+	_ writefs.RemoveContextFS   = &FS{}
+	_ writefs.StatContextFS     = &FS{}
+)
+
+// Inject adds faults to the ones injected by fsys.
+// When more than one fault matches an operation,
+// the first one added is injected.
+func (fsys *FS) Inject(faults ...Fault) {
+	fsys.state.lock.Lock()
+	defer fsys.state.lock.Unlock()
+	for _, fault := range faults {
+		fsys.state.rules = append(fsys.state.rules, &rule{fault: fault})
+	}
+}
+
+// Reset removes all faults and clears the log.
+func (fsys *FS) Reset() {
+	fsys.state.lock.Lock()
+	defer fsys.state.lock.Unlock()
+	fsys.state.rules = nil
+	fsys.state.log = nil
+}
+
+// Log returns the faults injected so far,
+// in the order they were injected.
+func (fsys *FS) Log() []Injection {
+	fsys.state.lock.Lock()
+	defer fsys.state.lock.Unlock()
+	return append([]Injection(nil), fsys.state.log...)
+}
+
+func (fsys *FS) inject(op string, name string) error {
+	return fsys.state.inject(context.Background(), op, name)
+}
+
+// MkDir implements writefs.MkDirFS
+func (fsys *FS) MkDir(name string, perm fs.FileMode) error {
+	if err := fsys.inject("mkdir", name); err != nil {
+		return err
+	}
+	return writefs.MkDir(fsys.wrapfs, name, perm)
+}
+
+// Remove implements writefs.RemoveFS
+func (fsys *FS) Remove(name string) error {
+	if err := fsys.inject("remove", name); err != nil {
+		return err
+	}
+	return writefs.Remove(fsys.wrapfs, name)
+}
+
+// OpenFile implements writefs.WriteFS
+// Faults are injected in the operations on the
+// returned file, if any.
+func (fsys *FS) OpenFile(name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	if err := fsys.inject(writefs.OpenFileOp(flag, perm), name); err != nil {
+		return nil, err
+	}
+	f, err := writefs.OpenFile(fsys.wrapfs, name, flag, perm)
+	if err != nil || f == nil {
+		return f, err
+	}
+	return newFile(fsys.state, name, f), nil
+}
+
+// StatVFS implements writefs.StatVFSFS
+func (fsys *FS) StatVFS(name string) (writefs.StatFSInfo, error) {
+	if err := fsys.inject("statvfs", name); err != nil {
+		return writefs.StatFSInfo{}, err
+	}
+	return writefs.StatVFS(fsys.wrapfs, name)
+}
+
+// Hash implements writefs.HashFS
+func (fsys *FS) Hash(name string, algo string) ([]byte, error) {
+	if err := fsys.inject("hash", name); err != nil {
+		return nil, err
+	}
+	return writefs.Hash(fsys.wrapfs, name, algo)
+}
+
+// HashRanges implements writefs.RangeHashFS
+func (fsys *FS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	if err := fsys.inject("hash", name); err != nil {
+		return nil, err
+	}
+	return writefs.HashRanges(fsys.wrapfs, name, algo, size)
+}
+
+// Chmod implements writefs.ChmodFS
+func (fsys *FS) Chmod(name string, mode fs.FileMode) error {
+	if err := fsys.inject("chmod", name); err != nil {
+		return err
+	}
+	return writefs.Chmod(fsys.wrapfs, name, mode)
+}
+
+// Chtimes implements writefs.ChtimesFS
+func (fsys *FS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if err := fsys.inject("chtimes", name); err != nil {
+		return err
+	}
+	return writefs.Chtimes(fsys.wrapfs, name, atime, mtime)
+}
+
+// Rename implements writefs.RenameFS
+// Faults are matched against oldname.
+func (fsys *FS) Rename(oldname string, newname string) error {
+	if err := fsys.inject("rename", oldname); err != nil {
+		return err
+	}
+	return writefs.Rename(fsys.wrapfs, oldname, newname)
+}
+
+// ReadLink implements writefs.ReadLinkFS
+func (fsys *FS) ReadLink(name string) (string, error) {
+	if err := fsys.inject("readlink", name); err != nil {
+		return "", err
+	}
+	return writefs.ReadLink(fsys.wrapfs, name)
+}
+
+// Watch implements writefs.WatchFS
+// Faults are injected in the scans of
+// the file systems that are polled.
+func (fsys *FS) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	if err := fsys.state.inject(ctx, "watch", name); err != nil {
+		return nil, err
+	}
+	return wrap.Watch(ctx, fsys, fsys.wrapfs, name, recursive)
+}
+
+// OpenFileContext implements writefs.OpenFileContextFS
+func (fsys *FS) OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	if err := fsys.state.inject(ctx, writefs.OpenFileOp(flag, perm), name); err != nil {
+		return nil, err
+	}
+	f, err := writefs.OpenFileContext(ctx, fsys.wrapfs, name, flag, perm)
+	if err != nil || f == nil {
+		return f, err
+	}
+	return newFile(fsys.state, name, f), nil
+}
+
+// MkDirContext implements writefs.MkDirContextFS
+func (fsys *FS) MkDirContext(ctx context.Context, name string, perm fs.FileMode) error {
+	if err := fsys.state.inject(ctx, "mkdir", name); err != nil {
+		return err
+	}
+	return writefs.MkDirContext(ctx, fsys.wrapfs, name, perm)
+}
+
+// RemoveContext implements writefs.RemoveContextFS
+func (fsys *FS) RemoveContext(ctx context.Context, name string) error {
+	if err := fsys.state.inject(ctx, "remove", name); err != nil {
+		return err
+	}
+	return writefs.RemoveContext(ctx, fsys.wrapfs, name)
+}
+
+// StatContext implements writefs.StatContextFS
+func (fsys *FS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	if err := fsys.state.inject(ctx, "stat", name); err != nil {
+		return nil, err
+	}
+	return writefs.StatContext(ctx, fsys.wrapfs, name)
+}
+
+// Stat implements fs.StatFS
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	if err := fsys.inject("stat", name); err != nil {
+		return nil, err
+	}
+	return fs.Stat(fsys.wrapfs, name)
+}
+
+// ReadFile implements fs.ReadFileFS
+// The file is opened and read through fsys,
+// so that the faults of both operations
+// are injected.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Sub implements fs.SubFS
+// The returned file system is writable and shares the
+// faults, the random source and the log of fsys.
+// Patterns of faults are matched against names
+// relative to the returned file system.
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	sub, err := writefs.Sub(fsys.wrapfs, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{
+		state:  fsys.state,
+		wrapfs: sub,
+	}, nil
+}
+
+// Open implements fs.FS
+// Faults are injected in the operations on the
+// returned file.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if err := fsys.inject("open", name); err != nil {
+		return nil, err
+	}
+	f, err := fsys.wrapfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return newFile(fsys.state, name, f), nil
+}
+
+// ReadDir implements fs.ReadDirFS
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := fsys.inject("readdir", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(fsys.wrapfs, name)
+}
+
+// Glob implements fs.GlobFS
+func (fsys *FS) Glob(pattern string) ([]string, error) {
+	if err := fsys.inject("glob", pattern); err != nil {
+		return nil, err
+	}
+	return fs.Glob(fsys.wrapfs, pattern)
+}
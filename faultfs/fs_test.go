@@ -0,0 +1,194 @@
+package faultfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/parro-it/vs/memfs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultFS(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	newFS := func(faults ...Fault) *FS {
+		mem := memfs.New()
+		_, err := writefs.WriteFile(mem, "afile.txt", []byte("ciao, mondo\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.MkDir(mem, "adir", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(mem, "adir/bfile.txt", []byte("miao\n"))
+		assert.NoError(t, err)
+		return New(mem, 42, faults...)
+	}
+
+	t.Run("pass writefstest.TestFS without faults", func(t *testing.T) {
+		fsys := New(memfs.New(), 42)
+		t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys))
+	})
+
+	t.Run("inject errors by op and pattern", func(t *testing.T) {
+		fsys := newFS(
+			Fault{Op: "open", Pattern: "*.txt", Err: errBoom},
+			Fault{Op: "remove", Err: fs.ErrPermission},
+		)
+
+		_, err := fsys.Open("afile.txt")
+		var pathErr *fs.PathError
+		assert.True(t, errors.As(err, &pathErr))
+		assert.Equal(t, "open", pathErr.Op)
+		assert.Equal(t, "afile.txt", pathErr.Path)
+		assert.True(t, errors.Is(err, errBoom))
+
+		_, err = fs.Stat(fsys, "afile.txt")
+		assert.NoError(t, err)
+		buf, err := fs.ReadFile(fsys, "adir/bfile.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "miao\n", string(buf))
+
+		_, err = writefs.OpenFile(fsys, "newfile.txt", os.O_CREATE|os.O_WRONLY, fs.FileMode(0644))
+		assert.True(t, errors.Is(err, errBoom))
+		err = writefs.Remove(fsys, "adir/bfile.txt")
+		assert.True(t, errors.Is(err, fs.ErrPermission))
+
+		assert.Equal(t, []Injection{
+			{Op: "open", Path: "afile.txt", Fault: Fault{Op: "open", Pattern: "*.txt", Err: errBoom}},
+			{Op: "open", Path: "newfile.txt", Fault: Fault{Op: "open", Pattern: "*.txt", Err: errBoom}},
+			{Op: "remove", Path: "adir/bfile.txt", Fault: Fault{Op: "remove", Err: fs.ErrPermission}},
+		}, fsys.Log())
+
+		fsys.Reset()
+		assert.Empty(t, fsys.Log())
+		_, err = fs.ReadFile(fsys, "afile.txt")
+		assert.NoError(t, err)
+	})
+
+	t.Run("inject faults a limited number of times", func(t *testing.T) {
+		fsys := newFS(Fault{Op: "stat", Err: errBoom, Times: 2})
+		_, err := fs.Stat(fsys, "afile.txt")
+		assert.Error(t, err)
+		_, err = fs.Stat(fsys, "afile.txt")
+		assert.Error(t, err)
+		_, err = fs.Stat(fsys, "afile.txt")
+		assert.NoError(t, err)
+		assert.Len(t, fsys.Log(), 2)
+	})
+
+	t.Run("seeded probability is reproducible", func(t *testing.T) {
+		failures := func() []bool {
+			fsys := newFS(Fault{Op: "stat", Err: errBoom, Probability: 0.5})
+			var res []bool
+			for i := 0; i < 32; i++ {
+				_, err := fs.Stat(fsys, "afile.txt")
+				res = append(res, err != nil)
+			}
+			return res
+		}
+		first := failures()
+		assert.Equal(t, first, failures())
+		assert.Contains(t, first, true)
+		assert.Contains(t, first, false)
+	})
+
+	t.Run("short reads and writes", func(t *testing.T) {
+		fsys := newFS(Fault{Op: "read", Limit: 3}, Fault{Op: "write", Limit: 2, Times: 1})
+
+		f, err := fsys.Open("afile.txt")
+		assert.NoError(t, err)
+		buf := make([]byte, 10)
+		n, err := f.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, "cia", string(buf[:n]))
+		assert.NoError(t, f.Close())
+
+		buf, err = fs.ReadFile(fsys, "afile.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao, mondo\n", string(buf))
+
+		w, err := writefs.OpenFile(fsys, "afile.txt", os.O_WRONLY|os.O_TRUNC, 0)
+		assert.NoError(t, err)
+		n, err = w.Write([]byte("miao\n"))
+		assert.Equal(t, 2, n)
+		assert.True(t, errors.Is(err, io.ErrShortWrite))
+		n, err = w.Write([]byte("ao\n"))
+		assert.Equal(t, 3, n)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+
+		buf, err = fs.ReadFile(fsys, "afile.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "miao\n", string(buf))
+	})
+
+	t.Run("disconnect mid-stream", func(t *testing.T) {
+		fsys := newFS(Fault{Op: "read", Pattern: "afile.txt", After: 6, Err: ErrDisconnected})
+
+		f, err := fsys.Open("afile.txt")
+		assert.NoError(t, err)
+		buf := make([]byte, 4)
+		n, err := f.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao", string(buf[:n]))
+		n, err = f.Read(buf)
+		assert.Equal(t, ", ", string(buf[:n]))
+		assert.True(t, errors.Is(err, ErrDisconnected))
+
+		_, err = f.Read(buf)
+		assert.True(t, errors.Is(err, ErrDisconnected))
+		_, err = f.Stat()
+		assert.True(t, errors.Is(err, ErrDisconnected))
+		assert.True(t, errors.Is(f.Close(), ErrDisconnected))
+		assert.Len(t, fsys.Log(), 1)
+
+		_, err = fs.ReadFile(fsys, "afile.txt")
+		assert.True(t, errors.Is(err, ErrDisconnected))
+		_, err = fs.ReadFile(fsys, "adir/bfile.txt")
+		assert.NoError(t, err)
+	})
+
+	t.Run("faults apply to random access writes", func(t *testing.T) {
+		fsys := newFS(Fault{Op: "write", Err: errBoom})
+		f, err := writefs.OpenFile(fsys, "afile.txt", os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		w, ok := f.(io.WriterAt)
+		assert.True(t, ok)
+		_, err = w.WriteAt([]byte("x"), 2)
+		assert.True(t, errors.Is(err, errBoom))
+		assert.NoError(t, f.Close())
+	})
+
+	t.Run("files opened for reading can be served by http.FS", func(t *testing.T) {
+		fsys := newFS(Fault{Op: "seek", Err: errBoom})
+		f, err := http.FS(fsys).Open("/afile.txt")
+		assert.NoError(t, err)
+		_, err = f.Seek(0, io.SeekEnd)
+		assert.True(t, errors.Is(err, errBoom))
+		assert.NoError(t, f.Close())
+	})
+
+	t.Run("delay operations", func(t *testing.T) {
+		fsys := newFS(Fault{Op: "stat", Latency: 20 * time.Millisecond})
+		start := time.Now()
+		_, err := fs.Stat(fsys, "afile.txt")
+		assert.NoError(t, err)
+		assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	})
+
+	t.Run("Sub shares faults and log", func(t *testing.T) {
+		fsys := newFS(Fault{Op: "open", Pattern: "bfile.txt", Err: errBoom})
+		sub, err := fs.Sub(fsys, "adir")
+		assert.NoError(t, err)
+		_, err = sub.Open("bfile.txt")
+		assert.True(t, errors.Is(err, errBoom))
+		_, err = writefs.WriteFile(sub, "cfile.txt", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.Len(t, fsys.Log(), 1)
+	})
+}
@@ -3,10 +3,10 @@ module github.com/parro-it/vs
 go 1.16
 
 require (
-	github.com/mikkeloscar/sshconfig v0.1.0 // indirect
+	github.com/mikkeloscar/sshconfig v0.1.0
 	github.com/pkg/sftp v1.12.0
 	github.com/stretchr/testify v1.7.0
-	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83 // indirect
+	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
 )
 
 replace github.com/parro-it/sshconfig => ../sshconfig
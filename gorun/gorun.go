@@ -0,0 +1,469 @@
+// Package gorun ships Go programs to the nodes an
+// sshfs.SSHFS instance is connected to, and runs them there.
+//
+// Programs are cross compiled for the platform of the
+// remote node, detected with uname, and uploaded in a
+// content addressed cache directory, so that the same
+// binary is uploaded only once.
+//
+//	fsys, _ := sshfs.ConnectFromConfig("/home/user", "node1")
+//	runner := &gorun.Runner{FS: fsys}
+//	err := runner.Run(ctx, gorun.Program{Package: "./cmd/fastcopy"},
+//		os.Stdout, os.Stderr, "src", "dst")
+package gorun
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/parro-it/vs/sshfs"
+	"github.com/parro-it/vs/writefs"
+)
+
+// DefaultCacheDir is the cache directory used by
+// runners that don't specify one.
+const DefaultCacheDir = ".gorun"
+
+// Program describes a Go program to run remotely.
+type Program struct {
+	// Package is the import path or the directory of the
+	// main package to build. It is ignored if Binary is set.
+	Package string
+	// Dir is the directory in which go build is run.
+	// If empty, the current directory is used.
+	Dir string
+	// BuildFlags are additional flags passed to go build.
+	BuildFlags []string
+	// Binary is the local path of a prebuilt binary.
+	// It must be built for the platform of the remote node.
+	Binary string
+}
+
+// Platform identifies the operating system
+// and architecture of a node, using GOOS and GOARCH values.
+type Platform struct {
+	GOOS   string
+	GOARCH string
+}
+
+func (p Platform) String() string {
+	return p.GOOS + "/" + p.GOARCH
+}
+
+var unameOS = map[string]string{
+	"linux":   "linux",
+	"darwin":  "darwin",
+	"freebsd": "freebsd",
+	"openbsd": "openbsd",
+	"netbsd":  "netbsd",
+}
+
+var unameArch = map[string]string{
+	"x86_64":  "amd64",
+	"amd64":   "amd64",
+	"i386":    "386",
+	"i686":    "386",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"armv6l":  "arm",
+	"armv7l":  "arm",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+	"riscv64": "riscv64",
+}
+
+// ParsePlatform returns the Platform described
+// by the output of `uname -sm`.
+func ParsePlatform(uname string) (Platform, error) {
+	fields := strings.Fields(uname)
+	if len(fields) != 2 {
+		return Platform{}, fmt.Errorf("unexpected uname output `%s`", uname)
+	}
+	goos, ok := unameOS[strings.ToLower(fields[0])]
+	if !ok {
+		return Platform{}, fmt.Errorf("unsupported operating system `%s`", fields[0])
+	}
+	goarch, ok := unameArch[strings.ToLower(fields[1])]
+	if !ok {
+		return Platform{}, fmt.Errorf("unsupported architecture `%s`", fields[1])
+	}
+	return Platform{GOOS: goos, GOARCH: goarch}, nil
+}
+
+// Cleanup is the policy used to remove
+// binaries from the remote cache directory.
+type Cleanup int
+
+const (
+	// KeepAll never removes binaries from the cache.
+	KeepAll Cleanup = iota
+	// RemoveAfterRun removes the binaries uploaded by Run
+	// once the last program the Runner runs with them exits.
+	// Binaries found in the cache, e.g. uploaded by other
+	// runners, are never removed.
+	RemoveAfterRun
+	// KeepRecent removes the least recently uploaded
+	// binaries when the cache contains more than Runner.Keep of them.
+	KeepRecent
+)
+
+// Runner builds, uploads and runs Go programs
+// on the node FS is connected to.
+type Runner struct {
+	// FS is the file system of the remote node.
+	FS *sshfs.SSHFS
+	// CacheDir is the directory, relative to the root of FS,
+	// where binaries are uploaded. It defaults to DefaultCacheDir.
+	CacheDir string
+	// Cleanup is the policy used to remove binaries from CacheDir.
+	Cleanup Cleanup
+	// Keep is the number of binaries kept
+	// by the KeepRecent cleanup policy.
+	Keep int
+
+	lock     sync.Mutex
+	platform *Platform
+
+	// refsLock guards refs, and is held while binaries
+	// are checked, uploaded and removed, so that a binary
+	// is not removed while a run is about to use it.
+	refsLock sync.Mutex
+	// refs are the binaries used by the running
+	// programs, for the RemoveAfterRun policy.
+	refs map[string]*binaryRef
+}
+
+// binaryRef counts the runs using a binary, and
+// records whether one of them uploaded it.
+type binaryRef struct {
+	runs     int
+	uploaded bool
+}
+
+func (r *Runner) cacheDir() string {
+	if r.CacheDir == "" {
+		return DefaultCacheDir
+	}
+	return r.CacheDir
+}
+
+// Platform returns the platform of the remote node.
+// It is detected once using uname, then cached.
+func (r *Runner) Platform(ctx context.Context) (Platform, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.platform != nil {
+		return *r.platform, nil
+	}
+	out, err := r.FS.CommandContext(ctx, "uname", "-sm").Output()
+	if err != nil {
+		return Platform{}, fmt.Errorf("cannot detect remote platform: %w", err)
+	}
+	platform, err := ParsePlatform(string(out))
+	if err != nil {
+		return Platform{}, err
+	}
+	r.platform = &platform
+	return platform, nil
+}
+
+// Build cross compiles prog for platform and returns the
+// path of the built binary. The binary is created in a
+// temporary directory, that should be removed calling
+// the returned cleanup function.
+func Build(ctx context.Context, prog Program, platform Platform) (binary string, cleanup func(), err error) {
+	tmpDir, err := ioutil.TempDir("", "gorun")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+
+	binary = filepath.Join(tmpDir, "main")
+	args := append([]string{"build", "-o", binary}, prog.BuildFlags...)
+	args = append(args, prog.Package)
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = prog.Dir
+	cmd.Env = append(os.Environ(),
+		"GOOS="+platform.GOOS,
+		"GOARCH="+platform.GOARCH,
+		"CGO_ENABLED=0",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("cannot build %s for %s: %w\n%s", prog.Package, platform, err, out)
+	}
+	return binary, cleanup, nil
+}
+
+// Deploy uploads the binary of prog to the cache directory
+// of the remote node, building it if needed, and returns
+// its path relative to the root of FS.
+// Binaries are named after the SHA-256 of their content:
+// a binary already present in the cache is not uploaded
+// again, unless its remote checksum differs, e.g. because
+// it was corrupted.
+func (r *Runner) Deploy(ctx context.Context, prog Program) (string, error) {
+	binary, cleanup, err := r.binary(ctx, prog)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	name, err := r.cacheName(binary)
+	if err != nil {
+		return "", err
+	}
+	r.refsLock.Lock()
+	defer r.refsLock.Unlock()
+	if _, err := r.deploy(binary, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// binary returns the local path of the binary of prog,
+// building it if needed, and a function that removes it
+// if it was built.
+func (r *Runner) binary(ctx context.Context, prog Program) (string, func(), error) {
+	if prog.Binary != "" {
+		return prog.Binary, func() {}, nil
+	}
+	platform, err := r.Platform(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	return Build(ctx, prog, platform)
+}
+
+// cacheName returns the name of binary in the cache directory.
+func (r *Runner) cacheName(binary string) (string, error) {
+	sum, err := hashFile(binary)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(r.cacheDir(), sum), nil
+}
+
+// deploy uploads binary to the named file of the cache
+// directory, unless it's already there, and reports
+// whether it was uploaded. It must be called
+// holding refsLock.
+func (r *Runner) deploy(binary, name string) (bool, error) {
+	uploaded := false
+	remote, err := writefs.Hash(r.FS, name, writefs.SHA256)
+	if err != nil || hex.EncodeToString(remote) != path.Base(name) {
+		if err := r.upload(binary, name); err != nil {
+			return false, err
+		}
+		uploaded = true
+	}
+
+	if r.Cleanup == KeepRecent {
+		if err := Prune(r.FS, r.cacheDir(), r.Keep, path.Base(name)); err != nil {
+			return false, err
+		}
+	}
+	return uploaded, nil
+}
+
+// upload uploads binary to the named file. The binary is
+// written to a temporary file, that is made executable
+// and then renamed, so that a partially uploaded binary
+// is never run.
+func (r *Runner) upload(binary, name string) error {
+	err := writefs.MkDir(r.FS, r.cacheDir(), fs.FileMode(0755))
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	src, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path.Join(path.Dir(name), "."+path.Base(name)+".tmp")
+	dst, err := writefs.OpenFile(r.FS, tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = r.FS.Chmod(tmp, fs.FileMode(0755))
+	}
+	if err == nil {
+		err = writefs.Rename(r.FS, tmp, name)
+	}
+	if err != nil {
+		writefs.Remove(r.FS, tmp)
+		return err
+	}
+	return nil
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Command deploys prog and returns the sshfs.Cmd
+// to run it with the given arguments. The command
+// runs in the root directory of FS.
+// The Cleanup policy RemoveAfterRun is not applied
+// to commands returned by Command.
+func (r *Runner) Command(ctx context.Context, prog Program, arg ...string) (*sshfs.Cmd, error) {
+	name, err := r.Deploy(ctx, prog)
+	if err != nil {
+		return nil, err
+	}
+	return r.FS.CommandContext(ctx, path.Join(r.FS.Root(), name), arg...), nil
+}
+
+// Run deploys prog and runs it with the given arguments,
+// streaming its standard output and error to stdout and stderr.
+func (r *Runner) Run(ctx context.Context, prog Program, stdout, stderr io.Writer, arg ...string) error {
+	binary, cleanup, err := r.binary(ctx, prog)
+	if err != nil {
+		return err
+	}
+	name, err := r.cacheName(binary)
+	if err == nil {
+		err = r.acquire(binary, name)
+	}
+	cleanup()
+	if err != nil {
+		return err
+	}
+
+	cmd := r.FS.CommandContext(ctx, path.Join(r.FS.Root(), name), arg...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+
+	if rmErr := r.release(name); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// acquire deploys binary to the named file of the
+// cache directory, and counts the run using it.
+func (r *Runner) acquire(binary, name string) error {
+	r.refsLock.Lock()
+	defer r.refsLock.Unlock()
+
+	uploaded, err := r.deploy(binary, name)
+	if err != nil || r.Cleanup != RemoveAfterRun {
+		return err
+	}
+	if r.refs == nil {
+		r.refs = map[string]*binaryRef{}
+	}
+	ref, ok := r.refs[name]
+	if !ok {
+		ref = &binaryRef{}
+		r.refs[name] = ref
+	}
+	ref.runs++
+	ref.uploaded = ref.uploaded || uploaded
+	return nil
+}
+
+// release counts the end of a run using the named
+// binary, and removes the binary if it was the last
+// run using it and the binary was uploaded by a run.
+func (r *Runner) release(name string) error {
+	if r.Cleanup != RemoveAfterRun {
+		return nil
+	}
+	r.refsLock.Lock()
+	defer r.refsLock.Unlock()
+
+	ref := r.refs[name]
+	ref.runs--
+	if ref.runs > 0 {
+		return nil
+	}
+	delete(r.refs, name)
+	if !ref.uploaded {
+		return nil
+	}
+	return writefs.Remove(r.FS, name)
+}
+
+// Prune removes from dir all regular files but the keep
+// most recently modified ones. The file named current is never
+// removed, nor are the temporary files of uploads in progress,
+// whose names end with ".tmp".
+func Prune(fsys fs.FS, dir string, keep int, current string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	type cached struct {
+		name string
+		info fs.FileInfo
+	}
+	var files []cached
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == current || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, cached{entry.Name(), info})
+	}
+
+	if current != "" {
+		// current counts as one of the kept files
+		keep--
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	if len(files) <= keep {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].info.ModTime().After(files[j].info.ModTime())
+	})
+	for _, file := range files[keep:] {
+		err := writefs.Remove(fsys, path.Join(dir, file.name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
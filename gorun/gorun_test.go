@@ -0,0 +1,164 @@
+package gorun
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"path"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/parro-it/vs/memfs"
+	"github.com/parro-it/vs/sshfs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlatform(t *testing.T) {
+	platform, err := ParsePlatform("Linux x86_64\n")
+	assert.NoError(t, err)
+	assert.Equal(t, Platform{GOOS: "linux", GOARCH: "amd64"}, platform)
+	assert.Equal(t, "linux/amd64", platform.String())
+
+	platform, err = ParsePlatform("Darwin arm64")
+	assert.NoError(t, err)
+	assert.Equal(t, Platform{GOOS: "darwin", GOARCH: "arm64"}, platform)
+
+	_, err = ParsePlatform("Plan9 x86_64")
+	assert.Error(t, err)
+
+	_, err = ParsePlatform("")
+	assert.Error(t, err)
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	fsys := memfs.New()
+	fsys.MapFS["cache"] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+	fsys.MapFS["cache/old"] = &fstest.MapFile{ModTime: now.Add(-3 * time.Hour)}
+	fsys.MapFS["cache/older"] = &fstest.MapFile{ModTime: now.Add(-4 * time.Hour)}
+	fsys.MapFS["cache/recent"] = &fstest.MapFile{ModTime: now.Add(-time.Hour)}
+	fsys.MapFS["cache/current"] = &fstest.MapFile{ModTime: now.Add(-5 * time.Hour)}
+	fsys.MapFS["cache/.uploading.tmp"] = &fstest.MapFile{ModTime: now.Add(-6 * time.Hour)}
+
+	err := Prune(fsys, "cache", 2, "current")
+	assert.NoError(t, err)
+
+	entries, err := fs.ReadDir(fsys, "cache")
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{".uploading.tmp", "current", "recent"}, names)
+}
+
+func TestRunner(t *testing.T) {
+	fsys, err := sshfs.ConnectFromConfig("/var/fixtures", "fakehost")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fsys.Disconnect()
+
+	ctx := context.Background()
+	hello := Program{Package: "./testdata/hello"}
+
+	t.Run("detect remote platform", func(t *testing.T) {
+		runner := &Runner{FS: fsys}
+		platform, err := runner.Platform(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "linux", platform.GOOS)
+	})
+
+	t.Run("deploy binaries in content addressed cache", func(t *testing.T) {
+		runner := &Runner{FS: fsys, CacheDir: ".gorun-test"}
+		name, err := runner.Deploy(ctx, hello)
+		assert.NoError(t, err)
+		assert.Regexp(t, `^\.gorun-test/[0-9a-f]{64}$`, name)
+
+		info, err := fs.Stat(fsys, name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, fs.FileMode(0755), info.Mode().Perm())
+		}
+
+		again, err := runner.Deploy(ctx, hello)
+		assert.NoError(t, err)
+		assert.Equal(t, name, again)
+
+		entries, err := fs.ReadDir(fsys, ".gorun-test")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		t.Run("upload again corrupted binaries", func(t *testing.T) {
+			info, err := fs.Stat(fsys, name)
+			assert.NoError(t, err)
+			_, err = writefs.WriteFile(fsys, name, make([]byte, info.Size()))
+			assert.NoError(t, err)
+
+			again, err := runner.Deploy(ctx, hello)
+			assert.NoError(t, err)
+			assert.Equal(t, name, again)
+			sum, err := writefs.Hash(fsys, name, writefs.SHA256)
+			assert.NoError(t, err)
+			assert.Equal(t, path.Base(name), hex.EncodeToString(sum))
+		})
+
+		err = fsys.Command("rm", "-rf", ".gorun-test").Run()
+		assert.NoError(t, err)
+	})
+
+	t.Run("run programs streaming their output", func(t *testing.T) {
+		runner := &Runner{FS: fsys, CacheDir: ".gorun-test", Cleanup: RemoveAfterRun}
+		var stdout, stderr bytes.Buffer
+		err := runner.Run(ctx, hello, &stdout, &stderr, "remote", "world")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello remote world\n", stdout.String())
+		assert.Equal(t, "bye\n", stderr.String())
+
+		entries, err := fs.ReadDir(fsys, ".gorun-test")
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		t.Run("removing only the binaries they uploaded", func(t *testing.T) {
+			name, err := (&Runner{FS: fsys, CacheDir: ".gorun-test"}).Deploy(ctx, hello)
+			assert.NoError(t, err)
+			err = runner.Run(ctx, hello, &stdout, &stderr)
+			assert.NoError(t, err)
+			_, err = fs.Stat(fsys, name)
+			assert.NoError(t, err)
+		})
+
+		t.Run("once the last run using them exits", func(t *testing.T) {
+			assert.NoError(t, fsys.Command("rm", "-rf", ".gorun-test").Run())
+			binary, cleanup, err := runner.binary(ctx, hello)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer cleanup()
+			name, err := runner.cacheName(binary)
+			assert.NoError(t, err)
+
+			assert.NoError(t, runner.acquire(binary, name))
+			assert.NoError(t, runner.acquire(binary, name))
+			assert.NoError(t, runner.release(name))
+			_, err = fs.Stat(fsys, name)
+			assert.NoError(t, err)
+			assert.NoError(t, runner.release(name))
+			_, err = fs.Stat(fsys, name)
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+		})
+
+		err = fsys.Command("rm", "-rf", ".gorun-test").Run()
+		assert.NoError(t, err)
+	})
+
+	t.Run("return build errors", func(t *testing.T) {
+		runner := &Runner{FS: fsys}
+		_, err := runner.Deploy(ctx, Program{Package: "./testdata/notexists"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "cannot build ./testdata/notexists")
+	})
+}
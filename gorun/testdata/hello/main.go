@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	fmt.Printf("hello %s\n", strings.Join(os.Args[1:], " "))
+	fmt.Fprintln(os.Stderr, "bye")
+}
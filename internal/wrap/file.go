@@ -0,0 +1,165 @@
+// Package wrap provides the helpers shared by the
+// file systems that wrap other file systems, to
+// intercept their operations.
+package wrap
+
+import (
+	"io"
+	"io/fs"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// Op is an operation on an open file,
+// named after the method that runs it.
+type Op string
+
+// The operations on open files.
+const (
+	Read     Op = "Read"
+	ReadAt   Op = "ReadAt"
+	Write    Op = "Write"
+	WriteAt  Op = "WriteAt"
+	Seek     Op = "Seek"
+	Truncate Op = "Truncate"
+	ReadDir  Op = "ReadDir"
+	Stat     Op = "Stat"
+	Close    Op = "Close"
+)
+
+// Hooks intercept the operations on a file wrapped by NewFile.
+type Hooks interface {
+	// Transfer runs op, that reads or writes buf
+	// with do, and returns the results of do.
+	Transfer(op Op, buf []byte, do func(buf []byte) (int, error)) (int, error)
+	// Call runs op, that transfers no bytes,
+	// with do, and returns the error of do.
+	Call(op Op, do func() error) error
+}
+
+// File is an open file whose
+// operations are intercepted by hooks.
+type File struct {
+	hooks Hooks
+	name  string
+	f     fs.File
+}
+
+type truncaterFile interface {
+	Truncate(size int64) error
+}
+
+const (
+	hasSeek = 1 << iota
+	hasReadAt
+	hasWriteAt
+	hasTruncate
+	hasReadDir
+)
+
+// NewFile wraps f, the named file, so that its operations
+// are intercepted by hooks. The returned file implements
+// io.Seeker, io.ReaderAt, io.WriterAt, fs.ReadDirFile and
+// Truncate only when f implements them, so that they
+// can still be detected by type assertions.
+func NewFile(f fs.File, name string, hooks Hooks) writefs.FileWriter {
+	wrapped := &File{hooks: hooks, name: name, f: f}
+
+	mask := 0
+	if _, ok := f.(io.Seeker); ok {
+		mask |= hasSeek
+	}
+	if _, ok := f.(io.ReaderAt); ok {
+		mask |= hasReadAt
+	}
+	if _, ok := f.(io.WriterAt); ok {
+		mask |= hasWriteAt
+	}
+	if _, ok := f.(truncaterFile); ok {
+		mask |= hasTruncate
+	}
+	if _, ok := f.(fs.ReadDirFile); ok {
+		mask |= hasReadDir
+	}
+	return withMethods(wrapped, mask)
+}
+
+// Read implements io.Reader
+func (f *File) Read(buf []byte) (int, error) {
+	return f.hooks.Transfer(Read, buf, f.f.Read)
+}
+
+// Write implements io.Writer
+func (f *File) Write(buf []byte) (int, error) {
+	w, ok := f.f.(io.Writer)
+	if !ok {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	return f.hooks.Transfer(Write, buf, w.Write)
+}
+
+// Stat implements fs.File
+func (f *File) Stat() (fs.FileInfo, error) {
+	var info fs.FileInfo
+	err := f.hooks.Call(Stat, func() (err error) {
+		info, err = f.f.Stat()
+		return err
+	})
+	return info, err
+}
+
+// Close implements fs.File
+func (f *File) Close() error {
+	return f.hooks.Call(Close, f.f.Close)
+}
+
+type seeker struct{ f *File }
+
+// Seek implements io.Seeker
+func (s seeker) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	err := s.f.hooks.Call(Seek, func() (err error) {
+		pos, err = s.f.f.(io.Seeker).Seek(offset, whence)
+		return err
+	})
+	return pos, err
+}
+
+type readerAt struct{ f *File }
+
+// ReadAt implements io.ReaderAt
+func (r readerAt) ReadAt(buf []byte, off int64) (int, error) {
+	return r.f.hooks.Transfer(ReadAt, buf, func(buf []byte) (int, error) {
+		return r.f.f.(io.ReaderAt).ReadAt(buf, off)
+	})
+}
+
+type writerAt struct{ f *File }
+
+// WriteAt implements io.WriterAt
+func (w writerAt) WriteAt(buf []byte, off int64) (int, error) {
+	return w.f.hooks.Transfer(WriteAt, buf, func(buf []byte) (int, error) {
+		return w.f.f.(io.WriterAt).WriteAt(buf, off)
+	})
+}
+
+type truncater struct{ f *File }
+
+// Truncate changes the size of the file.
+func (t truncater) Truncate(size int64) error {
+	return t.f.hooks.Call(Truncate, func() error {
+		return t.f.f.(truncaterFile).Truncate(size)
+	})
+}
+
+type dirReader struct{ f *File }
+
+// ReadDir implements fs.ReadDirFile
+func (d dirReader) ReadDir(n int) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	err := d.f.hooks.Call(ReadDir, func() (err error) {
+		entries, err = d.f.f.(fs.ReadDirFile).ReadDir(n)
+		return err
+	})
+	return entries, err
+}
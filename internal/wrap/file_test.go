@@ -0,0 +1,91 @@
+package wrap
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder are Hooks that record the operations.
+type recorder struct {
+	ops []Op
+}
+
+func (r *recorder) Transfer(op Op, buf []byte, do func(buf []byte) (int, error)) (int, error) {
+	r.ops = append(r.ops, op)
+	return do(buf)
+}
+
+func (r *recorder) Call(op Op, do func() error) error {
+	r.ops = append(r.ops, op)
+	return do()
+}
+
+// plainFile is a file without optional methods.
+type plainFile struct {
+	fs.File
+}
+
+func TestFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"afile": &fstest.MapFile{Data: []byte("ciao, mondo\n")},
+	}
+
+	t.Run("preserves the optional methods of the file", func(t *testing.T) {
+		f, err := fsys.Open("afile")
+		assert.NoError(t, err)
+		hooks := &recorder{}
+		wrapped := NewFile(f, "afile", hooks)
+
+		_, isSeeker := wrapped.(io.Seeker)
+		assert.True(t, isSeeker)
+		r, isReaderAt := wrapped.(io.ReaderAt)
+		assert.True(t, isReaderAt)
+		_, isWriterAt := wrapped.(io.WriterAt)
+		assert.False(t, isWriterAt)
+		_, isDir := wrapped.(fs.ReadDirFile)
+		assert.False(t, isDir)
+
+		buf := make([]byte, 5)
+		n, err := r.ReadAt(buf, 6)
+		assert.NoError(t, err)
+		assert.Equal(t, "mondo", string(buf[:n]))
+		assert.NoError(t, wrapped.Close())
+		assert.Equal(t, []Op{ReadAt, Close}, hooks.ops)
+	})
+
+	t.Run("preserves the optional methods of directories", func(t *testing.T) {
+		f, err := fsys.Open(".")
+		assert.NoError(t, err)
+		hooks := &recorder{}
+		wrapped := NewFile(f, ".", hooks)
+
+		dir, isDir := wrapped.(fs.ReadDirFile)
+		if assert.True(t, isDir) {
+			entries, err := dir.ReadDir(-1)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+		}
+		assert.NoError(t, wrapped.Close())
+		assert.Equal(t, []Op{ReadDir, Close}, hooks.ops)
+	})
+
+	t.Run("doesn't add optional methods", func(t *testing.T) {
+		f, err := fsys.Open("afile")
+		assert.NoError(t, err)
+		wrapped := NewFile(plainFile{f}, "afile", &recorder{})
+
+		_, isSeeker := wrapped.(io.Seeker)
+		assert.False(t, isSeeker)
+		_, isReaderAt := wrapped.(io.ReaderAt)
+		assert.False(t, isReaderAt)
+
+		_, err = wrapped.Write([]byte("ciao"))
+		assert.True(t, errors.Is(err, fs.ErrPermission))
+		assert.NoError(t, wrapped.Close())
+	})
+}
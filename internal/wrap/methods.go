@@ -0,0 +1,217 @@
+package wrap
+
+import "github.com/parro-it/vs/writefs"
+
+// withMethods returns f with the
+// optional methods selected by mask.
+func withMethods(f *File, mask int) writefs.FileWriter {
+	switch mask {
+	case 0:
+		return f
+	case hasSeek:
+		return struct {
+			*File
+			seeker
+		}{f, seeker{f}}
+	case hasReadAt:
+		return struct {
+			*File
+			readerAt
+		}{f, readerAt{f}}
+	case hasSeek | hasReadAt:
+		return struct {
+			*File
+			seeker
+			readerAt
+		}{f, seeker{f}, readerAt{f}}
+	case hasWriteAt:
+		return struct {
+			*File
+			writerAt
+		}{f, writerAt{f}}
+	case hasSeek | hasWriteAt:
+		return struct {
+			*File
+			seeker
+			writerAt
+		}{f, seeker{f}, writerAt{f}}
+	case hasReadAt | hasWriteAt:
+		return struct {
+			*File
+			readerAt
+			writerAt
+		}{f, readerAt{f}, writerAt{f}}
+	case hasSeek | hasReadAt | hasWriteAt:
+		return struct {
+			*File
+			seeker
+			readerAt
+			writerAt
+		}{f, seeker{f}, readerAt{f}, writerAt{f}}
+	case hasTruncate:
+		return struct {
+			*File
+			truncater
+		}{f, truncater{f}}
+	case hasSeek | hasTruncate:
+		return struct {
+			*File
+			seeker
+			truncater
+		}{f, seeker{f}, truncater{f}}
+	case hasReadAt | hasTruncate:
+		return struct {
+			*File
+			readerAt
+			truncater
+		}{f, readerAt{f}, truncater{f}}
+	case hasSeek | hasReadAt | hasTruncate:
+		return struct {
+			*File
+			seeker
+			readerAt
+			truncater
+		}{f, seeker{f}, readerAt{f}, truncater{f}}
+	case hasWriteAt | hasTruncate:
+		return struct {
+			*File
+			writerAt
+			truncater
+		}{f, writerAt{f}, truncater{f}}
+	case hasSeek | hasWriteAt | hasTruncate:
+		return struct {
+			*File
+			seeker
+			writerAt
+			truncater
+		}{f, seeker{f}, writerAt{f}, truncater{f}}
+	case hasReadAt | hasWriteAt | hasTruncate:
+		return struct {
+			*File
+			readerAt
+			writerAt
+			truncater
+		}{f, readerAt{f}, writerAt{f}, truncater{f}}
+	case hasSeek | hasReadAt | hasWriteAt | hasTruncate:
+		return struct {
+			*File
+			seeker
+			readerAt
+			writerAt
+			truncater
+		}{f, seeker{f}, readerAt{f}, writerAt{f}, truncater{f}}
+	case hasReadDir:
+		return struct {
+			*File
+			dirReader
+		}{f, dirReader{f}}
+	case hasSeek | hasReadDir:
+		return struct {
+			*File
+			seeker
+			dirReader
+		}{f, seeker{f}, dirReader{f}}
+	case hasReadAt | hasReadDir:
+		return struct {
+			*File
+			readerAt
+			dirReader
+		}{f, readerAt{f}, dirReader{f}}
+	case hasSeek | hasReadAt | hasReadDir:
+		return struct {
+			*File
+			seeker
+			readerAt
+			dirReader
+		}{f, seeker{f}, readerAt{f}, dirReader{f}}
+	case hasWriteAt | hasReadDir:
+		return struct {
+			*File
+			writerAt
+			dirReader
+		}{f, writerAt{f}, dirReader{f}}
+	case hasSeek | hasWriteAt | hasReadDir:
+		return struct {
+			*File
+			seeker
+			writerAt
+			dirReader
+		}{f, seeker{f}, writerAt{f}, dirReader{f}}
+	case hasReadAt | hasWriteAt | hasReadDir:
+		return struct {
+			*File
+			readerAt
+			writerAt
+			dirReader
+		}{f, readerAt{f}, writerAt{f}, dirReader{f}}
+	case hasSeek | hasReadAt | hasWriteAt | hasReadDir:
+		return struct {
+			*File
+			seeker
+			readerAt
+			writerAt
+			dirReader
+		}{f, seeker{f}, readerAt{f}, writerAt{f}, dirReader{f}}
+	case hasTruncate | hasReadDir:
+		return struct {
+			*File
+			truncater
+			dirReader
+		}{f, truncater{f}, dirReader{f}}
+	case hasSeek | hasTruncate | hasReadDir:
+		return struct {
+			*File
+			seeker
+			truncater
+			dirReader
+		}{f, seeker{f}, truncater{f}, dirReader{f}}
+	case hasReadAt | hasTruncate | hasReadDir:
+		return struct {
+			*File
+			readerAt
+			truncater
+			dirReader
+		}{f, readerAt{f}, truncater{f}, dirReader{f}}
+	case hasSeek | hasReadAt | hasTruncate | hasReadDir:
+		return struct {
+			*File
+			seeker
+			readerAt
+			truncater
+			dirReader
+		}{f, seeker{f}, readerAt{f}, truncater{f}, dirReader{f}}
+	case hasWriteAt | hasTruncate | hasReadDir:
+		return struct {
+			*File
+			writerAt
+			truncater
+			dirReader
+		}{f, writerAt{f}, truncater{f}, dirReader{f}}
+	case hasSeek | hasWriteAt | hasTruncate | hasReadDir:
+		return struct {
+			*File
+			seeker
+			writerAt
+			truncater
+			dirReader
+		}{f, seeker{f}, writerAt{f}, truncater{f}, dirReader{f}}
+	case hasReadAt | hasWriteAt | hasTruncate | hasReadDir:
+		return struct {
+			*File
+			readerAt
+			writerAt
+			truncater
+			dirReader
+		}{f, readerAt{f}, writerAt{f}, truncater{f}, dirReader{f}}
+	case hasSeek | hasReadAt | hasWriteAt | hasTruncate | hasReadDir:
+		return struct {
+			*File
+			seeker
+			readerAt
+			writerAt
+			truncater
+			dirReader
+		}{f, seeker{f}, readerAt{f}, writerAt{f}, truncater{f}, dirReader{f}}
+	}
+	panic("unknown methods mask")
+}
@@ -0,0 +1,36 @@
+package wrap
+
+import (
+	"context"
+	"io/fs"
+	"time"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// Sleep waits for d or for ctx to be done,
+// and returns the error of ctx in the latter case.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Watch watches the named file of wrapfs, the file system
+// wrapped by fsys. When wrapfs doesn't implement
+// writefs.WatchFS, the file is polled through fsys, so
+// that the scans go through the wrapper too.
+func Watch(ctx context.Context, fsys fs.FS, wrapfs fs.FS, name string, recursive bool) (<-chan writefs.Event, error) {
+	if _, ok := wrapfs.(writefs.WatchFS); !ok {
+		return writefs.PollWatch(ctx, fsys, name, recursive, writefs.DefaultPollInterval)
+	}
+	return writefs.Watch(ctx, wrapfs, name, recursive)
+}
@@ -1,7 +1,10 @@
 package lazyfs
 
 import (
+	"context"
 	"io/fs"
+	"sync"
+	"time"
 
 	"github.com/parro-it/vs/writefs"
 )
@@ -9,6 +12,17 @@ import (
 type fsT struct {
 	Factory func() (fs.FS, error)
 	wrapped fs.FS
+	// lock protects wrapped and pending
+	lock sync.Mutex
+	// pending is the in-flight call to Factory
+	pending *factoryCall
+}
+
+// factoryCall is a call to Factory,
+// shared by concurrent initializations.
+type factoryCall struct {
+	done chan struct{}
+	err  error
 }
 
 // New ...
@@ -23,22 +37,95 @@ var (
 	_ fs.ReadDirFS  = &fsT{}
 	_ fs.GlobFS     = &fsT{}
 
-	_ writefs.WriteFS  = &fsT{}
-	_ writefs.RemoveFS = &fsT{}
-	_ writefs.MkDirFS  = &fsT{}
+	_ writefs.WriteFS     = &fsT{}
+	_ writefs.RemoveFS    = &fsT{}
+	_ writefs.MkDirFS     = &fsT{}
+	_ writefs.StatVFSFS   = &fsT{}
+	_ writefs.HashFS      = &fsT{}
+	_ writefs.RangeHashFS = &fsT{}
+	_ writefs.ChmodFS     = &fsT{}
+	_ writefs.ChtimesFS   = &fsT{}
+	_ writefs.WatchFS     = &fsT{}
+	_ writefs.ReadLinkFS  = &fsT{}
+	_ writefs.RenameFS    = &fsT{}
+
+	_ writefs.OpenFileContextFS = &fsT{}
+	_ writefs.MkDirContextFS    = &fsT{}
+	_ writefs.RemoveContextFS   = &fsT{}
+	_ writefs.StatContextFS     = &fsT{}
 )
 
 func (fsys *fsT) init() error {
+	return fsys.initContext(context.Background())
+}
+
+// initContext calls Factory, unless it already succeeded,
+// and waits for its result or for ctx to be done. A cancelled
+// initialization doesn't stop Factory: its result is kept
+// for the calls that follow.
+func (fsys *fsT) initContext(ctx context.Context) error {
+	fsys.lock.Lock()
 	if fsys.wrapped != nil {
+		fsys.lock.Unlock()
 		return nil
 	}
+	call := fsys.pending
+	if call == nil {
+		call = &factoryCall{done: make(chan struct{})}
+		fsys.pending = call
+		go func() {
+			f, err := fsys.Factory()
+			fsys.lock.Lock()
+			if err == nil {
+				fsys.wrapped = f
+			}
+			fsys.pending = nil
+			fsys.lock.Unlock()
+
+			call.err = err
+			close(call.done)
+		}()
+	}
+	fsys.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OpenFileContext implements writefs.OpenFileContextFS
+func (fsys *fsT) OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	if err := fsys.initContext(ctx); err != nil {
+		return nil, err
+	}
+	return writefs.OpenFileContext(ctx, fsys.wrapped, name, flag, perm)
+}
+
+// MkDirContext implements writefs.MkDirContextFS
+func (fsys *fsT) MkDirContext(ctx context.Context, name string, perm fs.FileMode) error {
+	if err := fsys.initContext(ctx); err != nil {
+		return err
+	}
+	return writefs.MkDirContext(ctx, fsys.wrapped, name, perm)
+}
 
-	f, err := fsys.Factory()
-	if err != nil {
+// RemoveContext implements writefs.RemoveContextFS
+func (fsys *fsT) RemoveContext(ctx context.Context, name string) error {
+	if err := fsys.initContext(ctx); err != nil {
 		return err
 	}
-	fsys.wrapped = f
-	return nil
+	return writefs.RemoveContext(ctx, fsys.wrapped, name)
+}
+
+// StatContext implements writefs.StatContextFS
+func (fsys *fsT) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	if err := fsys.initContext(ctx); err != nil {
+		return nil, err
+	}
+	return writefs.StatContext(ctx, fsys.wrapped, name)
 }
 
 // MkDir implements writefs.MkDirFS
@@ -65,6 +152,70 @@ func (fsys *fsT) OpenFile(name string, flag int, perm fs.FileMode) (writefs.File
 	return writefs.OpenFile(fsys.wrapped, name, flag, perm)
 }
 
+// StatVFS implements writefs.StatVFSFS
+func (fsys *fsT) StatVFS(name string) (writefs.StatFSInfo, error) {
+	if err := fsys.init(); err != nil {
+		return writefs.StatFSInfo{}, err
+	}
+	return writefs.StatVFS(fsys.wrapped, name)
+}
+
+// Hash implements writefs.HashFS
+func (fsys *fsT) Hash(name string, algo string) ([]byte, error) {
+	if err := fsys.init(); err != nil {
+		return nil, err
+	}
+	return writefs.Hash(fsys.wrapped, name, algo)
+}
+
+// HashRanges implements writefs.RangeHashFS
+func (fsys *fsT) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	if err := fsys.init(); err != nil {
+		return nil, err
+	}
+	return writefs.HashRanges(fsys.wrapped, name, algo, size)
+}
+
+// Chmod implements writefs.ChmodFS
+func (fsys *fsT) Chmod(name string, mode fs.FileMode) error {
+	if err := fsys.init(); err != nil {
+		return err
+	}
+	return writefs.Chmod(fsys.wrapped, name, mode)
+}
+
+// Chtimes implements writefs.ChtimesFS
+func (fsys *fsT) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if err := fsys.init(); err != nil {
+		return err
+	}
+	return writefs.Chtimes(fsys.wrapped, name, atime, mtime)
+}
+
+// Rename implements writefs.RenameFS
+func (fsys *fsT) Rename(oldname string, newname string) error {
+	if err := fsys.init(); err != nil {
+		return err
+	}
+	return writefs.Rename(fsys.wrapped, oldname, newname)
+}
+
+// ReadLink implements writefs.ReadLinkFS
+func (fsys *fsT) ReadLink(name string) (string, error) {
+	if err := fsys.init(); err != nil {
+		return "", err
+	}
+	return writefs.ReadLink(fsys.wrapped, name)
+}
+
+// Watch implements writefs.WatchFS
+func (fsys *fsT) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	if err := fsys.init(); err != nil {
+		return nil, err
+	}
+	return writefs.Watch(ctx, fsys.wrapped, name, recursive)
+}
+
 // Stat implements fs.StatFS
 func (fsys *fsT) Stat(name string) (fs.FileInfo, error) {
 	if err := fsys.init(); err != nil {
@@ -86,7 +237,7 @@ func (fsys *fsT) Sub(dir string) (fs.FS, error) {
 	if err := fsys.init(); err != nil {
 		return nil, err
 	}
-	return fs.Sub(fsys.wrapped, dir)
+	return writefs.Sub(fsys.wrapped, dir)
 }
 
 // Open implements fs.FS
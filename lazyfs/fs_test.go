@@ -1,12 +1,16 @@
 package lazyfs
 
 import (
+	"context"
+	"errors"
 	"io/fs"
 	"testing"
+	"time"
 
 	"github.com/parro-it/vs/memfs"
 	"github.com/parro-it/vs/writefs"
 	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestLazyFS(t *testing.T) {
@@ -17,6 +21,34 @@ func TestLazyFS(t *testing.T) {
 		t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys.(writefs.WriteFS)))
 	})
 
+	t.Run("Sub returns a writable fs", writefstest.TestSub(New(func() (fs.FS, error) {
+		return memfs.New(), nil
+	}), "adir"))
+
+	t.Run("context operations cancel a slow factory", func(t *testing.T) {
+		release := make(chan struct{})
+		calls := 0
+		fsys := New(func() (fs.FS, error) {
+			calls++
+			<-release
+			return memfs.New(), nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := writefs.MkDirContext(ctx, fsys, "adir", fs.FileMode(0755))
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+		close(release)
+		ctx = context.Background()
+		assert.NoError(t, writefs.MkDirContext(ctx, fsys, "adir", fs.FileMode(0755)))
+		info, err := writefs.StatContext(ctx, fsys, "adir")
+		assert.NoError(t, err)
+		assert.True(t, info.IsDir())
+		assert.NoError(t, writefs.RemoveContext(ctx, fsys, "adir"))
+		assert.Equal(t, 1, calls)
+	})
+
 	t.Run("All methods returns factory error if any", func(t *testing.T) {
 
 	})
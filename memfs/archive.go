@@ -0,0 +1,277 @@
+package memfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"testing/fstest"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// FromFS returns a new file system with a copy of the
+// files, directories and symbolic links of src.
+// Targets of symbolic links are read with writefs.ReadLink.
+// Other kinds of files are not supported.
+// The returned file system is configured by opts.
+func FromFS(src fs.FS, opts ...Option) (*MapWriteFS, error) {
+	fsys := New(opts...)
+	err := fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		file := &fstest.MapFile{Mode: info.Mode(), ModTime: info.ModTime()}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := writefs.ReadLink(src, name)
+			if err != nil {
+				return err
+			}
+			file.Data = []byte(target)
+		case d.IsDir():
+		case d.Type().IsRegular():
+			if file.Data, err = fs.ReadFile(src, name); err != nil {
+				return err
+			}
+		default:
+			return &fs.PathError{Op: "read", Path: name, Err: errUnsupportedType(info.Mode())}
+		}
+		fsys.MapFS[name] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// FromTar returns a new file system with the files,
+// directories and symbolic links of the tar archive
+// read from r. Hard links are loaded as copies of the
+// files they link. Other kinds of entries are not supported.
+// The returned file system is configured by opts.
+func FromTar(r io.Reader, opts ...Option) (*MapWriteFS, error) {
+	fsys := New(opts...)
+	archive := tar.NewReader(r)
+	for {
+		hdr, err := archive.Next()
+		if err == io.EOF {
+			return fsys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, err := archiveName(hdr.Name)
+		if err != nil || name == "." {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		file := &fstest.MapFile{Mode: hdr.FileInfo().Mode(), ModTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeSymlink:
+			file.Data = []byte(hdr.Linkname)
+		case tar.TypeLink:
+			linked, err := archiveName(hdr.Linkname)
+			if err != nil {
+				return nil, err
+			}
+			target, ok := fsys.MapFS[linked]
+			if !ok || !target.Mode.IsRegular() {
+				return nil, &fs.PathError{Op: "link", Path: name, Err: fs.ErrNotExist}
+			}
+			file.Data = append([]byte(nil), target.Data...)
+		case tar.TypeReg, tar.TypeRegA:
+			if file.Data, err = io.ReadAll(archive); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, &fs.PathError{Op: "read", Path: name, Err: errUnsupportedType(file.Mode)}
+		}
+		fsys.MapFS[name] = file
+	}
+}
+
+// FromZip returns a new file system with the files,
+// directories and symbolic links of the zip archive
+// read from r, which has the given size.
+// Zip archives store modification times with a
+// precision of one second.
+// The returned file system is configured by opts.
+func FromZip(r io.ReaderAt, size int64, opts ...Option) (*MapWriteFS, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := New(opts...)
+	for _, entry := range archive.File {
+		name, err := archiveName(entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "." {
+			continue
+		}
+
+		file := &fstest.MapFile{Mode: entry.Mode(), ModTime: entry.Modified}
+		if file.Mode.IsRegular() || file.Mode&fs.ModeSymlink != 0 {
+			if file.Data, err = readZipEntry(entry); err != nil {
+				return nil, err
+			}
+		} else if !file.Mode.IsDir() {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: errUnsupportedType(file.Mode)}
+		}
+		fsys.MapFS[name] = file
+	}
+	return fsys, nil
+}
+
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	r, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// WriteTar writes the files, directories and symbolic
+// links of fsys to w as a tar archive in PAX format,
+// that preserves the modes and modification times
+// of the files. Targets of symbolic links are read
+// with writefs.ReadLink.
+func WriteTar(w io.Writer, fsys fs.FS) error {
+	archive := tar.NewWriter(w)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		info, target, err := archiveEntry(fsys, name, d)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, target)
+		if err != nil {
+			return &fs.PathError{Op: "write", Path: name, Err: err}
+		}
+		hdr.Name = name
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Format = tar.FormatPAX
+		if err := archive.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(archive, fsys, name)
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// WriteZip writes the files, directories and symbolic
+// links of fsys to w as a zip archive, that preserves
+// the modes of the files and their modification times,
+// with a precision of one second. Targets of symbolic
+// links are read with writefs.ReadLink.
+func WriteZip(w io.Writer, fsys fs.FS) error {
+	archive := zip.NewWriter(w)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		info, target, err := archiveEntry(fsys, name, d)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return &fs.PathError{Op: "write", Path: name, Err: err}
+		}
+		hdr.Name = name
+		if d.IsDir() {
+			hdr.Name += "/"
+			hdr.Method = zip.Store
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		entry, err := archive.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			_, err = io.WriteString(entry, target)
+			return err
+		case info.Mode().IsRegular():
+			return copyFile(entry, fsys, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// archiveEntry returns the information of the named
+// file, and its target if it's a symbolic link.
+func archiveEntry(fsys fs.FS, name string, d fs.DirEntry) (fs.FileInfo, string, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := writefs.ReadLink(fsys, name)
+		return info, target, err
+	case info.IsDir(), info.Mode().IsRegular():
+		return info, "", nil
+	}
+	return nil, "", &fs.PathError{Op: "write", Path: name, Err: errUnsupportedType(info.Mode())}
+}
+
+func copyFile(w io.Writer, fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// archiveName returns the name of the file of the
+// named archive entry, cleaned of leading "./" and
+// trailing slashes. Names that escape the root of
+// the archive are invalid.
+func archiveName(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimSuffix(name, "/"))
+	if !fs.ValidPath(cleaned) {
+		return "", &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	return cleaned, nil
+}
+
+func errUnsupportedType(mode fs.FileMode) error {
+	return fmt.Errorf("%w: unsupported file type %s", fs.ErrInvalid, mode.Type())
+}
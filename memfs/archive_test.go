@@ -0,0 +1,137 @@
+package memfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/parro-it/vs/osfs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchive(t *testing.T) {
+	mtime := time.Date(2021, 3, 1, 10, 0, 0, 123456789, time.UTC)
+	source := func() *MapWriteFS {
+		fsys := New()
+		fsys.MapFS["adir"] = &fstest.MapFile{Mode: fs.ModeDir | 0750, ModTime: mtime}
+		fsys.MapFS["adir/afile"] = &fstest.MapFile{Data: []byte("ciao\n"), Mode: 0600, ModTime: mtime}
+		fsys.MapFS["adir/empty"] = &fstest.MapFile{Mode: 0644, ModTime: mtime}
+		fsys.MapFS["alink"] = &fstest.MapFile{Data: []byte("adir/afile"), Mode: fs.ModeSymlink | 0777, ModTime: mtime}
+		return fsys
+	}
+
+	// checkSameTree checks that actual contains the same
+	// files of expected, with modification times
+	// truncated to precision.
+	checkSameTree := func(t *testing.T, expected fs.FS, actual fs.FS, precision time.Duration) {
+		var names []string
+		err := fs.WalkDir(expected, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || name == "." {
+				return err
+			}
+			names = append(names, name)
+
+			expectedInfo, err := d.Info()
+			assert.NoError(t, err)
+			actualInfo, err := lstat(actual, name)
+			if !assert.NoError(t, err) {
+				return nil
+			}
+			assert.Equal(t, expectedInfo.Mode(), actualInfo.Mode(), name)
+			assert.Equal(t, expectedInfo.ModTime().Truncate(precision).UTC(), actualInfo.ModTime().UTC(), name)
+			if expectedInfo.Mode()&fs.ModeSymlink != 0 {
+				expectedTarget, err := writefs.ReadLink(expected, name)
+				assert.NoError(t, err)
+				actualTarget, err := writefs.ReadLink(actual, name)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedTarget, actualTarget, name)
+			}
+			if !expectedInfo.Mode().IsRegular() {
+				return nil
+			}
+			expectedData, err := fs.ReadFile(expected, name)
+			assert.NoError(t, err)
+			actualData, err := fs.ReadFile(actual, name)
+			assert.NoError(t, err)
+			assert.Equal(t, expectedData, actualData, name)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, fstest.TestFS(actual, names...))
+	}
+
+	t.Run("FromFS loads fixtures from osfs", func(t *testing.T) {
+		fixtures := osfs.DirWriteFS(fixtureFile(""))
+		fsys, err := FromFS(fixtures)
+		assert.NoError(t, err)
+		checkSameTree(t, fixtures, fsys, 0)
+	})
+
+	t.Run("FromFS loads symbolic links from osfs", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("symbolic links require privileges on windows")
+		}
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "afile"), []byte("ciao\n"), 0644))
+		assert.NoError(t, os.Symlink("afile", filepath.Join(dir, "alink")))
+
+		fsys, err := FromFS(osfs.DirWriteFS(dir))
+		assert.NoError(t, err)
+		link := fsys.MapFS["alink"]
+		if assert.NotNil(t, link) {
+			assert.Equal(t, fs.ModeSymlink, link.Mode.Type())
+			assert.Equal(t, "afile", string(link.Data))
+		}
+	})
+
+	t.Run("tar archives preserve modes, times and symbolic links", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteTar(&buf, source()))
+		fsys, err := FromTar(&buf)
+		assert.NoError(t, err)
+		checkSameTree(t, source(), fsys, 0)
+	})
+
+	t.Run("zip archives preserve modes, times and symbolic links", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteZip(&buf, source()))
+		fsys, err := FromZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		checkSameTree(t, source(), fsys, time.Second)
+	})
+
+	t.Run("FromTar rejects entries outside the root", func(t *testing.T) {
+		var buf bytes.Buffer
+		archive := tar.NewWriter(&buf)
+		assert.NoError(t, archive.WriteHeader(&tar.Header{Name: "../afile", Mode: 0644, Typeflag: tar.TypeReg}))
+		assert.NoError(t, archive.Close())
+
+		_, err := FromTar(&buf)
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+}
+
+// lstat returns the information of the named file
+// as reported by its directory, without following
+// symbolic links.
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	entries, err := fs.ReadDir(fsys, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Name() == path.Base(name) {
+			return entry.Info()
+		}
+	}
+	return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+}
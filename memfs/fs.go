@@ -1,11 +1,9 @@
 package memfs
 
 import (
-	"fmt"
 	"io/fs"
 	"os"
 	"path"
-	"path/filepath"
 	"strings"
 	"testing/fstest"
 	"time"
@@ -16,143 +14,354 @@ import (
 // MapWriteFS ...
 type MapWriteFS struct {
 	fstest.MapFS
+	// Quota is the capacity of the file system,
+	// enforced by writes and reported by StatVFS.
+	Quota Quota
+
+	watchers *watchers
+	// shared contains the files whose data is
+	// shared with snapshots and clones.
+	shared map[*fstest.MapFile]struct{}
+	clock  Clock
 }
 
 // New ...
-func New() *MapWriteFS {
+func New(opts ...Option) *MapWriteFS {
+	cfg := newConfig(opts)
 	return &MapWriteFS{
-		MapFS: map[string]*fstest.MapFile{},
+		MapFS:    map[string]*fstest.MapFile{},
+		Quota:    cfg.quota,
+		watchers: newWatchers(),
+		shared:   map[*fstest.MapFile]struct{}{},
+		clock:    cfg.clock,
 	}
 }
 
 // NewFS ...
-func NewFS() writefs.WriteFS {
-	return &MapWriteFS{
-		MapFS: map[string]*fstest.MapFile{},
+func NewFS(opts ...Option) writefs.WriteFS {
+	return New(opts...)
+}
+
+// Sub implements fs.SubFS
+// It overrides the Sub method of fstest.MapFS,
+// that returns a read-only copy of the subtree.
+func (fsys MapWriteFS) Sub(dir string) (fs.FS, error) {
+	return writefs.NewSub(fsys, dir)
+}
+
+// StatVFS implements writefs.StatVFSFS
+// Usage is computed summing the size of all files
+// and counting all files and directories, and it's
+// reported relative to the Quota of the file system.
+func (fsys MapWriteFS) StatVFS(name string) (writefs.StatFSInfo, error) {
+	if _, err := fsys.Stat(name); err != nil {
+		return writefs.StatFSInfo{}, writefs.NewPathError("statvfs", name, err)
+	}
+
+	return fsys.Quota.statFSInfo(fsys.usedBytes(), fsys.usedInodes()), nil
+}
+
+// usedBytes returns the total size of the files.
+func (fsys MapWriteFS) usedBytes() uint64 {
+	var used uint64
+	for _, file := range fsys.MapFS {
+		used += uint64(len(file.Data))
+	}
+	return used
+}
+
+// usedInodes returns the number of files and directories,
+// not counting implicit directories.
+func (fsys MapWriteFS) usedInodes() uint64 {
+	return uint64(len(fsys.MapFS))
+}
+
+// Chmod implements writefs.ChmodFS
+func (fsys MapWriteFS) Chmod(name string, mode fs.FileMode) error {
+	file, err := fsys.file("chmod", name)
+	if err != nil {
+		return err
 	}
+	file.Mode = file.Mode&fs.ModeType | mode&^fs.ModeType
+	fsys.watchers.notify(writefs.OpChmod, name)
+	return nil
+}
+
+// Chtimes implements writefs.ChtimesFS
+// Access times are not tracked and atime is ignored.
+func (fsys MapWriteFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	file, err := fsys.file("chtimes", name)
+	if err != nil {
+		return err
+	}
+	file.ModTime = mtime
+	fsys.watchers.notify(writefs.OpChmod, name)
+	return nil
+}
+
+// Rename implements writefs.RenameFS
+// Renaming a directory moves all the files under it.
+func (fsys MapWriteFS) Rename(oldname string, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) || oldname == "." || newname == "." ||
+		strings.HasPrefix(newname, oldname+"/") {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	info, err := fsys.Stat(oldname)
+	if err != nil {
+		return writefs.NewLinkError("rename", oldname, newname, err)
+	}
+	if err := fsys.checkParent("rename", newname); err != nil {
+		return writefs.NewLinkError("rename", oldname, newname, err)
+	}
+	if oldname == newname {
+		return nil
+	}
+	if target, err := fsys.Stat(newname); err == nil {
+		if err := checkReplace(info, target, func() bool {
+			entries, err := fs.ReadDir(fsys, newname)
+			return err == nil && len(entries) == 0
+		}); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+		delete(fsys.shared, fsys.MapFS[newname])
+		delete(fsys.MapFS, newname)
+	}
+
+	for name, file := range fsys.MapFS {
+		if name == oldname || strings.HasPrefix(name, oldname+"/") {
+			delete(fsys.MapFS, name)
+			fsys.MapFS[newname+name[len(oldname):]] = file
+		}
+	}
+	fsys.watchers.notify(writefs.OpRename, oldname)
+	fsys.watchers.notify(writefs.OpCreate, newname)
+	return nil
+}
+
+// checkReplace returns an error if a file
+// described by info cannot replace target.
+// empty reports whether target is an empty directory.
+func checkReplace(info fs.FileInfo, target fs.FileInfo, empty func() bool) error {
+	if !target.IsDir() {
+		if info.IsDir() {
+			return writefs.ErrNotDir
+		}
+		return nil
+	}
+	if !info.IsDir() {
+		return writefs.ErrIsDir
+	}
+	if !empty() {
+		return writefs.ErrNotEmpty
+	}
+	return nil
+}
+
+// HashRanges implements writefs.RangeHashFS
+func (fsys MapWriteFS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	return writefs.ReadHashRanges(fsys, name, algo, size)
+}
+
+// file returns the file named name.
+// Files of implicit directories are created.
+func (fsys MapWriteFS) file(op string, name string) (*fstest.MapFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if file, ok := fsys.MapFS[name]; ok {
+		return file, nil
+	}
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return nil, writefs.NewPathError(op, name, err)
+	}
+	file := &fstest.MapFile{Mode: info.Mode(), ModTime: info.ModTime()}
+	fsys.MapFS[name] = file
+	return file, nil
 }
 
 type memWriteFile struct {
 	fs.File
 	file   *fstest.MapFile
 	cursor int
+	name   string
+	fsys   MapWriteFS
 }
 
 func (f *memWriteFile) Write(buf []byte) (n int, err error) {
-	sz := len(buf)
-	if f.cursor == len(f.file.Data) {
-		f.file.Data = append(f.file.Data, buf...)
+	n, err = f.WriteAt(buf, int64(f.cursor))
+	f.cursor += n
+	return n, err
+}
+
+// WriteAt implements io.WriterAt
+// Writes that exceed the Quota of the file system
+// write the bytes that fit and return an error.
+func (f *memWriteFile) WriteAt(buf []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	maxSize := f.fsys.Quota.maxSize(uint64(len(f.file.Data)), f.fsys.usedBytes)
+	if uint64(off)+uint64(len(buf)) > maxSize {
+		buf = buf[:remaining(maxSize, uint64(off))]
+		err = noSpace("write", f.name)
+		if len(buf) == 0 {
+			return 0, err
+		}
+	}
+
+	end := int(off) + len(buf)
+	if end > len(f.file.Data) {
+		data := make([]byte, end)
+		copy(data, f.file.Data)
+		f.file.Data = data
+		delete(f.fsys.shared, f.file)
 	} else {
-		buf = append(buf, f.file.Data[f.cursor+len(buf):]...)
-		f.file.Data = append(f.file.Data[:f.cursor], buf...)
+		own(f.fsys.shared, f.file)
 	}
-	f.cursor += sz
-	return sz, nil
+	copy(f.file.Data[off:], buf)
+	f.file.ModTime = now(f.fsys.clock)
+	f.fsys.watchers.notify(writefs.OpWrite, f.name)
+	return len(buf), err
+}
+
+// Truncate changes the size of the file.
+func (f *memWriteFile) Truncate(size int64) error {
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if uint64(size) > f.fsys.Quota.maxSize(uint64(len(f.file.Data)), f.fsys.usedBytes) {
+		return noSpace("truncate", f.name)
+	}
+	if int(size) <= len(f.file.Data) {
+		f.file.Data = f.file.Data[:size]
+	} else {
+		data := make([]byte, size)
+		copy(data, f.file.Data)
+		f.file.Data = data
+		delete(f.fsys.shared, f.file)
+	}
+	f.file.ModTime = now(f.fsys.clock)
+	f.fsys.watchers.notify(writefs.OpWrite, f.name)
+	return nil
 }
 
 // OpenFile ...
 func (fsys MapWriteFS) OpenFile(name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	op := writefs.OpenFileOp(flag, perm)
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
 	}
 
-	file, exists := fsys.MapFS[name]
-
 	if flag == os.O_RDONLY {
-		if !exists {
-			return nil, fs.ErrNotExist
-		}
 		f, err := fsys.Open(name)
 		if err != nil {
-			return nil, err
+			return nil, writefs.NewPathError(op, name, err)
 		}
 		return writefs.ReadOnlyWriteFile{File: f}, nil
 	}
 
-	if flag&os.O_CREATE == os.O_CREATE && perm.IsDir() {
+	info, err := fsys.Stat(name)
+	exists := err == nil
+
+	if op == "mkdir" {
 		if exists {
-			return nil, fs.ErrExist
-		}
-		segments := strings.Split(name, "/")
-		curr := "."
-		for _, seg := range segments[:len(segments)-1] {
-			curr = path.Join(curr, seg)
-			_, err := fsys.Stat(curr)
-			/*if os.IsNotExist(err) {
-				_, err = fsys.OpenFile(curr, flag, perm)
-				if err != nil {
-					return nil, err
-				}
-
-			}*/
-			if err != nil {
-				return nil, err
-			}
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+		}
+		if err := fsys.checkParent(op, name); err != nil {
+			return nil, err
+		}
+		if err := fsys.Quota.checkInodes(op, name, fsys.usedInodes); err != nil {
+			return nil, err
 		}
 		fsys.MapFS[name] = &fstest.MapFile{
 			Mode:    perm,
-			ModTime: time.Now(),
+			ModTime: now(fsys.clock),
 		}
+		fsys.watchers.notify(writefs.OpCreate, name)
 		return nil, nil
 	}
 
-	if flag == os.O_TRUNC {
+	if op == "remove" {
 		if !exists {
-			return nil, fs.ErrNotExist
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
 		}
-		if file.Mode.IsDir() {
+		if info.IsDir() {
 			files, err := fs.ReadDir(fsys, name)
 			if err != nil {
-				return nil, err
+				return nil, writefs.NewPathError(op, name, err)
 			}
 			if len(files) != 0 {
-				return nil, fmt.Errorf("%w: directory `%s` not empty", fs.ErrInvalid, name)
+				return nil, &fs.PathError{Op: op, Path: name, Err: writefs.ErrNotEmpty}
 			}
 		}
+		delete(fsys.shared, fsys.MapFS[name])
 		delete(fsys.MapFS, name)
+		fsys.watchers.notify(writefs.OpRemove, name)
 		return nil, nil
 	}
+
 	cursor := 0
+	file := fsys.MapFS[name]
 	if exists {
+		if info.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: writefs.ErrIsDir}
+		}
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+		}
 		if flag&os.O_TRUNC == os.O_TRUNC {
 			file.Data = []byte{}
-		} else if flag&os.O_EXCL == os.O_EXCL {
-			return nil, fs.ErrExist
+			file.ModTime = now(fsys.clock)
+			delete(fsys.shared, file)
+			fsys.watchers.notify(writefs.OpWrite, name)
 		} else if flag&os.O_APPEND == os.O_APPEND {
 			cursor += len(file.Data)
 		}
 	} else {
 		if flag&os.O_CREATE == 0 {
-			return nil, fs.ErrNotExist
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
 		}
-		if name != "." {
-			// check that parent exists
-			parent, err := fs.Stat(fsys, filepath.Dir(name))
-			if err != nil {
-				return nil, err
-			}
-			if !parent.IsDir() {
-				return nil, fmt.Errorf("parent directory `%s` is a file: %w", filepath.Dir(name), fs.ErrInvalid)
-			}
+		if err := fsys.checkParent(op, name); err != nil {
+			return nil, err
+		}
+		if err := fsys.Quota.checkInodes(op, name, fsys.usedInodes); err != nil {
+			return nil, err
 		}
 
 		file = &fstest.MapFile{
 			Data:    []byte{},
 			Mode:    perm,
-			ModTime: time.Now(),
+			ModTime: now(fsys.clock),
 		}
 		fsys.MapFS[name] = file
-
+		fsys.watchers.notify(writefs.OpCreate, name)
 	}
 
 	f, err := fsys.Open(name)
 	if err != nil {
-		return nil, err
+		return nil, writefs.NewPathError(op, name, err)
 	}
 
 	return &memWriteFile{
 		File:   f,
 		file:   file,
 		cursor: cursor,
+		name:   name,
+		fsys:   fsys,
 	}, nil
 }
+
+// checkParent checks that the parent
+// directory of the named file exists.
+func (fsys MapWriteFS) checkParent(op string, name string) error {
+	parent := path.Dir(name)
+	info, err := fsys.Stat(parent)
+	if err != nil {
+		return writefs.NewPathError(op, name, err)
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: writefs.ErrNotDir}
+	}
+	return nil
+}
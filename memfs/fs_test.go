@@ -1,12 +1,19 @@
 package memfs
 
 import (
+	"context"
+	"errors"
+	"io/fs"
+	"math"
 	"path"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
+	"github.com/parro-it/vs/writefs"
 	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
 )
 
 func fixtureFile(name string) string {
@@ -21,7 +28,147 @@ func fixtureFile(name string) string {
 }
 
 func TestMemFS(t *testing.T) {
-	fsys := New()
-	t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys))
+	clock := writefstest.NewClock()
+	fsys := New(WithClock(clock))
+	t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys, writefstest.WithClock(clock)))
 
+	t.Run("Sub returns a writable fs", writefstest.TestSub(New(), "adir"))
+
+	t.Run("StatVFS reports usage relative to the quota", func(t *testing.T) {
+		fsys := New()
+		fsys.Quota = Quota{MaxBytes: 100, MaxInodes: 10}
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		info, err := writefs.StatVFS(fsys, "adir")
+		assert.NoError(t, err)
+		assert.Equal(t, writefs.StatFSInfo{
+			TotalBytes:      100,
+			FreeBytes:       95,
+			AvailableBytes:  95,
+			TotalInodes:     10,
+			FreeInodes:      8,
+			AvailableInodes: 8,
+		}, info)
+
+		sub, err := fs.Sub(fsys, "adir")
+		assert.NoError(t, err)
+		subInfo, err := writefs.StatVFS(sub, ".")
+		assert.NoError(t, err)
+		assert.Equal(t, info, subInfo)
+	})
+
+	t.Run("StatVFS reports unlimited capacity without quota", func(t *testing.T) {
+		info, err := writefs.StatVFS(New(), ".")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(math.MaxInt64), info.TotalBytes)
+		assert.Equal(t, uint64(math.MaxInt64), info.FreeBytes)
+	})
+
+	t.Run("Chmod and Chtimes change file attributes", func(t *testing.T) {
+		fsys := New()
+		_, err := writefs.WriteFile(fsys, "chfile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		mtime := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+		assert.NoError(t, writefs.Chmod(fsys, "chfile", fs.FileMode(0600)))
+		assert.NoError(t, writefs.Chtimes(fsys, "chfile", mtime, mtime))
+
+		info, err := fs.Stat(fsys, "chfile")
+		assert.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0600), info.Mode())
+		assert.True(t, mtime.Equal(info.ModTime()))
+		assert.NoError(t, writefs.Remove(fsys, "chfile"))
+	})
+
+	t.Run("Rename moves files and directories", func(t *testing.T) {
+		fsys := New()
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		_, err = writefs.WriteFile(fsys, "bfile", []byte("miao\n"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, writefs.Rename(fsys, "bfile", "adir/afile"))
+		buf, err := fs.ReadFile(fsys, "adir/afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "miao\n", string(buf))
+		_, err = fs.Stat(fsys, "bfile")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+		assert.NoError(t, writefs.Rename(fsys, "adir", "bdir"))
+		buf, err = fs.ReadFile(fsys, "bdir/afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "miao\n", string(buf))
+
+		err = writefs.Rename(fsys, "missing", "cfile")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+		err = writefs.Rename(fsys, "bdir", "bdir/nested")
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+
+	t.Run("Watch reports mutations", func(t *testing.T) {
+		fsys := New()
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := writefs.Watch(ctx, fsys, "adir", true)
+		assert.NoError(t, err)
+
+		assert.NoError(t, writefs.MkDir(fsys, "adir/nested", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(fsys, "adir/nested/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		_, err = writefs.WriteFile(fsys, "outside", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.Chmod(fsys, "adir/nested/afile", fs.FileMode(0600)))
+		assert.NoError(t, writefs.Remove(fsys, "adir/nested/afile"))
+
+		assert.Equal(t, []string{
+			"CREATE adir/nested",
+			"CREATE adir/nested/afile",
+			"WRITE adir/nested/afile",
+			"CHMOD adir/nested/afile",
+			"REMOVE adir/nested/afile",
+		}, nextEvents(events, 6))
+
+		cancel()
+		_, ok := <-events
+		assert.False(t, ok)
+	})
+
+	t.Run("Watch reports only direct entries when not recursive", func(t *testing.T) {
+		fsys := New()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := writefs.Watch(ctx, fsys, ".", false)
+		assert.NoError(t, err)
+
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"CREATE adir"}, nextEvents(events, 2))
+	})
+
+	t.Run("Watch fails for missing files", func(t *testing.T) {
+		_, err := writefs.Watch(context.Background(), New(), "missing", false)
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+}
+
+// nextEvents receives events until count
+// are received or no event arrives for a second.
+func nextEvents(events <-chan writefs.Event, count int) []string {
+	var res []string
+	for len(res) < count {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return res
+			}
+			res = append(res, ev.String())
+		case <-time.After(time.Second):
+			return res
+		}
+	}
+	return res
 }
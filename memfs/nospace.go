@@ -0,0 +1,10 @@
+//go:build !plan9
+// +build !plan9
+
+package memfs
+
+import "syscall"
+
+// errNoSpace is the error wrapped by the errors of
+// operations that exceed the quota of a file system.
+var errNoSpace error = syscall.ENOSPC
@@ -0,0 +1,8 @@
+package memfs
+
+import "errors"
+
+// errNoSpace is the error wrapped by the errors of
+// operations that exceed the quota of a file system:
+// plan9 has no errno values.
+var errNoSpace = errors.New("no space left on device")
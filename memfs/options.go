@@ -0,0 +1,79 @@
+package memfs
+
+import "time"
+
+// Clock provides the current time to a file system,
+// that uses it to stamp the times of its files.
+type Clock interface {
+	Now() time.Time
+}
+
+// Option configures the file systems
+// created by New, NewFS and NewTree.
+type Option func(*config)
+
+type config struct {
+	clock Clock
+	quota Quota
+}
+
+func newConfig(opts []Option) config {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.clock == nil {
+		cfg.clock = systemClock{}
+	}
+	return cfg
+}
+
+// WithClock sets the clock used to stamp the modification
+// times of files. By default, or when clock is nil, the
+// system clock is used.
+func WithClock(clock Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = clock
+	}
+}
+
+// WithMaxBytes limits the total size of the files
+// of the file system to max bytes.
+func WithMaxBytes(max uint64) Option {
+	return func(cfg *config) {
+		cfg.quota.MaxBytes = max
+	}
+}
+
+// WithMaxInodes limits the number of files
+// and directories of the file system to max.
+func WithMaxInodes(max uint64) Option {
+	return func(cfg *config) {
+		cfg.quota.MaxInodes = max
+	}
+}
+
+// WithMaxFileSize limits the size
+// of every file to max bytes.
+func WithMaxFileSize(max uint64) Option {
+	return func(cfg *config) {
+		cfg.quota.MaxFileSize = max
+	}
+}
+
+// systemClock is the Clock that
+// returns the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// now returns the current time according to clock,
+// or the system time for file systems without one.
+func now(clock Clock) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
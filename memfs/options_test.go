@@ -0,0 +1,71 @@
+package memfs
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/parro-it/vs/writefs"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a Clock that advances
+// by a second at every call.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+func TestOptions(t *testing.T) {
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	modTime := func(t *testing.T, fsys fs.FS, name string) time.Time {
+		info, err := fs.Stat(fsys, name)
+		assert.NoError(t, err)
+		return info.ModTime()
+	}
+
+	t.Run("WithClock stamps MapWriteFS files", func(t *testing.T) {
+		fsys := New(WithClock(&fakeClock{now: start}))
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		// files are stamped when they are created,
+		// and again by writes.
+		assert.Equal(t, start.Add(time.Second), modTime(t, fsys, "adir"))
+		assert.Equal(t, start.Add(3*time.Second), modTime(t, fsys, "adir/afile"))
+
+		clone := fsys.Clone()
+		_, err = writefs.WriteFile(clone, "bfile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, start.Add(5*time.Second), modTime(t, clone, "bfile"))
+	})
+
+	t.Run("WithClock stamps TreeFS files", func(t *testing.T) {
+		fsys := NewTree(WithClock(&fakeClock{now: start}))
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		// directories are stamped by changes to
+		// their entries, and files by writes.
+		assert.Equal(t, start.Add(2*time.Second), modTime(t, fsys, "."))
+		assert.Equal(t, start.Add(3*time.Second), modTime(t, fsys, "adir"))
+		assert.Equal(t, start.Add(4*time.Second), modTime(t, fsys, "adir/afile"))
+	})
+
+	t.Run("nil clocks use the system clock", func(t *testing.T) {
+		before := time.Now()
+		fsys := NewTree(WithClock(nil))
+		after := time.Now()
+
+		actual := modTime(t, fsys, ".")
+		assert.False(t, actual.Before(before))
+		assert.False(t, actual.After(after))
+	})
+}
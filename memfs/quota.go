@@ -0,0 +1,92 @@
+package memfs
+
+import (
+	"io/fs"
+	"math"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// Quota configures the capacity of a file system.
+// Operations that exceed it fail with errors wrapping
+// syscall.ENOSPC, like on a full disk. Zero fields mean
+// unlimited capacity, reported by StatVFS as math.MaxInt64.
+type Quota struct {
+	// MaxBytes is the total size of the files
+	// the file system can contain.
+	MaxBytes uint64
+	// MaxInodes is the number of files and
+	// directories the file system can contain.
+	MaxInodes uint64
+	// MaxFileSize is the size a single file can grow to.
+	MaxFileSize uint64
+}
+
+// statFSInfo reports usedBytes and usedInodes
+// relative to the capacity configured by quota.
+func (quota Quota) statFSInfo(usedBytes, usedInodes uint64) writefs.StatFSInfo {
+	totalBytes := capacity(quota.MaxBytes)
+	totalInodes := capacity(quota.MaxInodes)
+	freeBytes := remaining(totalBytes, usedBytes)
+	freeInodes := remaining(totalInodes, usedInodes)
+
+	return writefs.StatFSInfo{
+		TotalBytes:      totalBytes,
+		FreeBytes:       freeBytes,
+		AvailableBytes:  freeBytes,
+		TotalInodes:     totalInodes,
+		FreeInodes:      freeInodes,
+		AvailableInodes: freeInodes,
+	}
+}
+
+func capacity(max uint64) uint64 {
+	if max == 0 {
+		return math.MaxInt64
+	}
+	return max
+}
+
+func remaining(total, used uint64) uint64 {
+	if used > total {
+		return 0
+	}
+	return total - used
+}
+
+// maxSize returns the size a file of the given size can
+// grow to. usedBytes returns the total size of the files
+// of the file system, and it's called only when needed.
+// Files bigger than the limits can be overwritten, but
+// cannot grow.
+func (quota Quota) maxSize(size uint64, usedBytes func() uint64) uint64 {
+	max := uint64(math.MaxInt64)
+	if quota.MaxFileSize != 0 {
+		max = quota.MaxFileSize
+	}
+	if quota.MaxBytes != 0 {
+		if free := size + remaining(quota.MaxBytes, usedBytes()); free < max {
+			max = free
+		}
+	}
+	if max < size {
+		return size
+	}
+	return max
+}
+
+// checkInodes returns an error if a new file cannot be
+// created. usedInodes returns the number of files of the
+// file system, and it's called only when needed.
+func (quota Quota) checkInodes(op string, name string, usedInodes func() uint64) error {
+	if quota.MaxInodes != 0 && usedInodes() >= quota.MaxInodes {
+		return noSpace(op, name)
+	}
+	return nil
+}
+
+// noSpace returns the error of operations
+// that exceed the quota of a file system.
+func noSpace(op string, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: errNoSpace}
+}
@@ -0,0 +1,100 @@
+package memfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/parro-it/vs/writefs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	constructors := map[string]func(opts ...Option) writefs.WriteFS{
+		"MapWriteFS": NewFS,
+		"TreeFS": func(opts ...Option) writefs.WriteFS {
+			return NewTree(opts...)
+		},
+	}
+
+	for fsName, newFS := range constructors {
+		newFS := newFS
+		t.Run(fsName, func(t *testing.T) {
+			t.Run("writes exceeding MaxBytes fail partway", func(t *testing.T) {
+				fsys := newFS(WithMaxBytes(8))
+				_, err := writefs.WriteFile(fsys, "afile", []byte("ciao\n"))
+				assert.NoError(t, err)
+
+				f, err := writefs.OpenFile(fsys, "bfile", os.O_CREATE|os.O_WRONLY, fs.FileMode(0644))
+				assert.NoError(t, err)
+				n, err := f.Write([]byte("miao\n"))
+				assert.Equal(t, 3, n)
+				assert.True(t, errors.Is(err, syscall.ENOSPC))
+				var pathErr *fs.PathError
+				assert.True(t, errors.As(err, &pathErr))
+				assert.Equal(t, "bfile", pathErr.Path)
+
+				n, err = f.Write([]byte("miao\n"))
+				assert.Equal(t, 0, n)
+				assert.True(t, errors.Is(err, syscall.ENOSPC))
+				assert.NoError(t, f.Close())
+
+				buf, err := fs.ReadFile(fsys, "bfile")
+				assert.NoError(t, err)
+				assert.Equal(t, "mia", string(buf))
+
+				info, err := writefs.StatVFS(fsys, ".")
+				assert.NoError(t, err)
+				assert.Equal(t, uint64(8), info.TotalBytes)
+				assert.Equal(t, uint64(0), info.FreeBytes)
+
+				assert.NoError(t, writefs.Remove(fsys, "afile"))
+				info, err = writefs.StatVFS(fsys, ".")
+				assert.NoError(t, err)
+				assert.Equal(t, uint64(5), info.FreeBytes)
+			})
+
+			t.Run("files cannot grow beyond MaxFileSize", func(t *testing.T) {
+				fsys := newFS(WithMaxFileSize(4))
+				n, err := writefs.WriteFile(fsys, "afile", []byte("ciao\n"))
+				assert.Equal(t, 4, n)
+				assert.True(t, errors.Is(err, syscall.ENOSPC))
+
+				f, err := writefs.OpenFile(fsys, "afile", os.O_WRONLY, 0)
+				assert.NoError(t, err)
+				err = f.(interface{ Truncate(int64) error }).Truncate(5)
+				assert.True(t, errors.Is(err, syscall.ENOSPC))
+				n, err = f.Write([]byte("m"))
+				assert.Equal(t, 1, n)
+				assert.NoError(t, err)
+				assert.NoError(t, f.Close())
+
+				buf, err := fs.ReadFile(fsys, "afile")
+				assert.NoError(t, err)
+				assert.Equal(t, "miao", string(buf))
+			})
+
+			t.Run("files cannot be created beyond MaxInodes", func(t *testing.T) {
+				fsys := newFS(WithMaxInodes(2))
+				assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+				_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+				assert.NoError(t, err)
+
+				_, err = writefs.WriteFile(fsys, "adir/bfile", []byte("ciao\n"))
+				assert.True(t, errors.Is(err, syscall.ENOSPC))
+				err = writefs.MkDir(fsys, "bdir", fs.FileMode(0755))
+				assert.True(t, errors.Is(err, syscall.ENOSPC))
+
+				info, err := writefs.StatVFS(fsys, ".")
+				assert.NoError(t, err)
+				assert.Equal(t, uint64(0), info.FreeInodes)
+
+				assert.NoError(t, writefs.Remove(fsys, "adir/afile"))
+				_, err = writefs.WriteFile(fsys, "adir/bfile", []byte("ciao\n"))
+				assert.NoError(t, err)
+			})
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package memfs
+
+import (
+	"testing/fstest"
+)
+
+// Snapshot is a read-only copy of the content
+// of a MapWriteFS, created by MapWriteFS.Snapshot.
+// Snapshots share file data with the file systems
+// they are taken from or restored to: data is
+// copied only when the files are written.
+type Snapshot struct {
+	files map[string]*fstest.MapFile
+	quota Quota
+}
+
+// Snapshot returns a snapshot of the current content
+// of the file system, that is not affected by later
+// changes to it. Only the attributes of the files are
+// copied: their data is copied on their first write.
+// File systems not created with New or NewFS copy
+// file data immediately.
+func (fsys MapWriteFS) Snapshot() *Snapshot {
+	files := make(map[string]*fstest.MapFile, len(fsys.MapFS))
+	for name, file := range fsys.MapFS {
+		copied := *file
+		if fsys.shared == nil {
+			copied.Data = append([]byte(nil), file.Data...)
+		} else {
+			fsys.shared[file] = struct{}{}
+		}
+		// files of snapshots are never written,
+		// so only the source is tracked.
+		files[name] = &copied
+	}
+	return &Snapshot{files: files, quota: fsys.Quota}
+}
+
+// Clone returns a new file system with the same content
+// Quota and clock of fsys. Like Snapshot, it copies file data
+// on write. Watchers of fsys don't watch the clone.
+func (fsys MapWriteFS) Clone() *MapWriteFS {
+	return fsys.Snapshot().FS(WithClock(fsys.clock))
+}
+
+// Restore replaces the content and Quota of the
+// file system with the ones of snapshot.
+// Watchers are not notified of the changes.
+func (fsys *MapWriteFS) Restore(snapshot *Snapshot) {
+	for name := range fsys.MapFS {
+		delete(fsys.MapFS, name)
+	}
+	for file := range fsys.shared {
+		delete(fsys.shared, file)
+	}
+	for name, file := range snapshot.files {
+		copied := *file
+		if fsys.shared == nil {
+			copied.Data = append([]byte(nil), file.Data...)
+		} else {
+			fsys.shared[&copied] = struct{}{}
+		}
+		fsys.MapFS[name] = &copied
+	}
+	fsys.Quota = snapshot.quota
+}
+
+// FS returns a new file system with the content
+// of the snapshot, configured by opts.
+func (snapshot *Snapshot) FS(opts ...Option) *MapWriteFS {
+	fsys := New(opts...)
+	fsys.Restore(snapshot)
+	return fsys
+}
+
+// own ensures that the data of file is not shared
+// with snapshots or clones, copying it if needed.
+func own(shared map[*fstest.MapFile]struct{}, file *fstest.MapFile) {
+	if _, ok := shared[file]; !ok {
+		return
+	}
+	file.Data = append([]byte(nil), file.Data...)
+	delete(shared, file)
+}
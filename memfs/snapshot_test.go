@@ -0,0 +1,111 @@
+package memfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/parro-it/vs/writefs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	fixture := func(t *testing.T) *MapWriteFS {
+		fsys := New()
+		fsys.Quota = Quota{MaxBytes: 100}
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		return fsys
+	}
+
+	readFile := func(t *testing.T, fsys fs.FS, name string) string {
+		buf, err := fs.ReadFile(fsys, name)
+		assert.NoError(t, err)
+		return string(buf)
+	}
+
+	t.Run("Clone returns an independent copy", func(t *testing.T) {
+		fsys := fixture(t)
+		clone := fsys.Clone()
+		assert.Equal(t, Quota{MaxBytes: 100}, clone.Quota)
+		assert.NoError(t, fstest.TestFS(clone, "adir", "adir/afile"))
+
+		_, err := writefs.WriteFile(clone, "adir/bfile", []byte("miao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.Remove(fsys, "adir/afile"))
+
+		assert.Equal(t, "ciao\n", readFile(t, clone, "adir/afile"))
+		_, err = fs.Stat(fsys, "adir/bfile")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("file data is copied on write", func(t *testing.T) {
+		fsys := fixture(t)
+		snapshot := fsys.Snapshot()
+		clone := snapshot.FS()
+
+		f, err := writefs.OpenFile(fsys, "adir/afile", os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		_, err = f.(io.WriterAt).WriteAt([]byte("m"), 0)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		f, err = writefs.OpenFile(clone, "adir/afile", os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		_, err = f.(io.WriterAt).WriteAt([]byte("b"), 0)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		assert.Equal(t, "miao\n", readFile(t, fsys, "adir/afile"))
+		assert.Equal(t, "biao\n", readFile(t, clone, "adir/afile"))
+		assert.Equal(t, "ciao\n", readFile(t, snapshot.FS(), "adir/afile"))
+	})
+
+	t.Run("Restore resets the content of the file system", func(t *testing.T) {
+		fsys := fixture(t)
+		snapshot := fsys.Snapshot()
+
+		for _, content := range []string{"miao\n", "bau\n"} {
+			_, err := writefs.WriteFile(fsys, "adir/afile", []byte(content))
+			assert.NoError(t, err)
+			_, err = writefs.WriteFile(fsys, "bfile", []byte(content))
+			assert.NoError(t, err)
+			fsys.Quota = Quota{}
+
+			fsys.Restore(snapshot)
+			assert.Equal(t, "ciao\n", readFile(t, fsys, "adir/afile"))
+			_, err = fs.Stat(fsys, "bfile")
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+			assert.Equal(t, Quota{MaxBytes: 100}, fsys.Quota)
+			assert.Len(t, fsys.shared, 2)
+		}
+	})
+
+	t.Run("files that don't share data are not tracked", func(t *testing.T) {
+		fsys := fixture(t)
+		fsys.Snapshot()
+		_, err := writefs.WriteFile(fsys, "bfile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		fsys.Snapshot()
+		assert.Len(t, fsys.shared, 3)
+
+		f, err := writefs.OpenFile(fsys, "adir/afile", os.O_WRONLY|os.O_TRUNC, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		assert.NoError(t, writefs.Remove(fsys, "bfile"))
+		assert.Len(t, fsys.shared, 1)
+	})
+
+	t.Run("file systems not created with New copy data", func(t *testing.T) {
+		fsys := &MapWriteFS{MapFS: fstest.MapFS{
+			"afile": &fstest.MapFile{Data: []byte("ciao\n")},
+		}}
+		clone := fsys.Clone()
+		fsys.MapFS["afile"].Data[0] = 'm'
+		assert.Equal(t, "ciao\n", readFile(t, clone, "afile"))
+	})
+}
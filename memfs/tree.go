@@ -0,0 +1,802 @@
+package memfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// TreeFS is a thread-safe in-memory file system.
+// Unlike MapWriteFS, that stores files in a flat map and
+// synthesizes their parent directories, TreeFS stores an
+// explicit tree of inodes: directories must be created
+// before their entries, and all operations are serialized
+// by a read-write lock, so that the file system and the
+// files it opens can be used by concurrent goroutines.
+// The Sys method of the fs.FileInfo of its files
+// returns an *Inode.
+// TreeFS instances must be created with NewTree.
+type TreeFS struct {
+	// Quota is the capacity of the file system,
+	// enforced by writes and reported by StatVFS.
+	Quota Quota
+
+	lock     sync.RWMutex
+	root     *inode
+	lastIno  uint64
+	watchers *watchers
+	clock    Clock
+	// bytes and inodes are the total size and the
+	// number of the files, not counting the root.
+	bytes  uint64
+	inodes uint64
+}
+
+var (
+	_ fs.StatFS     = &TreeFS{}
+	_ fs.ReadFileFS = &TreeFS{}
+	_ fs.ReadDirFS  = &TreeFS{}
+	_ fs.SubFS      = &TreeFS{}
+
+	_ writefs.WriteFS     = &TreeFS{}
+	_ writefs.StatVFSFS   = &TreeFS{}
+	_ writefs.ChmodFS     = &TreeFS{}
+	_ writefs.ChtimesFS   = &TreeFS{}
+	_ writefs.RangeHashFS = &TreeFS{}
+	_ writefs.WatchFS     = &TreeFS{}
+	_ writefs.RenameFS    = &TreeFS{}
+)
+
+// Inode describes the inode of a TreeFS file.
+// It is returned by the Sys method of its fs.FileInfo.
+type Inode struct {
+	// Ino is the number of the inode,
+	// unique within its file system.
+	Ino uint64
+	// Nlink is the number of links to the inode:
+	// 1 for files, and 2 plus the number of
+	// subdirectories for directories.
+	Nlink uint64
+}
+
+// NewTree returns an empty TreeFS.
+func NewTree(opts ...Option) *TreeFS {
+	cfg := newConfig(opts)
+	fsys := &TreeFS{Quota: cfg.quota, watchers: newWatchers(), clock: cfg.clock}
+	fsys.root = fsys.newInode(fs.ModeDir | 0755)
+	return fsys
+}
+
+type inode struct {
+	ino     uint64
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+	// entries contains the children
+	// of directories, by name.
+	entries map[string]*inode
+	// unlinked is true for files removed from
+	// the tree, whose size is no more counted
+	// in the usage of the file system.
+	unlinked bool
+}
+
+// newInode allocates an inode with a new number.
+// It must be called with the write lock held.
+func (fsys *TreeFS) newInode(mode fs.FileMode) *inode {
+	fsys.lastIno++
+	node := &inode{
+		ino:     fsys.lastIno,
+		mode:    mode,
+		modTime: fsys.clock.Now(),
+	}
+	if mode.IsDir() {
+		node.entries = map[string]*inode{}
+	}
+	return node
+}
+
+func (node *inode) nlink() uint64 {
+	if !node.mode.IsDir() {
+		return 1
+	}
+	n := uint64(2)
+	for _, entry := range node.entries {
+		if entry.mode.IsDir() {
+			n++
+		}
+	}
+	return n
+}
+
+// info returns a snapshot of the
+// attributes of the node named name.
+func (node *inode) info(name string) *treeFileInfo {
+	return &treeFileInfo{
+		name:    path.Base(name),
+		size:    int64(len(node.data)),
+		mode:    node.mode,
+		modTime: node.modTime,
+		inode:   Inode{Ino: node.ino, Nlink: node.nlink()},
+	}
+}
+
+// dirEntries returns the entries of
+// the directory node sorted by name.
+func (node *inode) dirEntries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(node.entries))
+	for name, entry := range node.entries {
+		entries = append(entries, entry.info(name))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+// lookup returns the node of the named file.
+// The returned errors are not wrapped in *fs.PathError.
+func (fsys *TreeFS) lookup(name string) (*inode, error) {
+	node := fsys.root
+	if name == "." {
+		return node, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if !node.mode.IsDir() {
+			return nil, writefs.ErrNotDir
+		}
+		entry, ok := node.entries[elem]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		node = entry
+	}
+	return node, nil
+}
+
+// lookupParent returns the node of the
+// parent directory of the named file.
+func (fsys *TreeFS) lookupParent(name string) (*inode, error) {
+	parent, err := fsys.lookup(path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	if !parent.mode.IsDir() {
+		return nil, writefs.ErrNotDir
+	}
+	return parent, nil
+}
+
+// Open implements fs.FS
+func (fsys *TreeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lock.RLock()
+	defer fsys.lock.RUnlock()
+
+	node, err := fsys.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if node.mode.IsDir() {
+		return &treeDir{info: node.info(name), entries: node.dirEntries()}, nil
+	}
+	return &treeFile{fsys: fsys, node: node, name: name, readable: true}, nil
+}
+
+// Stat implements fs.StatFS
+func (fsys *TreeFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lock.RLock()
+	defer fsys.lock.RUnlock()
+
+	node, err := fsys.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return node.info(name), nil
+}
+
+// ReadDir implements fs.ReadDirFS
+func (fsys *TreeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lock.RLock()
+	defer fsys.lock.RUnlock()
+
+	node, err := fsys.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: writefs.ErrNotDir}
+	}
+	return node.dirEntries(), nil
+}
+
+// ReadFile implements fs.ReadFileFS
+func (fsys *TreeFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lock.RLock()
+	defer fsys.lock.RUnlock()
+
+	node, err := fsys.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	if node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: writefs.ErrIsDir}
+	}
+	buf := make([]byte, len(node.data))
+	copy(buf, node.data)
+	return buf, nil
+}
+
+// Sub implements fs.SubFS
+func (fsys *TreeFS) Sub(dir string) (fs.FS, error) {
+	return writefs.NewSub(fsys, dir)
+}
+
+// OpenFile implements writefs.WriteFS
+// Files and directories can only be created in existing
+// directories, and only empty directories can be removed.
+func (fsys *TreeFS) OpenFile(name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	op := writefs.OpenFileOp(flag, perm)
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+
+	switch op {
+	case "mkdir":
+		return nil, fsys.mkdir(name, perm)
+	case "remove":
+		return nil, fsys.remove(name)
+	}
+
+	if flag == os.O_RDONLY {
+		node, err := fsys.lookup(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		if node.mode.IsDir() {
+			return writefs.ReadOnlyWriteFile{
+				File: &treeDir{info: node.info(name), entries: node.dirEntries()},
+			}, nil
+		}
+		return &treeFile{fsys: fsys, node: node, name: name, readable: true}, nil
+	}
+
+	if name == "." {
+		return nil, &fs.PathError{Op: op, Path: name, Err: writefs.ErrIsDir}
+	}
+	parent, err := fsys.lookupParent(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	base := path.Base(name)
+	node, exists := parent.entries[base]
+	if exists {
+		if node.mode.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: writefs.ErrIsDir}
+		}
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+		}
+		if flag&os.O_TRUNC == os.O_TRUNC {
+			fsys.bytes -= uint64(len(node.data))
+			node.data = nil
+			node.modTime = fsys.clock.Now()
+			fsys.watchers.notify(writefs.OpWrite, name)
+		}
+	} else {
+		if flag&os.O_CREATE == 0 {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if err := fsys.Quota.checkInodes(op, name, fsys.usedInodes); err != nil {
+			return nil, err
+		}
+		node = fsys.newInode(perm &^ fs.ModeType)
+		fsys.inodes++
+		parent.entries[base] = node
+		parent.modTime = node.modTime
+		fsys.watchers.notify(writefs.OpCreate, name)
+	}
+
+	return &treeFile{
+		fsys:     fsys,
+		node:     node,
+		name:     name,
+		readable: flag&os.O_WRONLY == 0,
+		writable: flag&(os.O_WRONLY|os.O_RDWR) != 0,
+		append:   flag&os.O_APPEND == os.O_APPEND,
+	}, nil
+}
+
+// mkdir creates the named directory.
+// It must be called with the write lock held.
+func (fsys *TreeFS) mkdir(name string, perm fs.FileMode) error {
+	if name == "." {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	parent, err := fsys.lookupParent(name)
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	base := path.Base(name)
+	if _, exists := parent.entries[base]; exists {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if err := fsys.Quota.checkInodes("mkdir", name, fsys.usedInodes); err != nil {
+		return err
+	}
+
+	node := fsys.newInode(perm&^fs.ModeType | fs.ModeDir)
+	fsys.inodes++
+	parent.entries[base] = node
+	parent.modTime = node.modTime
+	fsys.watchers.notify(writefs.OpCreate, name)
+	return nil
+}
+
+// remove removes the named file or empty directory.
+// It must be called with the write lock held.
+func (fsys *TreeFS) remove(name string) error {
+	if name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	parent, err := fsys.lookupParent(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	base := path.Base(name)
+	node, exists := parent.entries[base]
+	if !exists {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.mode.IsDir() && len(node.entries) != 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: writefs.ErrNotEmpty}
+	}
+
+	delete(parent.entries, base)
+	node.unlinked = true
+	fsys.bytes -= uint64(len(node.data))
+	fsys.inodes--
+	parent.modTime = fsys.clock.Now()
+	fsys.watchers.notify(writefs.OpRemove, name)
+	return nil
+}
+
+// Rename implements writefs.RenameFS
+// Files opened with the old name keep referring
+// to the renamed inode.
+func (fsys *TreeFS) Rename(oldname string, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) || oldname == "." || newname == "." ||
+		strings.HasPrefix(newname, oldname+"/") {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+
+	oldParent, err := fsys.lookupParent(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	node, exists := oldParent.entries[path.Base(oldname)]
+	if !exists {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	newParent, err := fsys.lookupParent(newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	if oldname == newname {
+		return nil
+	}
+
+	if target, exists := newParent.entries[path.Base(newname)]; exists {
+		err := checkReplace(node.info(oldname), target.info(newname), func() bool {
+			return len(target.entries) == 0
+		})
+		if err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+		target.unlinked = true
+		fsys.bytes -= uint64(len(target.data))
+		fsys.inodes--
+	}
+
+	delete(oldParent.entries, path.Base(oldname))
+	newParent.entries[path.Base(newname)] = node
+	now := fsys.clock.Now()
+	oldParent.modTime = now
+	newParent.modTime = now
+	fsys.watchers.notify(writefs.OpRename, oldname)
+	fsys.watchers.notify(writefs.OpCreate, newname)
+	return nil
+}
+
+// StatVFS implements writefs.StatVFSFS
+// Usage is the total size of all files and the
+// number of all files and directories but the root,
+// and it's reported relative to the Quota of the file system.
+func (fsys *TreeFS) StatVFS(name string) (writefs.StatFSInfo, error) {
+	if _, err := fsys.Stat(name); err != nil {
+		return writefs.StatFSInfo{}, writefs.NewPathError("statvfs", name, err)
+	}
+	fsys.lock.RLock()
+	defer fsys.lock.RUnlock()
+	return fsys.Quota.statFSInfo(fsys.bytes, fsys.inodes), nil
+}
+
+// usedBytes returns the total size of the files.
+// It must be called with the lock held.
+func (fsys *TreeFS) usedBytes() uint64 {
+	return fsys.bytes
+}
+
+// usedInodes returns the number of files and directories.
+// It must be called with the lock held.
+func (fsys *TreeFS) usedInodes() uint64 {
+	return fsys.inodes
+}
+
+// Chmod implements writefs.ChmodFS
+func (fsys *TreeFS) Chmod(name string, mode fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+
+	node, err := fsys.lookup(name)
+	if err != nil {
+		return &fs.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	node.mode = node.mode&fs.ModeType | mode&^fs.ModeType
+	fsys.watchers.notify(writefs.OpChmod, name)
+	return nil
+}
+
+// Chtimes implements writefs.ChtimesFS
+// Access times are not tracked and atime is ignored.
+func (fsys *TreeFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrInvalid}
+	}
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+
+	node, err := fsys.lookup(name)
+	if err != nil {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	node.modTime = mtime
+	fsys.watchers.notify(writefs.OpChmod, name)
+	return nil
+}
+
+// HashRanges implements writefs.RangeHashFS
+func (fsys *TreeFS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	return writefs.ReadHashRanges(fsys, name, algo, size)
+}
+
+// Watch implements writefs.WatchFS
+// Events are sent synchronously by every
+// mutation of the file system.
+func (fsys *TreeFS) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	if _, err := fsys.Stat(name); err != nil {
+		return nil, writefs.NewPathError("watch", name, err)
+	}
+	return fsys.watchers.watch(ctx, name, recursive), nil
+}
+
+// treeFileInfo is a snapshot of the attributes of
+// an inode. It's used both as fs.FileInfo and as
+// fs.DirEntry.
+type treeFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	inode   Inode
+}
+
+func (info *treeFileInfo) Name() string               { return info.name }
+func (info *treeFileInfo) Size() int64                { return info.size }
+func (info *treeFileInfo) Mode() fs.FileMode          { return info.mode }
+func (info *treeFileInfo) Type() fs.FileMode          { return info.mode.Type() }
+func (info *treeFileInfo) ModTime() time.Time         { return info.modTime }
+func (info *treeFileInfo) IsDir() bool                { return info.mode.IsDir() }
+func (info *treeFileInfo) Info() (fs.FileInfo, error) { return info, nil }
+
+// Sys returns an *Inode.
+func (info *treeFileInfo) Sys() interface{} {
+	inode := info.inode
+	return &inode
+}
+
+// treeDir is an open directory. Its entries
+// are read when the directory is opened.
+type treeDir struct {
+	info    *treeFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *treeDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *treeDir) Read(buf []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: writefs.ErrIsDir}
+}
+
+func (d *treeDir) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile
+func (d *treeDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := len(d.entries) - d.offset
+	if count > 0 && remaining == 0 {
+		return nil, io.EOF
+	}
+	if count <= 0 || count > remaining {
+		count = remaining
+	}
+	entries := d.entries[d.offset : d.offset+count]
+	d.offset += count
+	return entries, nil
+}
+
+// treeFile is an open file. Its data is accessed
+// with the lock of its file system held, while its
+// own lock protects the offset of the handle.
+type treeFile struct {
+	fsys     *TreeFS
+	node     *inode
+	name     string
+	readable bool
+	writable bool
+	append   bool
+
+	lock   sync.Mutex
+	offset int64
+	closed bool
+}
+
+var (
+	_ io.ReaderAt = &treeFile{}
+	_ io.WriterAt = &treeFile{}
+	_ io.Seeker   = &treeFile{}
+)
+
+// check returns an error if the file is
+// closed or if it cannot be used for op.
+func (f *treeFile) check(op string, allowed bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if !allowed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (f *treeFile) Stat() (fs.FileInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.check("stat", true); err != nil {
+		return nil, err
+	}
+
+	f.fsys.lock.RLock()
+	defer f.fsys.lock.RUnlock()
+	return f.node.info(f.name), nil
+}
+
+func (f *treeFile) Read(buf []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.check("read", f.readable); err != nil {
+		return 0, err
+	}
+
+	f.fsys.lock.RLock()
+	defer f.fsys.lock.RUnlock()
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(buf, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+// ReadAt implements io.ReaderAt
+func (f *treeFile) ReadAt(buf []byte, off int64) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.check("readat", f.readable); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.fsys.lock.RLock()
+	defer f.fsys.lock.RUnlock()
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(buf, f.node.data[off:])
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Seek implements io.Seeker
+func (f *treeFile) Seek(offset int64, whence int) (int64, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.check("seek", true); err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		f.fsys.lock.RLock()
+		offset += int64(len(f.node.data))
+		f.fsys.lock.RUnlock()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *treeFile) Write(buf []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.check("write", f.writable); err != nil {
+		return 0, err
+	}
+
+	f.fsys.lock.Lock()
+	defer f.fsys.lock.Unlock()
+	if f.append {
+		f.offset = int64(len(f.node.data))
+	}
+	n, err := f.writeAt(buf, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt
+func (f *treeFile) WriteAt(buf []byte, off int64) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.check("writeat", f.writable); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.fsys.lock.Lock()
+	defer f.fsys.lock.Unlock()
+	return f.writeAt(buf, off)
+}
+
+// writeAt writes buf at offset off of the file data.
+// Writes that exceed the Quota of the file system
+// write the bytes that fit and return an error.
+// It must be called with the write lock of the file
+// system held.
+func (f *treeFile) writeAt(buf []byte, off int64) (int, error) {
+	var err error
+	maxSize := f.fsys.Quota.maxSize(uint64(len(f.node.data)), f.fsys.usedBytes)
+	if uint64(off)+uint64(len(buf)) > maxSize {
+		buf = buf[:remaining(maxSize, uint64(off))]
+		err = noSpace("write", f.name)
+		if len(buf) == 0 {
+			return 0, err
+		}
+	}
+
+	if end := int(off) + len(buf); end > len(f.node.data) {
+		f.resize(end)
+	}
+	copy(f.node.data[off:], buf)
+	f.node.modTime = f.fsys.clock.Now()
+	f.fsys.watchers.notify(writefs.OpWrite, f.name)
+	return len(buf), err
+}
+
+// resize changes the size of the file data, updating
+// the usage of the file system unless the file was
+// removed. It must be called with the write lock of
+// the file system held.
+func (f *treeFile) resize(size int) {
+	if f.node.unlinked {
+		f.node.data = resize(f.node.data, size)
+		return
+	}
+	f.fsys.bytes -= uint64(len(f.node.data))
+	f.node.data = resize(f.node.data, size)
+	f.fsys.bytes += uint64(size)
+}
+
+// Truncate changes the size of the file.
+func (f *treeFile) Truncate(size int64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.check("truncate", f.writable); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.fsys.lock.Lock()
+	defer f.fsys.lock.Unlock()
+	if uint64(size) > f.fsys.Quota.maxSize(uint64(len(f.node.data)), f.fsys.usedBytes) {
+		return noSpace("truncate", f.name)
+	}
+	f.resize(int(size))
+	f.node.modTime = f.fsys.clock.Now()
+	f.fsys.watchers.notify(writefs.OpWrite, f.name)
+	return nil
+}
+
+func (f *treeFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.check("close", true); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+// resize returns data resized to size bytes.
+// Bytes added to data are zeroed.
+func resize(data []byte, size int) []byte {
+	if size <= len(data) {
+		return data[:size]
+	}
+	if size > cap(data) {
+		grown := make([]byte, size, 2*size)
+		copy(grown, data)
+		return grown
+	}
+	old := len(data)
+	data = data[:size]
+	for i := old; i < size; i++ {
+		data[i] = 0
+	}
+	return data
+}
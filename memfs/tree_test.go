@@ -0,0 +1,168 @@
+package memfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/parro-it/vs/writefs"
+	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeFS(t *testing.T) {
+	clock := writefstest.NewClock()
+	t.Run("Pass writefstest.TestFS", writefstest.TestFS(NewTree(WithClock(clock)), writefstest.WithClock(clock)))
+
+	t.Run("directories must be created before their entries", func(t *testing.T) {
+		fsys := NewTree()
+		_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+		_, err = fs.Stat(fsys, "adir")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		err = writefs.MkDir(fsys, "adir/afile/nested", fs.FileMode(0755))
+		assert.True(t, errors.Is(err, writefs.ErrNotDir))
+	})
+
+	t.Run("Sys reports inode numbers and link counts", func(t *testing.T) {
+		fsys := NewTree()
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		assert.NoError(t, writefs.MkDir(fsys, "adir/nested", fs.FileMode(0755)))
+		_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		inode := func(name string) Inode {
+			info, err := fs.Stat(fsys, name)
+			assert.NoError(t, err)
+			return *info.Sys().(*Inode)
+		}
+		assert.Equal(t, Inode{Ino: 1, Nlink: 3}, inode("."))
+		assert.Equal(t, Inode{Ino: 2, Nlink: 3}, inode("adir"))
+		assert.Equal(t, Inode{Ino: 3, Nlink: 2}, inode("adir/nested"))
+		assert.Equal(t, Inode{Ino: 4, Nlink: 1}, inode("adir/afile"))
+
+		assert.NoError(t, writefs.Remove(fsys, "adir/afile"))
+		_, err = writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, Inode{Ino: 5, Nlink: 1}, inode("adir/afile"))
+	})
+
+	t.Run("files opened read-only cannot be written", func(t *testing.T) {
+		fsys := NewTree()
+		_, err := writefs.WriteFile(fsys, "afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		f, err := fsys.Open("afile")
+		assert.NoError(t, err)
+		_, err = f.(io.Writer).Write([]byte("miao\n"))
+		assert.True(t, errors.Is(err, fs.ErrPermission))
+		assert.NoError(t, f.Close())
+		assert.True(t, errors.Is(f.Close(), fs.ErrClosed))
+	})
+
+	t.Run("removed files don't count in usage", func(t *testing.T) {
+		fsys := NewTree()
+		f, err := writefs.OpenFile(fsys, "afile", os.O_CREATE|os.O_WRONLY, fs.FileMode(0644))
+		assert.NoError(t, err)
+		_, err = f.Write([]byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.Remove(fsys, "afile"))
+
+		_, err = f.Write([]byte("miao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, f.(interface{ Truncate(int64) error }).Truncate(100))
+		assert.NoError(t, f.Close())
+
+		info, err := writefs.StatVFS(fsys, ".")
+		assert.NoError(t, err)
+		assert.Equal(t, info.TotalBytes, info.FreeBytes)
+	})
+
+	t.Run("Rename moves inodes", func(t *testing.T) {
+		fsys := NewTree()
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err := writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		_, err = writefs.WriteFile(fsys, "bfile", []byte("miao\n"))
+		assert.NoError(t, err)
+		before, err := fs.Stat(fsys, "bfile")
+		assert.NoError(t, err)
+
+		assert.NoError(t, writefs.Rename(fsys, "bfile", "adir/afile"))
+		after, err := fs.Stat(fsys, "adir/afile")
+		assert.NoError(t, err)
+		assert.Equal(t, before.Sys(), after.Sys())
+		info, err := writefs.StatVFS(fsys, ".")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(5), info.TotalBytes-info.FreeBytes)
+
+		err = writefs.Rename(fsys, "adir/afile", "adir")
+		assert.True(t, errors.Is(err, writefs.ErrIsDir))
+		assert.NoError(t, writefs.Rename(fsys, "adir", "bdir"))
+		_, err = fs.Stat(fsys, "bdir/afile")
+		assert.NoError(t, err)
+	})
+
+	t.Run("supports concurrent writers", func(t *testing.T) {
+		fsys := NewTree()
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		log, err := writefs.OpenFile(fsys, "adir/log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, fs.FileMode(0644))
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				name := fmt.Sprintf("adir/file%d", i)
+				for j := 0; j < 10; j++ {
+					_, err := writefs.WriteFile(fsys, name, []byte(name))
+					assert.NoError(t, err)
+					_, err = fs.ReadDir(fsys, "adir")
+					assert.NoError(t, err)
+					_, err = log.Write([]byte("0123456789"))
+					assert.NoError(t, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		assert.NoError(t, log.Close())
+
+		entries, err := fs.ReadDir(fsys, "adir")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 11)
+		buf, err := fs.ReadFile(fsys, "adir/log")
+		assert.NoError(t, err)
+		assert.Len(t, buf, 1000)
+	})
+
+	t.Run("Watch reports mutations", func(t *testing.T) {
+		fsys := NewTree()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := writefs.Watch(ctx, fsys, ".", true)
+		assert.NoError(t, err)
+
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(fsys, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.Remove(fsys, "adir/afile"))
+
+		assert.Equal(t, []string{
+			"CREATE adir",
+			"CREATE adir/afile",
+			"WRITE adir/afile",
+			"REMOVE adir/afile",
+		}, nextEvents(events, 5))
+	})
+}
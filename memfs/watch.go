@@ -0,0 +1,132 @@
+package memfs
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// watchers delivers the events of the mutations
+// of a MapWriteFS to its active watchers.
+type watchers struct {
+	lock sync.Mutex
+	list map[*watcher]struct{}
+}
+
+func newWatchers() *watchers {
+	return &watchers{list: map[*watcher]struct{}{}}
+}
+
+// watcher queues the events of a watch, so that
+// mutations never block waiting for the receiver.
+type watcher struct {
+	name      string
+	recursive bool
+
+	lock  sync.Mutex
+	queue []writefs.Event
+	ready chan struct{}
+}
+
+func (w *watcher) push(ev writefs.Event) {
+	w.lock.Lock()
+	w.queue = append(w.queue, ev)
+	w.lock.Unlock()
+
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) pop() []writefs.Event {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	events := w.queue
+	w.queue = nil
+	return events
+}
+
+// notify sends an event to all the watchers
+// interested in name. It does nothing on file
+// systems without watchers.
+func (ws *watchers) notify(op writefs.Op, name string) {
+	if ws == nil {
+		return
+	}
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	ev := writefs.Event{Op: op, Path: name}
+	for w := range ws.list {
+		if ev.Matches(w.name, w.recursive) {
+			w.push(ev)
+		}
+	}
+}
+
+func (ws *watchers) add(w *watcher) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.list[w] = struct{}{}
+}
+
+func (ws *watchers) remove(w *watcher) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	delete(ws.list, w)
+}
+
+// Watch implements writefs.WatchFS
+// Events are sent synchronously by every mutation of
+// the file system. File systems not created with New
+// or NewFS are watched with writefs.PollWatch.
+func (fsys MapWriteFS) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	if fsys.watchers == nil {
+		return writefs.PollWatch(ctx, fsys, name, recursive, writefs.DefaultPollInterval)
+	}
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "watch", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, err := fsys.Stat(name); err != nil {
+		return nil, writefs.NewPathError("watch", name, err)
+	}
+
+	return fsys.watchers.watch(ctx, name, recursive), nil
+}
+
+// watch returns a channel that receives the events
+// notified for name, until ctx is done.
+func (ws *watchers) watch(ctx context.Context, name string, recursive bool) <-chan writefs.Event {
+	w := &watcher{
+		name:      name,
+		recursive: recursive,
+		ready:     make(chan struct{}, 1),
+	}
+	ws.add(w)
+
+	events := make(chan writefs.Event)
+	go func() {
+		defer close(events)
+		defer ws.remove(w)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.ready:
+			}
+
+			for _, ev := range w.pop() {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
@@ -0,0 +1,26 @@
+// Package metricsfs provides a file system wrapper that
+// collects metrics of the calls to the file system it
+// wraps, and exposes them in the Prometheus text format.
+package metricsfs
+
+import (
+	"io/fs"
+
+	"github.com/parro-it/vs/mountedfs"
+	"github.com/parro-it/vs/tracefs"
+)
+
+// New returns a file system that records the metrics
+// of the calls to fsys, and to the files it opens, in
+// registry, labelled with name. The returned file system
+// is a tracefs one, that uses registry as its tracer.
+func New(fsys fs.FS, name string, registry *Registry) fs.FS {
+	return tracefs.NewMount(name, fsys, registry)
+}
+
+// Mounted returns a copy of mfs whose file systems record
+// the metrics of their calls in registry, labelled with
+// the names they are mounted with.
+func Mounted(mfs mountedfs.MountedFS, registry *Registry) mountedfs.MountedFS {
+	return tracefs.Mounted(mfs, registry)
+}
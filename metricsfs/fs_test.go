@@ -0,0 +1,123 @@
+package metricsfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parro-it/vs/memfs"
+	"github.com/parro-it/vs/mountedfs"
+	"github.com/parro-it/vs/tracefs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func exposition(t *testing.T, registry *Registry) string {
+	var out bytes.Buffer
+	n, err := registry.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(out.Len()), n)
+	return out.String()
+}
+
+func TestMetricsFS(t *testing.T) {
+	t.Run("pass writefstest.TestFS", func(t *testing.T) {
+		fsys := New(memfs.New(), "mem", NewRegistry())
+		t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys.(writefs.WriteFS)))
+	})
+
+	t.Run("counts operations, errors and bytes", func(t *testing.T) {
+		registry := NewRegistry()
+		fsys := New(memfs.New(), "mem", registry)
+
+		_, err := writefs.WriteFile(fsys, "afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		_, err = writefs.WriteFile(fsys, "bfile", []byte("miao\n"))
+		assert.NoError(t, err)
+		f, err := fsys.Open("afile")
+		assert.NoError(t, err)
+		_, err = io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		_, err = fs.Stat(fsys, "missing")
+		assert.Error(t, err)
+		assert.Error(t, writefs.MkDir(fsys, "afile", fs.FileMode(0755)))
+
+		out := exposition(t, registry)
+		for _, line := range []string{
+			`vs_fs_operations_total{fs="mem",op="OpenFile"} 2`,
+			`vs_fs_operations_total{fs="mem",op="File.Write"} 2`,
+			`vs_fs_operations_total{fs="mem",op="Open"} 1`,
+			`vs_fs_operations_total{fs="mem",op="Stat"} 1`,
+			`vs_fs_errors_total{fs="mem",op="Stat",kind="not_exist"} 1`,
+			`vs_fs_errors_total{fs="mem",op="MkDir",kind="exist"} 1`,
+			`vs_fs_bytes_total{fs="mem",op="File.Write"} 10`,
+			`vs_fs_bytes_total{fs="mem",op="File.Read"} 5`,
+			`vs_fs_operation_duration_seconds_count{fs="mem",op="OpenFile"} 2`,
+			`vs_fs_operation_duration_seconds_bucket{fs="mem",op="Stat",le="+Inf"} 1`,
+		} {
+			assert.Contains(t, out, line+"\n")
+		}
+		assert.NotContains(t, out, `vs_fs_errors_total{fs="mem",op="File.Read"`)
+	})
+
+	t.Run("latency histograms", func(t *testing.T) {
+		registry := NewRegistry(1, 0.01, 0.1)
+		call := tracefs.Call{Mount: "remote", Op: "Stat", Path: "afile"}
+		registry.observe(call, 5*time.Millisecond, 0, nil)
+		registry.observe(call, 50*time.Millisecond, 0, nil)
+		registry.observe(call, 2*time.Second, 0, fs.ErrPermission)
+
+		assert.Equal(t, `# HELP vs_fs_operations_total Number of file system operations.
+# TYPE vs_fs_operations_total counter
+vs_fs_operations_total{fs="remote",op="Stat"} 3
+# HELP vs_fs_errors_total Number of failed file system operations, by kind of error.
+# TYPE vs_fs_errors_total counter
+vs_fs_errors_total{fs="remote",op="Stat",kind="permission"} 1
+# HELP vs_fs_bytes_total Number of bytes read or written by file system operations.
+# TYPE vs_fs_bytes_total counter
+# HELP vs_fs_operation_duration_seconds Duration of file system operations.
+# TYPE vs_fs_operation_duration_seconds histogram
+vs_fs_operation_duration_seconds_bucket{fs="remote",op="Stat",le="0.01"} 1
+vs_fs_operation_duration_seconds_bucket{fs="remote",op="Stat",le="0.1"} 2
+vs_fs_operation_duration_seconds_bucket{fs="remote",op="Stat",le="1"} 2
+vs_fs_operation_duration_seconds_bucket{fs="remote",op="Stat",le="+Inf"} 3
+vs_fs_operation_duration_seconds_sum{fs="remote",op="Stat"} 2.055
+vs_fs_operation_duration_seconds_count{fs="remote",op="Stat"} 3
+`, exposition(t, registry))
+	})
+
+	t.Run("labels mounted file systems", func(t *testing.T) {
+		registry := NewRegistry()
+		fsys := Mounted(mountedfs.MountedFS{
+			"mem1":   memfs.New(),
+			"mem\"2": memfs.New(),
+		}, registry)
+		_, err := writefs.WriteFile(fsys, "mem1/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		_, err = fs.Stat(fsys, "mem\"2/afile")
+		assert.Error(t, err)
+
+		out := exposition(t, registry)
+		assert.Contains(t, out, `vs_fs_bytes_total{fs="mem1",op="File.Write"} 5`+"\n")
+		assert.Contains(t, out, `vs_fs_errors_total{fs="mem\"2",op="Stat",kind="not_exist"} 1`+"\n")
+	})
+
+	t.Run("serve metrics over http", func(t *testing.T) {
+		registry := NewRegistry()
+		fsys := New(memfs.New(), "mem", registry)
+		_, err := fs.Stat(fsys, ".")
+		assert.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		assert.Equal(t, 200, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+		assert.Contains(t, rec.Body.String(), `vs_fs_operations_total{fs="mem",op="Stat"} 1`+"\n")
+	})
+}
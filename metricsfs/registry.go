@@ -0,0 +1,236 @@
+package metricsfs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parro-it/vs/tracefs"
+	"github.com/parro-it/vs/writefs"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the
+// buckets of the latency histograms of a Registry created
+// without buckets. They range from 100µs to 10s.
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// errorKind returns the kind of err: its writefs.ErrorCode,
+// "canceled" or "deadline_exceeded" for context errors,
+// or "other" for errors that match none of them.
+func errorKind(err error) string {
+	if code := writefs.ErrorCode(err); code != "" {
+		return code
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	}
+	return "other"
+}
+
+// Registry collects metrics of the calls to the file
+// systems that use it as tracefs.Tracer, labelled with
+// the name of the file system and of the operation:
+//
+// * vs_fs_operations_total counts the calls.
+// * vs_fs_errors_total counts the failed calls, by kind of error.
+// * vs_fs_bytes_total counts the bytes read or written.
+// * vs_fs_operation_duration_seconds is an histogram of latencies.
+//
+// io.EOF returned by reads is not counted as an error.
+// A Registry is safe for concurrent use.
+type Registry struct {
+	// lock protects ops
+	lock    sync.Mutex
+	buckets []float64
+	ops     map[opKey]*opStats
+}
+
+// opKey identifies an operation
+// on a named file system.
+type opKey struct {
+	fs string
+	op string
+}
+
+// opStats are the metrics of an operation.
+type opStats struct {
+	count  uint64
+	bytes  uint64
+	errors map[string]uint64
+	// buckets counts the calls that last up
+	// to the upper bound of each bucket
+	buckets []uint64
+	seconds float64
+}
+
+var _ tracefs.Tracer = &Registry{}
+var _ http.Handler = &Registry{}
+
+// NewRegistry returns an empty registry whose latency
+// histograms have buckets with the given upper bounds,
+// in seconds. DefaultBuckets are used if none is given.
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Registry{
+		buckets: buckets,
+		ops:     map[opKey]*opStats{},
+	}
+}
+
+// Start implements tracefs.Tracer
+func (r *Registry) Start(ctx context.Context, call tracefs.Call) (context.Context, tracefs.Span) {
+	return ctx, &span{registry: r, call: call}
+}
+
+type span struct {
+	registry *Registry
+	call     tracefs.Call
+}
+
+func (s *span) End(bytes int64, err error) {
+	s.registry.observe(s.call, time.Since(s.call.Start), bytes, err)
+}
+
+// observe records a call that lasted d, transferred
+// bytes and returned err.
+func (r *Registry) observe(call tracefs.Call, d time.Duration, bytes int64, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := opKey{fs: call.Mount, op: call.Op}
+	stats, ok := r.ops[key]
+	if !ok {
+		stats = &opStats{
+			errors:  map[string]uint64{},
+			buckets: make([]uint64, len(r.buckets)),
+		}
+		r.ops[key] = stats
+	}
+
+	stats.count++
+	if bytes > 0 {
+		stats.bytes += uint64(bytes)
+	}
+	if err != nil && err != io.EOF {
+		stats.errors[errorKind(err)]++
+	}
+	seconds := d.Seconds()
+	stats.seconds += seconds
+	for i, bound := range r.buckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+}
+
+// WriteTo writes the metrics of r to w in the Prometheus
+// text exposition format. It implements io.WriterTo.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	keys := make([]opKey, 0, len(r.ops))
+	for key := range r.ops {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].fs != keys[j].fs {
+			return keys[i].fs < keys[j].fs
+		}
+		return keys[i].op < keys[j].op
+	})
+
+	counter := &countingWriter{w: w}
+	out := bufio.NewWriter(counter)
+	header := func(name string, typ string, help string) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("vs_fs_operations_total", "counter", "Number of file system operations.")
+	for _, key := range keys {
+		fmt.Fprintf(out, "vs_fs_operations_total{%s} %d\n", key.labels(), r.ops[key].count)
+	}
+
+	header("vs_fs_errors_total", "counter", "Number of failed file system operations, by kind of error.")
+	for _, key := range keys {
+		errs := r.ops[key].errors
+		kinds := make([]string, 0, len(errs))
+		for kind := range errs {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(out, "vs_fs_errors_total{%s,kind=%s} %d\n", key.labels(), labelValue(kind), errs[kind])
+		}
+	}
+
+	header("vs_fs_bytes_total", "counter", "Number of bytes read or written by file system operations.")
+	for _, key := range keys {
+		if stats := r.ops[key]; stats.bytes > 0 {
+			fmt.Fprintf(out, "vs_fs_bytes_total{%s} %d\n", key.labels(), stats.bytes)
+		}
+	}
+
+	header("vs_fs_operation_duration_seconds", "histogram", "Duration of file system operations.")
+	for _, key := range keys {
+		stats := r.ops[key]
+		for i, bound := range r.buckets {
+			fmt.Fprintf(out, "vs_fs_operation_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				key.labels(), strconv.FormatFloat(bound, 'g', -1, 64), stats.buckets[i])
+		}
+		fmt.Fprintf(out, "vs_fs_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key.labels(), stats.count)
+		fmt.Fprintf(out, "vs_fs_operation_duration_seconds_sum{%s} %s\n", key.labels(), strconv.FormatFloat(stats.seconds, 'g', -1, 64))
+		fmt.Fprintf(out, "vs_fs_operation_duration_seconds_count{%s} %d\n", key.labels(), stats.count)
+	}
+
+	err := out.Flush()
+	return counter.n, err
+}
+
+// ServeHTTP implements http.Handler
+// It responds with the metrics of r in the
+// Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// labels returns the labels of the metrics of k.
+func (k opKey) labels() string {
+	return "fs=" + labelValue(k.fs) + ",op=" + labelValue(k.op)
+}
+
+// labelValue returns value quoted and
+// escaped as a Prometheus label value.
+func labelValue(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(buf []byte) (int, error) {
+	n, err := c.w.Write(buf)
+	c.n += int64(n)
+	return n, err
+}
@@ -1,11 +1,17 @@
 package mountedfs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
+	"math"
+	"os"
+	"path"
 	"strings"
-	"syscall"
+	"sync"
 	"testing/fstest"
+	"time"
 
 	"github.com/parro-it/vs/writefs"
 )
@@ -37,13 +43,38 @@ import (
 // * fs.StatFS
 // * fs.SubFS
 // * writefs.WriteFS
+// * writefs.StatVFSFS
+// * writefs.HashFS
+// * writefs.RangeHashFS
+// * writefs.ChmodFS
+// * writefs.ChtimesFS
+// * writefs.WatchFS
+// * writefs.ReadLinkFS
+// * writefs.RenameFS
+// * writefs.OpenFileContextFS
+// * writefs.MkDirContextFS
+// * writefs.RemoveContextFS
+// * writefs.StatContextFS
 type MountedFS map[string]fs.FS
 
 var (
-	_ fs.StatFS       = MountedFS(nil)
-	_ fs.ReadFileFS   = MountedFS(nil)
-	_ fs.SubFS        = MountedFS(nil)
-	_ writefs.WriteFS = MountedFS(nil)
+	_ fs.StatFS           = MountedFS(nil)
+	_ fs.ReadFileFS       = MountedFS(nil)
+	_ fs.SubFS            = MountedFS(nil)
+	_ writefs.WriteFS     = MountedFS(nil)
+	_ writefs.StatVFSFS   = MountedFS(nil)
+	_ writefs.HashFS      = MountedFS(nil)
+	_ writefs.RangeHashFS = MountedFS(nil)
+	_ writefs.ChmodFS     = MountedFS(nil)
+	_ writefs.ChtimesFS   = MountedFS(nil)
+	_ writefs.WatchFS     = MountedFS(nil)
+	_ writefs.ReadLinkFS  = MountedFS(nil)
+	_ writefs.RenameFS    = MountedFS(nil)
+
+	_ writefs.OpenFileContextFS = MountedFS(nil)
+	_ writefs.MkDirContextFS    = MountedFS(nil)
+	_ writefs.RemoveContextFS   = MountedFS(nil)
+	_ writefs.StatContextFS     = MountedFS(nil)
 )
 
 // Stat implements fs.StatFS
@@ -54,7 +85,7 @@ func (f MountedFS) Stat(name string) (fs.FileInfo, error) {
 		// adjust its file name.
 		return newMemDirInfo("."), nil
 	}
-	rpath := f.pickRemotePath(name)
+	rpath := f.pickRemotePath("stat", name)
 	if rpath.Error != nil {
 		return nil, rpath.Error
 	}
@@ -65,23 +96,25 @@ func (f MountedFS) Stat(name string) (fs.FileInfo, error) {
 		return newMemDirInfo(rpath.FsName), nil
 	}
 
-	return fs.Stat(rpath.Fs, rpath.Path)
+	info, err := fs.Stat(rpath.Fs, rpath.Path)
+	return info, rpath.fixErr(err)
 }
 
 // ReadFile implements fs.ReadFileFS
 func (f MountedFS) ReadFile(name string) ([]byte, error) {
 	if name == "." {
-		return nil, syscall.EISDIR
+		return nil, &fs.PathError{Op: "read", Path: name, Err: writefs.ErrIsDir}
 	}
-	rpath := f.pickRemotePath(name)
+	rpath := f.pickRemotePath("read", name)
 	if rpath.Error != nil {
 		return nil, rpath.Error
 	}
 	if rpath.Path == "." {
-		return nil, syscall.EISDIR
+		return nil, &fs.PathError{Op: "read", Path: name, Err: writefs.ErrIsDir}
 	}
 
-	return fs.ReadFile(rpath.Fs, rpath.Path)
+	buf, err := fs.ReadFile(rpath.Fs, rpath.Path)
+	return buf, rpath.fixErr(err)
 }
 
 // Sub implements fs.SubFS
@@ -89,37 +122,338 @@ func (f MountedFS) Sub(dir string) (fs.FS, error) {
 	if dir == "." {
 		return f, nil
 	}
-	rpath := f.pickRemotePath(dir)
+	rpath := f.pickRemotePath("sub", dir)
 	if rpath.Error != nil {
 		return nil, rpath.Error
 	}
 
-	if rpath.Path == "." {
-		return rpath.Fs, nil
+	if _, ok := rpath.Fs.(writefs.WriteFS); ok {
+		sub, err := writefs.Sub(rpath.Fs, rpath.Path)
+		return sub, rpath.fixErr(err)
 	}
-
-	return fs.Sub(rpath.Fs, rpath.Path)
+	sub, err := fs.Sub(rpath.Fs, rpath.Path)
+	return sub, rpath.fixErr(err)
 }
 
 // OpenFile implements writefs.WriteFS
+// The root directory and the mount points
+// cannot be created, removed or written.
 func (f MountedFS) OpenFile(name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	op := writefs.OpenFileOp(flag, perm)
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	rpath := remotePath{Path: "."}
+	if name != "." {
+		rpath = f.pickRemotePath(op, name)
+		if rpath.Error != nil {
+			return nil, rpath.Error
+		}
+	}
+	if rpath.Path == "." {
+		switch op {
+		case "mkdir":
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+		case "remove":
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+		}
+		return nil, &fs.PathError{Op: op, Path: name, Err: writefs.ErrIsDir}
+	}
+
+	file, err := writefs.OpenFile(rpath.Fs, rpath.Path, flag, perm)
+	return file, rpath.fixErr(err)
+}
+
+// StatVFS implements writefs.StatVFSFS
+// The usage of the root directory is the sum
+// of the usage of all mounted file systems
+// that implement writefs.StatVFSFS.
+func (f MountedFS) StatVFS(name string) (writefs.StatFSInfo, error) {
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return writefs.StatFSInfo{}, &fs.PathError{Op: "statvfs", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name != "." {
+		rpath := f.pickRemotePath("statvfs", name)
+		if rpath.Error != nil {
+			return writefs.StatFSInfo{}, rpath.Error
+		}
+		info, err := writefs.StatVFS(rpath.Fs, rpath.Path)
+		return info, rpath.fixErr(err)
+	}
+
+	var total writefs.StatFSInfo
+	found := false
+	for _, fsys := range f {
+		if _, ok := fsys.(writefs.StatVFSFS); !ok {
+			continue
+		}
+		info, err := writefs.StatVFS(fsys, ".")
+		if err != nil {
+			return writefs.StatFSInfo{}, err
+		}
+		found = true
+		total.TotalBytes = add(total.TotalBytes, info.TotalBytes)
+		total.FreeBytes = add(total.FreeBytes, info.FreeBytes)
+		total.AvailableBytes = add(total.AvailableBytes, info.AvailableBytes)
+		total.TotalInodes = add(total.TotalInodes, info.TotalInodes)
+		total.FreeInodes = add(total.FreeInodes, info.FreeInodes)
+		total.AvailableInodes = add(total.AvailableInodes, info.AvailableInodes)
+	}
+	if !found {
+		return writefs.StatFSInfo{}, fmt.Errorf("%w: no mounted fs supports file system statistics", fs.ErrInvalid)
 	}
+	return total, nil
+}
+
+// add returns a+b, saturating at math.MaxUint64
+// instead of overflowing.
+func add(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
 
+// Hash implements writefs.HashFS
+func (f MountedFS) Hash(name string, algo string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: fs.ErrInvalid}
+	}
 	if name == "." {
-		return nil, syscall.EISDIR
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: writefs.ErrIsDir}
+	}
+	rpath := f.pickRemotePath("hash", name)
+	if rpath.Error != nil {
+		return nil, rpath.Error
+	}
+	if rpath.Path == "." {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: writefs.ErrIsDir}
 	}
 
-	rpath := f.pickRemotePath(name)
+	sum, err := writefs.Hash(rpath.Fs, rpath.Path, algo)
+	return sum, rpath.fixErr(err)
+}
+
+// HashRanges implements writefs.RangeHashFS
+func (f MountedFS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: writefs.ErrIsDir}
+	}
+	rpath := f.pickRemotePath("hash", name)
 	if rpath.Error != nil {
 		return nil, rpath.Error
 	}
 	if rpath.Path == "." {
-		return nil, fs.ErrExist
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: writefs.ErrIsDir}
+	}
+
+	sums, err := writefs.HashRanges(rpath.Fs, rpath.Path, algo, size)
+	return sums, rpath.fixErr(err)
+}
+
+// Chmod implements writefs.ChmodFS
+// The permissions of the root directory and of
+// the mount points cannot be changed.
+func (f MountedFS) Chmod(name string, mode fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrPermission}
+	}
+	rpath := f.pickRemotePath("chmod", name)
+	if rpath.Error != nil {
+		return rpath.Error
+	}
+	if rpath.Path == "." {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrPermission}
+	}
+
+	return rpath.fixErr(writefs.Chmod(rpath.Fs, rpath.Path, mode))
+}
+
+// ReadLink implements writefs.ReadLinkFS
+func (f MountedFS) ReadLink(name string) (string, error) {
+	// the root directory and the mount
+	// points are not symbolic links.
+	if !fs.ValidPath(name) || name == "." {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	rpath := f.pickRemotePath("readlink", name)
+	if rpath.Error != nil {
+		return "", rpath.Error
+	}
+	if rpath.Path == "." {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := writefs.ReadLink(rpath.Fs, rpath.Path)
+	return target, rpath.fixErr(err)
+}
+
+// Rename implements writefs.RenameFS
+// Files can only be renamed within the file
+// system they are mounted from, and the mount
+// points cannot be renamed or replaced.
+func (f MountedFS) Rename(oldname string, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	oldPath := f.pickRemotePath("rename", oldname)
+	if oldPath.Error != nil {
+		return writefs.NewLinkError("rename", oldname, newname, oldPath.Error)
+	}
+	newPath := f.pickRemotePath("rename", newname)
+	if newPath.Error != nil {
+		return writefs.NewLinkError("rename", oldname, newname, newPath.Error)
+	}
+	if oldPath.Path == "." || newPath.Path == "." {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrPermission}
+	}
+	if oldPath.FsName != newPath.FsName {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: writefs.ErrCrossDevice}
+	}
+	err := writefs.Rename(oldPath.Fs, oldPath.Path, newPath.Path)
+	return writefs.NewLinkError("rename", oldname, newname, err)
+}
+
+// Chtimes implements writefs.ChtimesFS
+// The times of the root directory and of
+// the mount points cannot be changed.
+func (f MountedFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrPermission}
+	}
+	rpath := f.pickRemotePath("chtimes", name)
+	if rpath.Error != nil {
+		return rpath.Error
+	}
+	if rpath.Path == "." {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrPermission}
+	}
+
+	return rpath.fixErr(writefs.Chtimes(rpath.Fs, rpath.Path, atime, mtime))
+}
+
+// Watch implements writefs.WatchFS
+// Event paths are prefixed by the name of the mounted
+// fs they come from. Watching the root directory
+// watches the roots of all mounted file systems.
+// Mounted file systems that don't implement
+// writefs.WatchFS are watched with writefs.Watch.
+func (f MountedFS) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "watch", Path: name, Err: fs.ErrInvalid}
+	}
+
+	mounts := map[string]<-chan writefs.Event{}
+	ctx, cancel := context.WithCancel(ctx)
+	if name == "." {
+		for fsName, fsys := range f {
+			events, err := writefs.Watch(ctx, fsys, ".", recursive)
+			if err != nil {
+				cancel()
+				return nil, remotePath{FsName: fsName}.fixErr(err)
+			}
+			mounts[fsName] = events
+		}
+	} else {
+		rpath := f.pickRemotePath("watch", name)
+		if rpath.Error != nil {
+			cancel()
+			return nil, rpath.Error
+		}
+		events, err := writefs.Watch(ctx, rpath.Fs, rpath.Path, recursive)
+		if err != nil {
+			cancel()
+			return nil, rpath.fixErr(err)
+		}
+		mounts[rpath.FsName] = events
+	}
+
+	res := make(chan writefs.Event)
+	var wg sync.WaitGroup
+	for fsName, events := range mounts {
+		wg.Add(1)
+		go func(fsName string, events <-chan writefs.Event) {
+			defer wg.Done()
+			for ev := range events {
+				ev.Path = path.Join(fsName, ev.Path)
+				// watching the root directory not recursively
+				// reports only changes to the mount points.
+				if !ev.Matches(name, recursive) {
+					continue
+				}
+				select {
+				case res <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(fsName, events)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(res)
+	}()
+	return res, nil
+}
+
+// mountedPath returns the remote path of name when
+// it's a file within a mounted fs, and false when
+// it's the root directory, a mount point or invalid.
+func (f MountedFS) mountedPath(op string, name string) (remotePath, bool) {
+	if !fs.ValidPath(name) || name == "." {
+		return remotePath{}, false
+	}
+	rpath := f.pickRemotePath(op, name)
+	return rpath, rpath.Error == nil && rpath.Path != "."
+}
+
+// OpenFileContext implements writefs.OpenFileContextFS
+func (f MountedFS) OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	rpath, ok := f.mountedPath(writefs.OpenFileOp(flag, perm), name)
+	if !ok {
+		return f.OpenFile(name, flag, perm)
+	}
+	file, err := writefs.OpenFileContext(ctx, rpath.Fs, rpath.Path, flag, perm)
+	return file, rpath.fixErr(err)
+}
+
+// MkDirContext implements writefs.MkDirContextFS
+func (f MountedFS) MkDirContext(ctx context.Context, name string, perm fs.FileMode) error {
+	rpath, ok := f.mountedPath("mkdir", name)
+	if !ok {
+		return writefs.MkDir(f, name, perm)
 	}
+	return rpath.fixErr(writefs.MkDirContext(ctx, rpath.Fs, rpath.Path, perm))
+}
 
-	return writefs.OpenFile(rpath.Fs, rpath.Path, flag, perm)
+// RemoveContext implements writefs.RemoveContextFS
+func (f MountedFS) RemoveContext(ctx context.Context, name string) error {
+	rpath, ok := f.mountedPath("remove", name)
+	if !ok {
+		return writefs.Remove(f, name)
+	}
+	return rpath.fixErr(writefs.RemoveContext(ctx, rpath.Fs, rpath.Path))
+}
+
+// StatContext implements writefs.StatContextFS
+func (f MountedFS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	rpath, ok := f.mountedPath("stat", name)
+	if !ok {
+		return f.Stat(name)
+	}
+	info, err := writefs.StatContext(ctx, rpath.Fs, rpath.Path)
+	return info, rpath.fixErr(err)
 }
 
 // Mount add a child file system, using `name`
@@ -131,7 +465,7 @@ func (f MountedFS) Mount(name string, fs fs.FS) {
 // Open opens the named file.
 func (f MountedFS) Open(name string) (fs.File, error) {
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
 	}
 
 	if name == "." {
@@ -140,19 +474,21 @@ func (f MountedFS) Open(name string) (fs.File, error) {
 		return newVirtualRootDir(f), nil
 	}
 
-	rpath := f.pickRemotePath(name)
+	rpath := f.pickRemotePath("open", name)
 	if rpath.Error != nil {
 		return nil, rpath.Error
 	}
 	file, err := rpath.Fs.Open(rpath.Path)
+	if err != nil {
+		return nil, rpath.fixErr(err)
+	}
 	if rpath.Path == "." {
 		// when requested file is the root of
 		// its fs, embed it in a virtualDir to handle
 		// subdir correctly
 		file = &virtualDir{file.(fs.ReadDirFile), rpath.FsName}
 	}
-	return file, err
-
+	return file, nil
 }
 
 // a virtual dir wraps
@@ -232,7 +568,11 @@ type remotePath struct {
 	Error  error
 }
 
-func (f MountedFS) pickRemotePath(name string) remotePath {
+// pickRemotePath returns the mounted fs that contains
+// name and its path within it. When no fs is mounted
+// with the name of the first segment of name, the
+// returned Error is a *fs.PathError for op.
+func (f MountedFS) pickRemotePath(op string, name string) remotePath {
 	res := remotePath{}
 
 	parts := strings.Split(name, "/")
@@ -247,8 +587,18 @@ func (f MountedFS) pickRemotePath(name string) remotePath {
 	var ok bool
 	res.Fs, ok = f[res.FsName]
 	if !ok {
-		res.Error = fmt.Errorf("%w: fs not found: %s", fs.ErrNotExist, res.FsName)
+		res.Error = &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
 	}
 
 	return res
 }
+
+// fixErr prefixes the names reported by PathErrors
+// of the mounted fs with the name of its mount point.
+func (rpath remotePath) fixErr(err error) error {
+	var e *fs.PathError
+	if errors.As(err, &e) {
+		e.Path = path.Join(rpath.FsName, e.Path)
+	}
+	return err
+}
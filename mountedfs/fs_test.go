@@ -1,11 +1,16 @@
 package mountedfs
 
 import (
+	"context"
+	"crypto/sha256"
+	"errors"
 	"io/fs"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/parro-it/vs/memfs"
+	"github.com/parro-it/vs/writefs"
 	"github.com/parro-it/vs/writefstest"
 	"github.com/stretchr/testify/assert"
 )
@@ -55,12 +60,126 @@ func TestMountedFS(t *testing.T) {
 		assert.Equal(t, fs.ModeDir, info.Mode())
 	})
 
+	t.Run("Sub returns a writable fs", writefstest.TestSub(mfs, "dirempty/adir"))
+	t.Run("Sub of mount points returns a writable fs", writefstest.TestSub(mfs, "dirempty"))
+
+	t.Run("Hash checksums files of mounted fs", func(t *testing.T) {
+		sum, err := writefs.Hash(mfs, "c/adir/afile", writefs.SHA256)
+		assert.NoError(t, err)
+		expected := sha256.Sum256(data)
+		assert.Equal(t, expected[:], sum)
+
+		_, err = writefs.Hash(mfs, "c", writefs.SHA256)
+		assert.Error(t, err)
+
+		treeSum, err := writefs.HashTree(mfs, "c", writefs.SHA256)
+		assert.NoError(t, err)
+		expectedTree, err := writefs.HashTree(memfs1, ".", writefs.SHA256)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedTree, treeSum)
+	})
+
+	t.Run("StatVFS aggregates mounted fs usage", func(t *testing.T) {
+		mem1 := memfs.New()
+		mem1.Quota = memfs.Quota{MaxBytes: 100, MaxInodes: 10}
+		mem2 := memfs.New()
+		mem2.Quota = memfs.Quota{MaxBytes: 50, MaxInodes: 5}
+		_, err := writefs.WriteFile(mem2, "afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		mfs := MountedFS{
+			"mem1": mem1,
+			"mem2": mem2,
+			"ro":   fstest.MapFS{},
+		}
+
+		info, err := writefs.StatVFS(mfs, ".")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(150), info.TotalBytes)
+		assert.Equal(t, uint64(145), info.FreeBytes)
+		assert.Equal(t, uint64(15), info.TotalInodes)
+		assert.Equal(t, uint64(14), info.FreeInodes)
+
+		info, err = writefs.StatVFS(mfs, "mem2/afile")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(50), info.TotalBytes)
+		assert.Equal(t, uint64(45), info.FreeBytes)
+
+		_, err = writefs.StatVFS(mfs, "ro")
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+
+	t.Run("Watch prefixes event paths with mount names", func(t *testing.T) {
+		mem1 := memfs.New()
+		mem2 := memfs.New()
+		mfs := MountedFS{"mem1": mem1, "mem2": mem2}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := writefs.Watch(ctx, mfs, ".", true)
+		assert.NoError(t, err)
+
+		_, err = writefs.WriteFile(mfs, "mem1/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"CREATE mem1/afile", "WRITE mem1/afile"}, nextEvents(events, 2))
+		assert.NoError(t, writefs.MkDir(mem2, "adir", fs.FileMode(0755)))
+		assert.Equal(t, []string{"CREATE mem2/adir"}, nextEvents(events, 1))
+
+		cancel()
+		_, ok := <-events
+		assert.False(t, ok)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		events, err = writefs.Watch(ctx, mfs, "mem2/adir", false)
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.MkDir(mfs, "mem2/adir/nested", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(mfs, "mem1/bfile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"CREATE mem2/adir/nested"}, nextEvents(events, 2))
+
+		_, err = writefs.Watch(ctx, mfs, "unknown", false)
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("Rename moves files within a mounted fs", func(t *testing.T) {
+		_, err := writefs.WriteFile(mfs, "dir1/renamed", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.Rename(mfs, "dir1/renamed", "dir1/moved"))
+		buf, err := fs.ReadFile(mfs, "dir1/moved")
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao\n", string(buf))
+
+		err = writefs.Rename(mfs, "dir1/moved", "dirempty/moved")
+		assert.True(t, errors.Is(err, writefs.ErrCrossDevice))
+		err = writefs.Rename(mfs, "dir1", "dirempty")
+		assert.True(t, errors.Is(err, fs.ErrPermission))
+		assert.NoError(t, writefs.Remove(mfs, "dir1/moved"))
+	})
+
 	t.Run("unknown fs", func(t *testing.T) {
 		buf, err := fs.ReadFile(mfs, "f/adir/afile")
 
 		assert.Error(t, err)
-		assert.Equal(t, "file does not exist: fs not found: f", err.Error())
+		assert.Equal(t, "read f/adir/afile: file does not exist", err.Error())
 		assert.Nil(t, buf)
 	})
 
 }
+
+// nextEvents receives events until count
+// are received or no event arrives for a second.
+func nextEvents(events <-chan writefs.Event, count int) []string {
+	var res []string
+	for len(res) < count {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return res
+			}
+			res = append(res, ev.String())
+		case <-time.After(time.Second):
+			return res
+		}
+	}
+	return res
+}
@@ -1,11 +1,10 @@
 package osfs
 
 import (
-	"fmt"
 	"io/fs"
 	"os"
 	"path"
-	"syscall"
+	"time"
 
 	"github.com/parro-it/vs/writefs"
 )
@@ -17,70 +16,74 @@ type osWriteFS struct {
 
 // OpenFile ...
 func (fsinst osWriteFS) OpenFile(name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	op := writefs.OpenFileOp(flag, perm)
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
 	}
 	realPath := path.Join(fsinst.root, name)
 
-	if flag&os.O_CREATE == os.O_CREATE && perm.IsDir() {
-		err := os.Mkdir(realPath, perm)
-		if err != nil {
-			//return nil, fsErr(err, name)
-			if os.IsExist(err) {
-				return nil, fsErr(err, name)
-			}
-			if err == syscall.ENOENT {
-				return nil, fs.ErrNotExist
-			}
-			return nil, err //fmt.Errorf("%w: %s", fmt.Errorf("%w", fs.ErrInvalid), err.Error())
-
-		}
-		return nil, nil
-	}
-
-	if flag == os.O_TRUNC {
-		err := os.Remove(realPath)
-		if err == nil {
-			return nil, nil
-		}
-		//return nil, fsErr(err, name)
-
-		if os.IsNotExist(err) {
-			return nil, err
-		}
-		if err == syscall.ENOENT {
-			return nil, fs.ErrNotExist
-		}
-		if err != syscall.ENOTEMPTY {
-			return nil, &fs.PathError{
-				Err:  fmt.Errorf("%w: directory not empty: %s", fs.ErrInvalid, err.Error()),
-				Path: name,
-			}
-		}
-
-		return nil, err
-
+	switch op {
+	case "mkdir":
+		return nil, writefs.NewPathError(op, name, os.Mkdir(realPath, perm))
+	case "remove":
+		return nil, writefs.NewPathError(op, name, os.Remove(realPath))
 	}
 
 	f, err := os.OpenFile(realPath, flag, perm)
 	if err != nil {
-		return nil, err //fsErr(err, name)
+		return nil, writefs.NewPathError(op, name, err)
 	}
 	return f, nil
 }
 
-func fsErr(err error, name string) error {
-	if os.IsExist(err) {
-		return fmt.Errorf("%w: %s", fs.ErrExist, name)
+// Chmod implements writefs.ChmodFS
+func (fsinst osWriteFS) Chmod(name string, mode fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrInvalid}
+	}
+	return writefs.NewPathError("chmod", name, os.Chmod(path.Join(fsinst.root, name), mode))
+}
+
+// Chtimes implements writefs.ChtimesFS
+func (fsinst osWriteFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrInvalid}
+	}
+	return writefs.NewPathError("chtimes", name, os.Chtimes(path.Join(fsinst.root, name), atime, mtime))
+}
+
+// ReadLink implements writefs.ReadLinkFS
+func (fsinst osWriteFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
 	}
-	if os.IsNotExist(err) {
-		return fmt.Errorf("%w: %s", fs.ErrNotExist, name)
+	target, err := os.Readlink(path.Join(fsinst.root, name))
+	if err != nil {
+		return "", writefs.NewPathError("readlink", name, err)
 	}
-	if os.IsPermission(err) {
-		return fmt.Errorf("%w: %s", fs.ErrPermission, name)
+	return target, nil
+}
+
+// Rename implements writefs.RenameFS
+func (fsinst osWriteFS) Rename(oldname string, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
 	}
+	err := os.Rename(path.Join(fsinst.root, oldname), path.Join(fsinst.root, newname))
+	return writefs.NewLinkError("rename", oldname, newname, err)
+}
 
-	return err
+// HashRanges implements writefs.RangeHashFS
+func (fsinst osWriteFS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	return writefs.ReadHashRanges(fsinst, name, algo, size)
+}
+
+// Sub implements fs.SubFS
+func (fsinst osWriteFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	return DirWriteFS(path.Join(fsinst.root, dir)), nil
 }
 
 // DirWriteFS ...
@@ -1,13 +1,20 @@
 package osfs
 
 import (
+	"context"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/parro-it/vs/writefs"
 	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
 )
 
 func fixtures() writefs.WriteFS {
@@ -36,4 +43,136 @@ func TestOsFS(t *testing.T) {
 	fsys := DirWriteFS("/var/fixtures")
 	t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys))
 
+	t.Run("Sub returns a writable fs", writefstest.TestSub(DirWriteFS("/var/fixtures"), "new-dir"))
+
+	t.Run("StatVFS reports disk usage", func(t *testing.T) {
+		info, err := writefs.StatVFS(fsys, "new-dir")
+		assert.NoError(t, err)
+		assert.Greater(t, info.TotalBytes, uint64(0))
+		assert.LessOrEqual(t, info.FreeBytes, info.TotalBytes)
+		assert.LessOrEqual(t, info.AvailableBytes, info.FreeBytes)
+
+		_, err = writefs.StatVFS(fsys, "unknown")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("Chmod and Chtimes change file attributes", func(t *testing.T) {
+		fsys := DirWriteFS("/var/fixtures")
+		_, err := writefs.WriteFile(fsys, "chfile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		mtime := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+		assert.NoError(t, writefs.Chmod(fsys, "chfile", fs.FileMode(0600)))
+		assert.NoError(t, writefs.Chtimes(fsys, "chfile", mtime, mtime))
+
+		info, err := fs.Stat(fsys, "chfile")
+		assert.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0600), info.Mode())
+		assert.True(t, mtime.Equal(info.ModTime()))
+		assert.NoError(t, writefs.Remove(fsys, "chfile"))
+	})
+
+	t.Run("Rename replaces existing files", func(t *testing.T) {
+		fsys := DirWriteFS(t.TempDir())
+		_, err := writefs.WriteFile(fsys, "afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		_, err = writefs.WriteFile(fsys, "bfile", []byte("miao\n"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, writefs.Rename(fsys, "bfile", "afile"))
+		buf, err := fs.ReadFile(fsys, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "miao\n", string(buf))
+
+		err = writefs.Rename(fsys, "bfile", "cfile")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+		var linkErr *os.LinkError
+		assert.True(t, errors.As(err, &linkErr))
+		assert.Equal(t, "bfile", linkErr.Old)
+	})
+
+	t.Run("ReadLink returns the target of symbolic links", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("symbolic links require privileges on windows")
+		}
+		dir := t.TempDir()
+		assert.NoError(t, os.Symlink("afile", filepath.Join(dir, "alink")))
+		fsys := DirWriteFS(dir)
+
+		target, err := writefs.ReadLink(fsys, "alink")
+		assert.NoError(t, err)
+		assert.Equal(t, "afile", target)
+
+		_, err = writefs.ReadLink(fsys, "missing")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("Watch reports changes", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "osfs")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		fsys := DirWriteFS(dir)
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := writefs.Watch(ctx, fsys, ".", true)
+		assert.NoError(t, err)
+
+		assert.NoError(t, writefs.MkDir(fsys, "adir/nested", fs.FileMode(0755)))
+		assert.Equal(t, []string{"CREATE adir/nested"}, nextEvents(events, 1))
+
+		_, err = writefs.WriteFile(fsys, "adir/nested/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.Chmod(fsys, "adir/nested/afile", fs.FileMode(0600)))
+		assert.NoError(t, os.Rename(path.Join(dir, "adir/nested/afile"), path.Join(dir, "bfile")))
+		assert.NoError(t, writefs.Remove(fsys, "bfile"))
+		assert.Equal(t, []string{
+			"CREATE adir/nested/afile",
+			"WRITE adir/nested/afile",
+			"CHMOD adir/nested/afile",
+			"RENAME adir/nested/afile",
+			"CREATE bfile",
+			"REMOVE bfile",
+		}, nextEvents(events, 6))
+
+		cancel()
+		for range events {
+		}
+	})
+
+	t.Run("Watch reports only direct entries when not recursive", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "osfs")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		fsys := DirWriteFS(dir)
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := writefs.Watch(ctx, fsys, ".", false)
+		assert.NoError(t, err)
+
+		_, err = writefs.WriteFile(fsys, "adir/nested", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.MkDir(fsys, "bdir", fs.FileMode(0755)))
+		assert.Equal(t, []string{"CREATE bdir"}, nextEvents(events, 2))
+	})
+}
+
+// nextEvents receives events until count
+// are received or no event arrives for a second.
+func nextEvents(events <-chan writefs.Event, count int) []string {
+	var res []string
+	for len(res) < count {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return res
+			}
+			res = append(res, ev.String())
+		case <-time.After(time.Second):
+			return res
+		}
+	}
+	return res
 }
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package osfs
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// StatVFS implements writefs.StatVFSFS
+// It's not supported on this platform.
+func (fsinst osWriteFS) StatVFS(name string) (writefs.StatFSInfo, error) {
+	return writefs.StatFSInfo{}, &fs.PathError{
+		Op:   "statvfs",
+		Path: name,
+		Err:  fmt.Errorf("%w: file system statistics not supported on this platform", fs.ErrInvalid),
+	}
+}
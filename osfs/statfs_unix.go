@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package osfs
+
+import (
+	"io/fs"
+	"path"
+	"syscall"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// StatVFS implements writefs.StatVFSFS
+func (fsinst osWriteFS) StatVFS(name string) (writefs.StatFSInfo, error) {
+	if !fs.ValidPath(name) {
+		return writefs.StatFSInfo{}, &fs.PathError{Op: "statvfs", Path: name, Err: fs.ErrInvalid}
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path.Join(fsinst.root, name), &st); err != nil {
+		return writefs.StatFSInfo{}, writefs.NewPathError("statvfs", name, err)
+	}
+
+	bsize := uint64(st.Bsize)
+	return writefs.StatFSInfo{
+		TotalBytes:      uint64(st.Blocks) * bsize,
+		FreeBytes:       uint64(st.Bfree) * bsize,
+		AvailableBytes:  uint64(st.Bavail) * bsize,
+		TotalInodes:     uint64(st.Files),
+		FreeInodes:      uint64(st.Ffree),
+		AvailableInodes: uint64(st.Ffree),
+	}, nil
+}
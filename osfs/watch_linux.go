@@ -0,0 +1,194 @@
+package osfs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// Watch implements writefs.WatchFS
+// Changes are notified by inotify. When recursive is true,
+// a watch is added for every directory of the tree, and the
+// entries of directories created in the tree are reported
+// as created while their watches are added.
+func (fsinst osWriteFS) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "watch", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, err := fs.Stat(fsinst, name); err != nil {
+		return nil, writefs.NewPathError("watch", name, err)
+	}
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, writefs.NewPathError("watch", name, err)
+	}
+	w := &inotifyWatcher{
+		fsinst:    fsinst,
+		name:      name,
+		recursive: recursive,
+		fd:        fd,
+		// a non blocking file is handled by the runtime
+		// poller, so closing it interrupts pending reads.
+		file: os.NewFile(uintptr(fd), "inotify"),
+		wds:  map[int]string{},
+	}
+	if err := w.add(name, false, nil); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	events := make(chan writefs.Event)
+	go func() {
+		<-ctx.Done()
+		w.file.Close()
+	}()
+	go func() {
+		defer close(events)
+		defer w.file.Close()
+		w.run(ctx, events)
+	}()
+	return events, nil
+}
+
+type inotifyWatcher struct {
+	fsinst    osWriteFS
+	name      string
+	recursive bool
+	fd        int
+	file      *os.File
+	// wds maps watch descriptors to the
+	// names of the watched files.
+	wds map[int]string
+}
+
+// add adds a watch for the named file and, for
+// recursive watchers, for all the directories of
+// the tree rooted at it. When report is true, the
+// entries of the tree are appended to created.
+func (w *inotifyWatcher) add(name string, report bool, created *[]writefs.Event) error {
+	if err := w.addWatch(name); err != nil || !w.recursive {
+		return err
+	}
+	return fs.WalkDir(w.fsinst, name, func(entryName string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// entries removed while walking
+			// are reported by their parents.
+			return nil
+		}
+		if entryName == name {
+			return nil
+		}
+		if report {
+			*created = append(*created, writefs.Event{Op: writefs.OpCreate, Path: entryName})
+		}
+		if d.IsDir() {
+			return w.addWatch(entryName)
+		}
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) addWatch(name string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, path.Join(w.fsinst.root, name), inotifyMask)
+	if err != nil {
+		return writefs.NewPathError("watch", name, err)
+	}
+	w.wds[wd] = name
+	return nil
+}
+
+// forget removes the watches of the tree
+// rooted at name, after it has been moved away.
+func (w *inotifyWatcher) forget(name string) {
+	for wd, watched := range w.wds {
+		if watched == name || strings.HasPrefix(watched, name+"/") {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.wds, wd)
+		}
+	}
+}
+
+func (w *inotifyWatcher) run(ctx context.Context, events chan<- writefs.Event) {
+	var buf [64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)]byte
+	for {
+		n, err := w.file.Read(buf[:])
+		if err != nil {
+			return
+		}
+
+		var pending []writefs.Event
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(raw.Len)
+			entry := strings.TrimRight(string(buf[nameStart:offset]), "\x00")
+			pending = w.decode(pending, int(raw.Wd), raw.Mask, entry)
+		}
+
+		for _, ev := range pending {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// decode appends to events the events
+// described by an inotify event.
+func (w *inotifyWatcher) decode(events []writefs.Event, wd int, mask uint32, entry string) []writefs.Event {
+	watched, ok := w.wds[wd]
+	if !ok {
+		return events
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.wds, wd)
+		return events
+	}
+
+	name := watched
+	if entry != "" {
+		name = path.Join(watched, entry)
+	}
+	isDir := mask&syscall.IN_ISDIR != 0
+
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		events = append(events, writefs.Event{Op: writefs.OpCreate, Path: name})
+		if isDir && w.recursive {
+			// errors are ignored: the directory
+			// could have already been removed.
+			w.add(name, true, &events)
+		}
+	case mask&syscall.IN_MODIFY != 0:
+		events = append(events, writefs.Event{Op: writefs.OpWrite, Path: name})
+	case mask&syscall.IN_ATTRIB != 0:
+		events = append(events, writefs.Event{Op: writefs.OpChmod, Path: name})
+	case mask&syscall.IN_DELETE != 0:
+		events = append(events, writefs.Event{Op: writefs.OpRemove, Path: name})
+	case mask&syscall.IN_MOVED_FROM != 0:
+		events = append(events, writefs.Event{Op: writefs.OpRename, Path: name})
+		if isDir {
+			w.forget(name)
+		}
+	// changes to the watched file itself: the ones of
+	// nested directories are reported by their parents.
+	case mask&syscall.IN_DELETE_SELF != 0 && watched == w.name:
+		events = append(events, writefs.Event{Op: writefs.OpRemove, Path: name})
+	case mask&syscall.IN_MOVE_SELF != 0 && watched == w.name:
+		events = append(events, writefs.Event{Op: writefs.OpRename, Path: name})
+	}
+	return events
+}
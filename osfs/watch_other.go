@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package osfs
+
+import (
+	"context"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// Watch implements writefs.WatchFS
+// On this platform, changes are detected by
+// scanning the watched tree with writefs.PollWatch.
+func (fsinst osWriteFS) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	return writefs.PollWatch(ctx, fsinst, name, recursive, writefs.DefaultPollInterval)
+}
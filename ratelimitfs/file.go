@@ -0,0 +1,58 @@
+package ratelimitfs
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/parro-it/vs/internal/wrap"
+	"github.com/parro-it/vs/writefs"
+)
+
+// file limits the bytes read and
+// written through an open file.
+type file struct {
+	fsys *FS
+	name string
+}
+
+var _ wrap.Hooks = file{}
+
+// newFile wraps f, so that it's
+// limited by the limits of fsys.
+func newFile(fsys *FS, name string, f fs.File) writefs.FileWriter {
+	return wrap.NewFile(f, name, file{fsys: fsys, name: name})
+}
+
+// Transfer implements wrap.Hooks
+// Reads wait after the bytes are read,
+// writes before the bytes are written.
+func (f file) Transfer(op wrap.Op, buf []byte, do func([]byte) (int, error)) (int, error) {
+	if op == wrap.Write || op == wrap.WriteAt {
+		if err := f.fsys.wait(context.Background(), "write", f.name, writeBytes, len(buf)); err != nil {
+			return 0, err
+		}
+		return do(buf)
+	}
+	n, err := do(buf)
+	if werr := f.fsys.wait(context.Background(), "read", f.name, readBytes, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// Call implements wrap.Hooks
+// Truncations and directory reads are limited
+// as operations, the other calls are not.
+func (f file) Call(op wrap.Op, do func() error) error {
+	switch op {
+	case wrap.Truncate:
+		if err := f.fsys.waitOp("truncate", f.name); err != nil {
+			return err
+		}
+	case wrap.ReadDir:
+		if err := f.fsys.waitOp("readdir", f.name); err != nil {
+			return err
+		}
+	}
+	return do()
+}
@@ -0,0 +1,309 @@
+// Package ratelimitfs provides a file system wrapper that
+// limits the rate of the operations on the file system it
+// wraps, and the bandwidth used to read and write its files.
+//
+// Unlike the wrappers of syncfs and lazyfs, New returns
+// the exported FS type rather than a writefs.WriteFS,
+// so that its limits can be changed at runtime.
+package ratelimitfs
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/parro-it/vs/internal/wrap"
+	"github.com/parro-it/vs/writefs"
+)
+
+// FS wraps a file system and limits the rate of its
+// operations and of the bytes read and written through
+// its files, globally and for path prefixes.
+//
+// Operations wait for the limits of all the prefixes
+// of the files they apply to, or for their context to be
+// done. Reads wait after the bytes are read, writes before
+// the bytes are written. Limits can be changed at any time,
+// and apply to the files already open.
+type FS struct {
+	limiter *limiter
+	// dir is the directory of wrapfs, relative to the
+	// root of the file system limits are set for
+	dir    string
+	wrapfs fs.FS
+}
+
+// New returns a file system that limits
+// the operations on fsys to limit.
+func New(fsys fs.FS, limit Limit) *FS {
+	fsys2 := &FS{
+		limiter: newLimiter(),
+		dir:     ".",
+		wrapfs:  fsys,
+	}
+	fsys2.limiter.set(".", limit)
+	return fsys2
+}
+
+var (
+	_ fs.StatFS     = &FS{}
+	_ fs.ReadFileFS = &FS{}
+	_ fs.SubFS      = &FS{}
+	_ fs.ReadDirFS  = &FS{}
+	_ fs.GlobFS     = &FS{}
+
+	_ writefs.WriteFS     = &FS{}
+	_ writefs.RemoveFS    = &FS{}
+	_ writefs.MkDirFS     = &FS{}
+	_ writefs.StatVFSFS   = &FS{}
+	_ writefs.HashFS      = &FS{}
+	_ writefs.RangeHashFS = &FS{}
+	_ writefs.ChmodFS     = &FS{}
+	_ writefs.ChtimesFS   = &FS{}
+	_ writefs.WatchFS     = &FS{}
+	_ writefs.ReadLinkFS  = &FS{}
+	_ writefs.RenameFS    = &FS{}
+
+	_ writefs.OpenFileContextFS = &FS{}
+	_ writefs.MkDirContextFS    = &FS{}
+	_ writefs.RemoveContextFS   = &FS{}
+	_ writefs.StatContextFS     = &FS{}
+)
+
+// SetLimit sets the limit of the operations on prefix and
+// on the files under it, replacing its current limit.
+// Prefix "." sets the global limit, and a zero limit
+// removes the limit of prefix.
+// Prefixes are relative to the file system returned
+// by New, also when set through one returned by Sub.
+func (fsys *FS) SetLimit(prefix string, limit Limit) error {
+	if !fs.ValidPath(prefix) {
+		return &fs.PathError{Op: "setlimit", Path: prefix, Err: fs.ErrInvalid}
+	}
+	fsys.limiter.set(prefix, limit)
+	return nil
+}
+
+// Limit returns the limit of prefix,
+// or a zero Limit if it has none.
+func (fsys *FS) Limit(prefix string) Limit {
+	return fsys.limiter.get(prefix)
+}
+
+// wait waits for the limits of op on the named file,
+// taking n tokens of kind.
+func (fsys *FS) wait(ctx context.Context, op string, name string, k kind, n int) error {
+	err := fsys.limiter.wait(ctx, path.Join(fsys.dir, name), k, float64(n))
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// waitOp waits for the limits of
+// op on the named file.
+func (fsys *FS) waitOp(op string, name string) error {
+	return fsys.wait(context.Background(), op, name, ops, 1)
+}
+
+// MkDir implements writefs.MkDirFS
+func (fsys *FS) MkDir(name string, perm fs.FileMode) error {
+	if err := fsys.waitOp("mkdir", name); err != nil {
+		return err
+	}
+	return writefs.MkDir(fsys.wrapfs, name, perm)
+}
+
+// Remove implements writefs.RemoveFS
+func (fsys *FS) Remove(name string) error {
+	if err := fsys.waitOp("remove", name); err != nil {
+		return err
+	}
+	return writefs.Remove(fsys.wrapfs, name)
+}
+
+// OpenFile implements writefs.WriteFS
+// Reads and writes on the returned file are limited.
+func (fsys *FS) OpenFile(name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	if err := fsys.waitOp(writefs.OpenFileOp(flag, perm), name); err != nil {
+		return nil, err
+	}
+	f, err := writefs.OpenFile(fsys.wrapfs, name, flag, perm)
+	if err != nil || f == nil {
+		return f, err
+	}
+	return newFile(fsys, name, f), nil
+}
+
+// StatVFS implements writefs.StatVFSFS
+func (fsys *FS) StatVFS(name string) (writefs.StatFSInfo, error) {
+	if err := fsys.waitOp("statvfs", name); err != nil {
+		return writefs.StatFSInfo{}, err
+	}
+	return writefs.StatVFS(fsys.wrapfs, name)
+}
+
+// Hash implements writefs.HashFS
+func (fsys *FS) Hash(name string, algo string) ([]byte, error) {
+	if err := fsys.waitOp("hash", name); err != nil {
+		return nil, err
+	}
+	return writefs.Hash(fsys.wrapfs, name, algo)
+}
+
+// HashRanges implements writefs.RangeHashFS
+func (fsys *FS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	if err := fsys.waitOp("hash", name); err != nil {
+		return nil, err
+	}
+	return writefs.HashRanges(fsys.wrapfs, name, algo, size)
+}
+
+// Chmod implements writefs.ChmodFS
+func (fsys *FS) Chmod(name string, mode fs.FileMode) error {
+	if err := fsys.waitOp("chmod", name); err != nil {
+		return err
+	}
+	return writefs.Chmod(fsys.wrapfs, name, mode)
+}
+
+// Chtimes implements writefs.ChtimesFS
+func (fsys *FS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if err := fsys.waitOp("chtimes", name); err != nil {
+		return err
+	}
+	return writefs.Chtimes(fsys.wrapfs, name, atime, mtime)
+}
+
+// Rename implements writefs.RenameFS
+// Renames are limited as operations on oldname.
+func (fsys *FS) Rename(oldname string, newname string) error {
+	if err := fsys.waitOp("rename", oldname); err != nil {
+		return err
+	}
+	return writefs.Rename(fsys.wrapfs, oldname, newname)
+}
+
+// ReadLink implements writefs.ReadLinkFS
+func (fsys *FS) ReadLink(name string) (string, error) {
+	if err := fsys.waitOp("readlink", name); err != nil {
+		return "", err
+	}
+	return writefs.ReadLink(fsys.wrapfs, name)
+}
+
+// Watch implements writefs.WatchFS
+// The scans of the file systems
+// that are polled are limited.
+func (fsys *FS) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	if err := fsys.wait(ctx, "watch", name, ops, 1); err != nil {
+		return nil, err
+	}
+	return wrap.Watch(ctx, fsys, fsys.wrapfs, name, recursive)
+}
+
+// OpenFileContext implements writefs.OpenFileContextFS
+// Reads and writes on the returned file are limited.
+func (fsys *FS) OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	if err := fsys.wait(ctx, writefs.OpenFileOp(flag, perm), name, ops, 1); err != nil {
+		return nil, err
+	}
+	f, err := writefs.OpenFileContext(ctx, fsys.wrapfs, name, flag, perm)
+	if err != nil || f == nil {
+		return f, err
+	}
+	return newFile(fsys, name, f), nil
+}
+
+// MkDirContext implements writefs.MkDirContextFS
+func (fsys *FS) MkDirContext(ctx context.Context, name string, perm fs.FileMode) error {
+	if err := fsys.wait(ctx, "mkdir", name, ops, 1); err != nil {
+		return err
+	}
+	return writefs.MkDirContext(ctx, fsys.wrapfs, name, perm)
+}
+
+// RemoveContext implements writefs.RemoveContextFS
+func (fsys *FS) RemoveContext(ctx context.Context, name string) error {
+	if err := fsys.wait(ctx, "remove", name, ops, 1); err != nil {
+		return err
+	}
+	return writefs.RemoveContext(ctx, fsys.wrapfs, name)
+}
+
+// StatContext implements writefs.StatContextFS
+func (fsys *FS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	if err := fsys.wait(ctx, "stat", name, ops, 1); err != nil {
+		return nil, err
+	}
+	return writefs.StatContext(ctx, fsys.wrapfs, name)
+}
+
+// Stat implements fs.StatFS
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	if err := fsys.waitOp("stat", name); err != nil {
+		return nil, err
+	}
+	return fs.Stat(fsys.wrapfs, name)
+}
+
+// ReadFile implements fs.ReadFileFS
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	if err := fsys.waitOp("read", name); err != nil {
+		return nil, err
+	}
+	buf, err := fs.ReadFile(fsys.wrapfs, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := fsys.wait(context.Background(), "read", name, readBytes, len(buf)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Sub implements fs.SubFS
+// The returned file system is writable
+// and shares the limits of fsys.
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	sub, err := writefs.Sub(fsys.wrapfs, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{
+		limiter: fsys.limiter,
+		dir:     path.Join(fsys.dir, dir),
+		wrapfs:  sub,
+	}, nil
+}
+
+// Open implements fs.FS
+// Reads on the returned file are limited.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if err := fsys.waitOp("open", name); err != nil {
+		return nil, err
+	}
+	f, err := fsys.wrapfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return newFile(fsys, name, f), nil
+}
+
+// ReadDir implements fs.ReadDirFS
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := fsys.waitOp("readdir", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(fsys.wrapfs, name)
+}
+
+// Glob implements fs.GlobFS
+// Globs are limited as operations on the root of fsys.
+func (fsys *FS) Glob(pattern string) ([]string, error) {
+	if err := fsys.waitOp("glob", "."); err != nil {
+		return nil, err
+	}
+	return fs.Glob(fsys.wrapfs, pattern)
+}
@@ -0,0 +1,177 @@
+package ratelimitfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/parro-it/vs/memfs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock whose time
+// advances only when sleeping.
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.now = c.now.Add(d)
+	c.slept += d
+	return nil
+}
+
+// newFS returns a limited memfs with a file and
+// a directory, that uses a fake clock.
+func newFS(t *testing.T, limit Limit) (*FS, *fakeClock) {
+	mem := memfs.New()
+	_, err := writefs.WriteFile(mem, "afile", []byte("ciao, mondo\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, writefs.MkDir(mem, "adir", fs.FileMode(0755)))
+	_, err = writefs.WriteFile(mem, "adir/bfile", []byte("miao\n"))
+	assert.NoError(t, err)
+
+	clock := &fakeClock{now: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)}
+	fsys := New(mem, Limit{})
+	fsys.limiter.now = clock.Now
+	fsys.limiter.sleep = clock.Sleep
+	assert.NoError(t, fsys.SetLimit(".", limit))
+	return fsys, clock
+}
+
+func TestRateLimitFS(t *testing.T) {
+	t.Run("pass writefstest.TestFS", func(t *testing.T) {
+		fsys := New(memfs.New(), Limit{OpsPerSecond: 1e6, ReadBytesPerSecond: 1e9, WriteBytesPerSecond: 1e9})
+		t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys))
+	})
+
+	t.Run("limits operations per second", func(t *testing.T) {
+		fsys, clock := newFS(t, Limit{OpsPerSecond: 2})
+		for i := 0; i < 2; i++ {
+			_, err := fs.Stat(fsys, "afile")
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, time.Duration(0), clock.slept)
+
+		_, err := fs.Stat(fsys, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, 500*time.Millisecond, clock.slept)
+		_, err = fs.ReadDir(fsys, ".")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Second, clock.slept)
+	})
+
+	t.Run("limits written bytes per second", func(t *testing.T) {
+		fsys, clock := newFS(t, Limit{WriteBytesPerSecond: 10})
+		f, err := writefs.OpenFile(fsys, "afile", os.O_WRONLY|os.O_TRUNC, 0)
+		assert.NoError(t, err)
+		n, err := f.Write([]byte("0123456789012345678901234567890"))
+		assert.NoError(t, err)
+		assert.Equal(t, 31, n)
+		assert.Equal(t, 2100*time.Millisecond, clock.slept)
+		assert.NoError(t, f.Close())
+	})
+
+	t.Run("limits read bytes per second", func(t *testing.T) {
+		fsys, clock := newFS(t, Limit{ReadBytesPerSecond: 4})
+		buf, err := fs.ReadFile(fsys, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao, mondo\n", string(buf))
+		assert.Equal(t, 2*time.Second, clock.slept)
+
+		f, err := fsys.Open("adir/bfile")
+		assert.NoError(t, err)
+		buf = make([]byte, 10)
+		n, err := f.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+		assert.Equal(t, 3250*time.Millisecond, clock.slept)
+
+		n, err = f.(io.ReaderAt).ReadAt(buf[:4], 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		assert.Equal(t, 4250*time.Millisecond, clock.slept)
+		assert.NoError(t, f.Close())
+	})
+
+	t.Run("limits path prefixes", func(t *testing.T) {
+		fsys, clock := newFS(t, Limit{})
+		assert.NoError(t, fsys.SetLimit("adir", Limit{OpsPerSecond: 1}))
+		assert.Equal(t, Limit{OpsPerSecond: 1}, fsys.Limit("adir"))
+
+		for i := 0; i < 3; i++ {
+			_, err := fs.Stat(fsys, "afile")
+			assert.NoError(t, err)
+			_, err = fs.Stat(fsys, "adirectory")
+			assert.Error(t, err)
+		}
+		assert.Equal(t, time.Duration(0), clock.slept)
+
+		_, err := fs.Stat(fsys, "adir")
+		assert.NoError(t, err)
+		_, err = fs.Stat(fsys, "adir/bfile")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Second, clock.slept)
+
+		sub, err := fs.Sub(fsys, "adir")
+		assert.NoError(t, err)
+		_, err = fs.Stat(sub, "bfile")
+		assert.NoError(t, err)
+		assert.Equal(t, 2*time.Second, clock.slept)
+	})
+
+	t.Run("limits can be changed at runtime", func(t *testing.T) {
+		fsys, clock := newFS(t, Limit{OpsPerSecond: 1})
+		_, err := fs.Stat(fsys, "afile")
+		assert.NoError(t, err)
+
+		assert.NoError(t, fsys.SetLimit(".", Limit{}))
+		assert.Equal(t, Limit{}, fsys.Limit("."))
+		for i := 0; i < 3; i++ {
+			_, err = fs.Stat(fsys, "afile")
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, time.Duration(0), clock.slept)
+
+		assert.NoError(t, fsys.SetLimit(".", Limit{OpsPerSecond: 4}))
+		for i := 0; i < 5; i++ {
+			_, err = fs.Stat(fsys, "afile")
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 250*time.Millisecond, clock.slept)
+
+		err = fsys.SetLimit("../adir", Limit{OpsPerSecond: 1})
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+
+	t.Run("waits are canceled with their context", func(t *testing.T) {
+		fsys, _ := newFS(t, Limit{OpsPerSecond: 1})
+		_, err := fs.Stat(fsys, "afile")
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = writefs.StatContext(ctx, fsys, "afile")
+		assert.True(t, errors.Is(err, context.Canceled))
+		var pathErr *fs.PathError
+		assert.True(t, errors.As(err, &pathErr))
+		assert.Equal(t, "stat", pathErr.Op)
+	})
+}
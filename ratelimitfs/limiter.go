@@ -0,0 +1,166 @@
+package ratelimitfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/parro-it/vs/internal/wrap"
+)
+
+// Limit is the maximum rate of operations
+// and transferred bytes allowed on a path.
+// Zero values mean no limit.
+type Limit struct {
+	// OpsPerSecond limits the calls to the
+	// methods of the file system, and the reads of
+	// directory entries and truncations of open files.
+	OpsPerSecond float64
+	// ReadBytesPerSecond limits the bytes
+	// read from open files and by ReadFile.
+	ReadBytesPerSecond float64
+	// WriteBytesPerSecond limits the bytes
+	// written to open files.
+	WriteBytesPerSecond float64
+}
+
+// kind identifies the rate of a Limit.
+type kind int
+
+const (
+	ops kind = iota
+	readBytes
+	writeBytes
+)
+
+// bucket is a token bucket that refills at rate tokens per
+// second, up to a burst of one second worth of tokens.
+// Tokens can be taken in advance, leaving a debt that
+// delays the following takes.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// setRate changes the rate of b, keeping the
+// tokens it has, up to the new burst.
+func (b *bucket) setRate(now time.Time, rate float64) {
+	if b.rate == 0 {
+		b.tokens = rate
+		b.last = now
+	} else {
+		b.refill(now)
+	}
+	b.rate = rate
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// take takes n tokens from b, and returns how long
+// to wait for the debt it leaves to be repaid.
+func (b *bucket) take(now time.Time, n float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// limits are the buckets of the
+// Limit of a path prefix.
+type limits struct {
+	limit   Limit
+	buckets [3]bucket
+}
+
+// limiter holds the limits of a file system. It's
+// shared with the file systems returned by Sub.
+type limiter struct {
+	// lock protects limits
+	lock   sync.Mutex
+	limits map[string]*limits
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		limits: map[string]*limits{},
+		now:    time.Now,
+		sleep:  wrap.Sleep,
+	}
+}
+
+// set changes the limit of prefix.
+// A zero limit removes it.
+func (l *limiter) set(prefix string, limit Limit) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if limit == (Limit{}) {
+		delete(l.limits, prefix)
+		return
+	}
+	lim, ok := l.limits[prefix]
+	if !ok {
+		lim = &limits{}
+		l.limits[prefix] = lim
+	}
+	now := l.now()
+	lim.limit = limit
+	lim.buckets[ops].setRate(now, limit.OpsPerSecond)
+	lim.buckets[readBytes].setRate(now, limit.ReadBytesPerSecond)
+	lim.buckets[writeBytes].setRate(now, limit.WriteBytesPerSecond)
+}
+
+// get returns the limit of prefix.
+func (l *limiter) get(prefix string) Limit {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if lim, ok := l.limits[prefix]; ok {
+		return lim.limit
+	}
+	return Limit{}
+}
+
+// wait takes n tokens of kind from the buckets of all the
+// prefixes of name, and waits for the longest of their
+// debts to be repaid, or for ctx to be done.
+func (l *limiter) wait(ctx context.Context, name string, k kind, n float64) error {
+	l.lock.Lock()
+	now := l.now()
+	var d time.Duration
+	for prefix, lim := range l.limits {
+		if !hasPrefix(name, prefix) {
+			continue
+		}
+		if wait := lim.buckets[k].take(now, n); wait > d {
+			d = wait
+		}
+	}
+	l.lock.Unlock()
+	return l.sleep(ctx, d)
+}
+
+// hasPrefix returns whether name is
+// prefix or a file under it.
+func hasPrefix(name string, prefix string) bool {
+	if prefix == "." || name == prefix {
+		return true
+	}
+	return len(name) > len(prefix) && name[len(prefix)] == '/' && name[:len(prefix)] == prefix
+}
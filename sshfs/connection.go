@@ -2,34 +2,39 @@ package sshfs
 
 import (
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/mikkeloscar/sshconfig"
-	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
 // ConnectClient returns a functioning instance of *SSHFS
-// using the given ssh.Client as transport layer.
-func ConnectClient(root string, sshClient *ssh.Client) (*SSHFS, error) {
-	client, err := sftp.NewClient(sshClient)
-	if err != nil {
-		return nil, err
-	}
-
-	fsys := SSHFS{
-		client: client,
-		root:   root,
-	}
-	return &fsys, nil
+// using the given ssh.Client as transport layer,
+// configured with the given options.
+// the Disconnect method of the SSHFS instance does not
+// close sshClient.
+func ConnectClient(root string, sshClient *ssh.Client, opts ...Option) (*SSHFS, error) {
+	return newConnection(sshClient, nil, 1).newFS(root, opts)
 }
 
 type hostCfg struct {
 	*ssh.ClientConfig
 	HostPort string
+	// ProxyCommand, when not empty, is a command
+	// whose standard input and output are used as
+	// transport to reach the host.
+	ProxyCommand string
+	// Jumps lists the hosts to tunnel through,
+	// in order, to reach the host.
+	Jumps []*hostCfg
+	// Identity is the fingerprint of the key used
+	// to authenticate, so that connections using
+	// different credentials are not shared.
+	Identity string
 }
 
 var cfg map[string]*hostCfg
@@ -42,24 +47,56 @@ func initConfig() error {
 			return err
 		}
 
-		hosts, err := sshconfig.ParseFS(os.DirFS(home), ".ssh/config")
+		hostsCfg, err := loadConfig(os.DirFS(home), ".ssh/config")
 		if err != nil {
 			return err
 		}
-		cfg = map[string]*hostCfg{}
+		cfg = hostsCfg
+	}
 
-		for _, host := range hosts {
-			hostCfg, err := hostToCfg(host)
-			if err != nil {
-				return err
-			}
-			if hostCfg != nil {
-				cfg[host.Host[0]] = hostCfg
+	return nil
+}
+
+// loadConfig reads the named ssh config file from fsys, and
+// returns the configurations of the hosts it describes.
+func loadConfig(fsys fs.FS, name string) (map[string]*hostCfg, error) {
+	hosts, err := sshconfig.ParseFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	hostsCfg := map[string]*hostCfg{}
+
+	for _, host := range hosts {
+		hostCfg, err := hostToCfg(host)
+		if err != nil {
+			return nil, err
+		}
+		if hostCfg == nil {
+			continue
+		}
+		for _, alias := range host.Host {
+			if !strings.ContainsAny(alias, "*?!") {
+				hostsCfg[alias] = hostCfg
 			}
 		}
 	}
 
-	return nil
+	proxyJumps := parseProxyJumps(string(content))
+	for host, proxyJump := range proxyJumps {
+		hostCfg, ok := hostsCfg[host]
+		if !ok {
+			continue
+		}
+		hostCfg.Jumps, err = resolveJumps(proxyJump, hostCfg, hostsCfg, proxyJumps, []string{host})
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %w", host, err)
+		}
+	}
+	return hostsCfg, nil
 }
 
 func hostToCfg(host *sshconfig.SSHHost) (*hostCfg, error) {
@@ -79,7 +116,7 @@ func hostToCfg(host *sshconfig.SSHHost) (*hostCfg, error) {
 		identityFile = strings.ReplaceAll(identityFile, "~", home)
 	}
 
-	key, err := privateSSHKey(identityFile)
+	signer, err := privateSSHKey(identityFile)
 	if err != nil {
 		return nil, nil //fmt.Errorf("cannot read ssh key %s: %w", identityFile, err)
 	}
@@ -89,9 +126,11 @@ func hostToCfg(host *sshconfig.SSHHost) (*hostCfg, error) {
 			User:            host.User,
 			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 			Timeout:         time.Second * 5,
-			Auth:            []ssh.AuthMethod{key},
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
 		},
-		HostPort: fmt.Sprintf("%s:%d", host.HostName, host.Port),
+		HostPort:     fmt.Sprintf("%s:%d", host.HostName, host.Port),
+		ProxyCommand: host.ProxyCommand,
+		Identity:     ssh.FingerprintSHA256(signer.PublicKey()),
 	}
 	return hostCfg, nil
 }
@@ -99,22 +138,38 @@ func hostToCfg(host *sshconfig.SSHHost) (*hostCfg, error) {
 // ConnectFromConfig returns a functioning instance of *SSHFS
 // using the info in ~/.ssh/config to create and connect an
 // SSH transport layer.
+// The transport is shared through DefaultPool with all other
+// instances connected to the same host: the Disconnect method
+// of the SSHFS instance will disconnect the SSH connection
+// when no other instance is using it.
+func ConnectFromConfig(root string, sshHostName string, opts ...Option) (*SSHFS, error) {
+	return DefaultPool.ConnectFromConfig(root, sshHostName, opts...)
+}
+
+// Connect returns a functioning instance of *SSHFS
+// using the given ssh.ClientConfig configuration to create
+// and connect an SSH transport layer.
 // the Disconnect method of the SSHFS instance will disconnect the
 // SSH connection too.
-func ConnectFromConfig(root string, sshHostName string) (*SSHFS, error) {
-	err := initConfig()
+func Connect(root string, config *sshconfig.SSHHost, opts ...Option) (*SSHFS, error) {
+	hostCfg, err := hostToCfg(config)
 	if err != nil {
 		return nil, err
 	}
-	return connect(root, cfg[sshHostName])
+	if hostCfg == nil {
+		return nil, fmt.Errorf("unvalid config provided")
+	}
+	return connect(root, hostCfg, opts)
 }
 
-// Connect returns a functioning instance of *SSHFS
-// using the given ssh.ClientConfig configuration to create
-// and connect an SSH transport layer.
+// ConnectVia returns a functioning instance of *SSHFS
+// connected to the host described by config, tunnelling
+// the connection through each host in jumps, in order.
+// The jumps replace any ProxyJump or ProxyCommand
+// configured for the host.
 // the Disconnect method of the SSHFS instance will disconnect the
-// SSH connection too.
-func Connect(root string, config *sshconfig.SSHHost) (*SSHFS, error) {
+// SSH connection and all the jump hosts connections too.
+func ConnectVia(root string, config *sshconfig.SSHHost, jumps ...*sshconfig.SSHHost) (*SSHFS, error) {
 	hostCfg, err := hostToCfg(config)
 	if err != nil {
 		return nil, err
@@ -122,34 +177,53 @@ func Connect(root string, config *sshconfig.SSHHost) (*SSHFS, error) {
 	if hostCfg == nil {
 		return nil, fmt.Errorf("unvalid config provided")
 	}
-	return connect(root, hostCfg)
+	hostCfg.ProxyCommand = ""
+
+	for _, jump := range jumps {
+		jumpCfg, err := hostToCfg(jump)
+		if err != nil {
+			return nil, err
+		}
+		if jumpCfg == nil {
+			return nil, fmt.Errorf("unvalid jump host config provided")
+		}
+		hostCfg.Jumps = append(hostCfg.Jumps, jumpCfg)
+	}
+
+	return connect(root, hostCfg, nil)
 }
 
-func connect(root string, config *hostCfg) (*SSHFS, error) {
-	sshClient, err := ssh.Dial("tcp", config.HostPort, config.ClientConfig)
+func connect(root string, config *hostCfg, opts []Option) (*SSHFS, error) {
+	chain, err := dial(config)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := ConnectClient(root, sshClient)
-	client.ownedSSHCient = sshClient
-	return client, err
+	fsys, err := newConnection(chain[len(chain)-1], chain, 1).newFS(root, opts)
+	if err != nil {
+		closeChain(chain)
+		return nil, err
+	}
+	return fsys, nil
 }
 
-// Disconnect ...
+// Disconnect releases the connection used by fsys.
+// The SSH connection is closed only if fsys owns it and
+// no other SSHFS instance is sharing it.
+// Instances returned by Sub don't own the connection
+// of their parent: disconnecting them does nothing.
 func (fsys *SSHFS) Disconnect() {
-	if fsys == nil {
+	if fsys == nil || fsys.conn == nil || fsys.view {
 		return
 	}
-	fsys.client.Close()
-
-	if fsys.ownedSSHCient != nil {
-		fsys.ownedSSHCient.Close()
-		fsys.ownedSSHCient = nil
+	if fsys.dedicated {
+		fsys.client.Close()
 	}
+	fsys.conn.release()
+	fsys.conn = nil
 }
 
-func privateSSHKey(path string) (ssh.AuthMethod, error) {
+func privateSSHKey(path string) (ssh.Signer, error) {
 	privateKey, err := ioutil.ReadFile(path)
 
 	if err != nil {
@@ -162,5 +236,5 @@ func privateSSHKey(path string) (ssh.AuthMethod, error) {
 		return nil, err
 	}
 
-	return ssh.PublicKeys(signer), nil
+	return signer, nil
 }
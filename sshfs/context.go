@@ -0,0 +1,119 @@
+package sshfs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+var (
+	_ writefs.OpenFileContextFS = &SSHFS{}
+	_ writefs.MkDirContextFS    = &SSHFS{}
+	_ writefs.RemoveContextFS   = &SSHFS{}
+	_ writefs.StatContextFS     = &SSHFS{}
+)
+
+// callResult is the result of a call
+// to the sftp server run by withContext.
+type callResult struct {
+	file writefs.FileWriter
+	info fs.FileInfo
+	err  error
+}
+
+// withContext runs call and waits for it to complete or
+// for ctx to be done, whichever happens first.
+// sftp requests cannot be cancelled once sent: when ctx is
+// done first, only the wait stops. The request keeps running
+// on the server, and a goroutine waits for its result until
+// it completes, or until the connection is closed if the
+// server never answers. Any file it opened is then closed,
+// and undo, if not nil, is called with the result, to revert
+// the effects of a call that completed successfully.
+func withContext(ctx context.Context, op string, name string, call func() callResult, undo func(callResult)) callResult {
+	if err := ctx.Err(); err != nil {
+		return callResult{err: &fs.PathError{Op: op, Path: name, Err: err}}
+	}
+
+	done := make(chan callResult, 1)
+	go func() {
+		done <- call()
+	}()
+
+	select {
+	case res := <-done:
+		return res
+	case <-ctx.Done():
+		go func() {
+			res := <-done
+			if res.file != nil {
+				res.file.Close()
+			}
+			if undo != nil && res.err == nil {
+				undo(res)
+			}
+		}()
+		return callResult{err: &fs.PathError{Op: op, Path: name, Err: ctx.Err()}}
+	}
+}
+
+// OpenFileContext implements writefs.OpenFileContextFS
+// When ctx is done before the file is opened, a file
+// created with O_CREATE|O_EXCL is removed. Other opens
+// cannot be reverted: a file may still be created or
+// truncated, or removed by O_TRUNC alone.
+func (fsys *SSHFS) OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	var undo func(callResult)
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		undo = fsys.undoCreate(name)
+	}
+	res := withContext(ctx, writefs.OpenFileOp(flag, perm), name, func() callResult {
+		f, err := fsys.OpenFile(name, flag, perm)
+		return callResult{file: f, err: err}
+	}, undo)
+	return res.file, res.err
+}
+
+// MkDirContext implements writefs.MkDirContextFS
+// When ctx is done before the directory
+// is created, the directory is removed.
+func (fsys *SSHFS) MkDirContext(ctx context.Context, name string, perm fs.FileMode) error {
+	return withContext(ctx, "mkdir", name, fsys.mkdirCall(name, perm), fsys.undoCreate(name)).err
+}
+
+// mkdirCall returns the call run by MkDirContext.
+func (fsys *SSHFS) mkdirCall(name string, perm fs.FileMode) func() callResult {
+	return func() callResult {
+		_, err := fsys.OpenFile(name, os.O_CREATE, perm|fs.ModeDir)
+		return callResult{err: err}
+	}
+}
+
+// undoCreate returns a function that removes the
+// file or directory created by an abandoned call.
+func (fsys *SSHFS) undoCreate(name string) func(callResult) {
+	return func(callResult) {
+		fsys.OpenFile(name, os.O_TRUNC, 0)
+	}
+}
+
+// RemoveContext implements writefs.RemoveContextFS
+// A remove cannot be reverted: when ctx is done before
+// it completes, the file may still be removed.
+func (fsys *SSHFS) RemoveContext(ctx context.Context, name string) error {
+	return withContext(ctx, "remove", name, func() callResult {
+		_, err := fsys.OpenFile(name, os.O_TRUNC, 0)
+		return callResult{err: err}
+	}, nil).err
+}
+
+// StatContext implements writefs.StatContextFS
+func (fsys *SSHFS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	res := withContext(ctx, "stat", name, func() callResult {
+		info, err := fsys.Stat(name)
+		return callResult{info: info, err: err}
+	}, nil)
+	return res.info, res.err
+}
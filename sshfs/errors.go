@@ -0,0 +1,93 @@
+package sshfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/parro-it/vs/writefs"
+	"github.com/pkg/sftp"
+)
+
+// sftp status codes, as defined by
+// draft-ietf-secsh-filexfer.
+const (
+	sshFxNoSuchFile        = 2
+	sshFxPermissionDenied  = 3
+	sshFxFailure           = 4
+	sshFxOpUnsupported     = 8
+	sshFxFileAlreadyExists = 11
+	sshFxDirNotEmpty       = 18
+	sshFxNotADirectory     = 19
+	sshFxFileIsADirectory  = 24
+)
+
+var statusSentinels = map[uint32]error{
+	sshFxNoSuchFile:        fs.ErrNotExist,
+	sshFxPermissionDenied:  fs.ErrPermission,
+	sshFxOpUnsupported:     fs.ErrInvalid,
+	sshFxFileAlreadyExists: fs.ErrExist,
+	sshFxDirNotEmpty:       writefs.ErrNotEmpty,
+	sshFxNotADirectory:     writefs.ErrNotDir,
+	sshFxFileIsADirectory:  writefs.ErrIsDir,
+}
+
+// inferredOps are the operations whose
+// SSH_FX_FAILURE errors are translated
+// by inferring their cause.
+var inferredOps = map[string]bool{
+	"open":   true,
+	"mkdir":  true,
+	"remove": true,
+	"rename": true,
+}
+
+// pathError returns a *fs.PathError describing the
+// failure of op on the named file, translating
+// sftp status errors to sentinel errors. flag are
+// the flags the file was opened with, if op opened it.
+// Servers speaking version 3 of the protocol report
+// most failures with the generic SSH_FX_FAILURE code:
+// for the inferredOps, their cause is inferred from the
+// state of the file and of its parent directory, at the
+// cost of up to two more Stat round trips per failure.
+func (fsys *SSHFS) pathError(op string, name string, flag int, err error) error {
+	var status *sftp.StatusError
+	if errors.As(err, &status) {
+		if sentinel, ok := statusSentinels[status.Code]; ok {
+			err = sentinel
+		} else if status.Code == sshFxFailure && inferredOps[op] {
+			err = fsys.failureCause(op, name, flag, err)
+		}
+	}
+	return writefs.NewPathError(op, name, err)
+}
+
+// failureCause returns the sentinel error that caused
+// the SSH_FX_FAILURE of op on the named file, or err
+// when the cause cannot be inferred.
+func (fsys *SSHFS) failureCause(op string, name string, flag int, err error) error {
+	fPath := fsys.resolvePath(name)
+	info, statErr := fsys.client.Stat(fPath)
+	if statErr != nil && op == "rename" && errors.Is(statErr, fs.ErrNotExist) {
+		// renamed files must exist.
+		return fs.ErrNotExist
+	}
+	if statErr == nil {
+		switch {
+		case op == "mkdir":
+			return fs.ErrExist
+		case op == "remove" && info.IsDir():
+			return writefs.ErrNotEmpty
+		case op == "open" && info.IsDir():
+			return writefs.ErrIsDir
+		case op == "open" && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+			return fs.ErrExist
+		}
+	}
+	if parent, statErr := fsys.client.Stat(path.Dir(fPath)); statErr == nil && !parent.IsDir() {
+		return writefs.ErrNotDir
+	}
+	return err
+}
@@ -0,0 +1,402 @@
+package sshfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrDisconnected is returned when a command is
+// started on an SSHFS instance already disconnected.
+var ErrDisconnected = errors.New("sshfs: disconnected")
+
+// Cmd represents a command being prepared or run on
+// the host an SSHFS instance is connected to.
+// It mimics the API of exec.Cmd.
+type Cmd struct {
+	// Path is the name or path of the command to run.
+	Path string
+	// Args holds command line arguments, including
+	// the command as Args[0].
+	Args []string
+	// Env specifies additional environment variables
+	// of the command, each of the form "key=value".
+	Env []string
+	// Dir specifies the working directory of the command.
+	// Relative paths are resolved from the root of the
+	// SSHFS instance. If Dir is empty, the command runs
+	// in the root of the SSHFS instance.
+	Dir string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// PTY, when not nil, requests a pseudo terminal
+	// for the command.
+	PTY *PTY
+
+	// CancelSignal is the signal sent to the command
+	// when the context passed to CommandContext is done.
+	// It defaults to ssh.SIGTERM.
+	CancelSignal ssh.Signal
+
+	fsys    *SSHFS
+	ctx     context.Context
+	session *ssh.Session
+	started bool
+	// finished is true once Wait was called
+	finished bool
+	// startErr is the error returned by
+	// Start when the command failed to start.
+	startErr error
+	done     chan struct{}
+}
+
+// PTY describes the pseudo terminal
+// to allocate for a command.
+type PTY struct {
+	// Term is the value of the TERM environment
+	// variable. It defaults to "xterm".
+	Term   string
+	Width  int
+	Height int
+	Modes  ssh.TerminalModes
+}
+
+// ExitError reports an unsuccessful exit by a command.
+type ExitError struct {
+	// Status is the exit status of the command,
+	// or -1 if the command was killed by a signal
+	// or the remote host did not report it.
+	Status int
+	// Signal is the name of the signal that killed
+	// the command, without the SIG prefix.
+	Signal string
+	// Msg is the message reported by the remote host, if any.
+	Msg string
+	// Stderr holds the standard error output of the
+	// command if it was not otherwise collected
+	// and the command was run with Output.
+	Stderr []byte
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return "signal: " + e.Signal
+	}
+	if e.Status == -1 {
+		return "exit status unknown"
+	}
+	return fmt.Sprintf("exit status %d", e.Status)
+}
+
+// ExitCode returns the exit status of the command,
+// or -1 if the command was killed by a signal.
+func (e *ExitError) ExitCode() int {
+	return e.Status
+}
+
+// Command returns the Cmd struct to execute the named
+// program with the given arguments on the host fsys is
+// connected to.
+func (fsys *SSHFS) Command(name string, arg ...string) *Cmd {
+	return fsys.CommandContext(context.Background(), name, arg...)
+}
+
+// CommandContext is like Command but includes a context.
+// When the context is done before the command completes,
+// CancelSignal is sent to the remote command and the
+// session is closed.
+func (fsys *SSHFS) CommandContext(ctx context.Context, name string, arg ...string) *Cmd {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	return &Cmd{
+		Path:         name,
+		Args:         append([]string{name}, arg...),
+		CancelSignal: ssh.SIGTERM,
+		fsys:         fsys,
+		ctx:          ctx,
+	}
+}
+
+// String returns the command line that will be
+// run on the remote host.
+func (c *Cmd) String() string {
+	var b strings.Builder
+	dir := c.dir()
+	if dir != "" {
+		fmt.Fprintf(&b, "cd %s && ", shellQuote(dir))
+	}
+	b.WriteString("exec ")
+	if len(c.Env) > 0 {
+		b.WriteString("env")
+		for _, kv := range c.Env {
+			b.WriteString(" ")
+			b.WriteString(shellQuote(kv))
+		}
+		b.WriteString(" ")
+	}
+	args := c.Args
+	if len(args) == 0 {
+		args = []string{c.Path}
+	}
+	b.WriteString(shellQuote(c.Path))
+	for _, arg := range args[1:] {
+		b.WriteString(" ")
+		b.WriteString(shellQuote(arg))
+	}
+	return b.String()
+}
+
+func (c *Cmd) dir() string {
+	if c.Dir == "" {
+		return c.fsys.root
+	}
+	if path.IsAbs(c.Dir) {
+		return c.Dir
+	}
+	return path.Join(c.fsys.root, c.Dir)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (c *Cmd) newSession() error {
+	if c.session != nil {
+		return nil
+	}
+	if c.fsys == nil || c.fsys.conn == nil {
+		return ErrDisconnected
+	}
+	session, err := c.fsys.conn.ssh.NewSession()
+	if err != nil {
+		return err
+	}
+	c.session = session
+	return nil
+}
+
+// StdinPipe returns a pipe that will be connected to
+// the command's standard input when the command starts.
+func (c *Cmd) StdinPipe() (io.WriteCloser, error) {
+	if c.Stdin != nil {
+		return nil, errors.New("sshfs: Stdin already set")
+	}
+	if err := c.newSession(); err != nil {
+		return nil, err
+	}
+	return c.session.StdinPipe()
+}
+
+// StdoutPipe returns a pipe that will be connected to
+// the command's standard output when the command starts.
+func (c *Cmd) StdoutPipe() (io.Reader, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("sshfs: Stdout already set")
+	}
+	if err := c.newSession(); err != nil {
+		return nil, err
+	}
+	return c.session.StdoutPipe()
+}
+
+// StderrPipe returns a pipe that will be connected to
+// the command's standard error when the command starts.
+func (c *Cmd) StderrPipe() (io.Reader, error) {
+	if c.Stderr != nil {
+		return nil, errors.New("sshfs: Stderr already set")
+	}
+	if err := c.newSession(); err != nil {
+		return nil, err
+	}
+	return c.session.StderrPipe()
+}
+
+// Start starts the specified command but does not
+// wait for it to complete.
+func (c *Cmd) Start() error {
+	if c.started || c.startErr != nil {
+		return errors.New("sshfs: already started")
+	}
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.newSession(); err != nil {
+		return err
+	}
+
+	if c.Stdin != nil {
+		c.session.Stdin = c.Stdin
+	}
+	if c.Stdout != nil {
+		c.session.Stdout = c.Stdout
+	}
+	if c.Stderr != nil {
+		c.session.Stderr = c.Stderr
+	}
+
+	if c.PTY != nil {
+		term := c.PTY.Term
+		if term == "" {
+			term = "xterm"
+		}
+		modes := c.PTY.Modes
+		if modes == nil {
+			modes = ssh.TerminalModes{}
+		}
+		err := c.session.RequestPty(term, c.PTY.Height, c.PTY.Width, modes)
+		if err != nil {
+			return c.startFailed(err)
+		}
+	}
+
+	if err := c.session.Start(c.String()); err != nil {
+		return c.startFailed(err)
+	}
+	c.started = true
+
+	c.done = make(chan struct{})
+	if c.ctx.Done() != nil {
+		go func() {
+			select {
+			case <-c.ctx.Done():
+				c.session.Signal(c.CancelSignal)
+				c.session.Close()
+			case <-c.done:
+			}
+		}()
+	}
+	return nil
+}
+
+// startFailed closes the session of a command
+// that failed to start, and records err to
+// return it from Wait.
+func (c *Cmd) startFailed(err error) error {
+	c.session.Close()
+	c.session = nil
+	c.startErr = err
+	return err
+}
+
+// Wait waits for the command to exit.
+// If the command fails to run or doesn't complete
+// successfully, the error is of type *ExitError.
+// If the context was done before the command
+// completed, the context error is returned.
+// If the command failed to start, the error
+// returned by Start is returned.
+// Wait can be called only once, and not after Run.
+func (c *Cmd) Wait() error {
+	if c.startErr != nil {
+		return c.startErr
+	}
+	if !c.started {
+		return errors.New("sshfs: not started")
+	}
+	if c.finished {
+		return errors.New("sshfs: Wait was already called")
+	}
+	c.finished = true
+	err := c.session.Wait()
+	close(c.done)
+	c.session.Close()
+
+	if ctxErr := c.ctx.Err(); ctxErr != nil && err != nil {
+		return ctxErr
+	}
+	return exitError(err)
+}
+
+func exitError(err error) error {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		res := &ExitError{
+			Status: exitErr.ExitStatus(),
+			Signal: exitErr.Signal(),
+			Msg:    exitErr.Msg(),
+		}
+		if res.Signal != "" {
+			res.Status = -1
+		}
+		return res
+	}
+	var missingErr *ssh.ExitMissingError
+	if errors.As(err, &missingErr) {
+		return &ExitError{Status: -1}
+	}
+	return err
+}
+
+// Run starts the specified command and waits for it to complete.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output.
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("sshfs: Stdout already set")
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	captureErr := c.Stderr == nil
+	if captureErr {
+		c.Stderr = &stderr
+	}
+
+	err := c.Run()
+	var exitErr *ExitError
+	if captureErr && errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its
+// combined standard output and standard error.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("sshfs: Stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.New("sshfs: Stderr already set")
+	}
+	var b syncBuffer
+	c.Stdout = &b
+	c.Stderr = &b
+	err := c.Run()
+	return b.Bytes(), err
+}
+
+// syncBuffer is a bytes.Buffer safe
+// for concurrent writes.
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Bytes()
+}
@@ -0,0 +1,124 @@
+package sshfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExec(t *testing.T) {
+	t.Run("command line quotes arguments", func(t *testing.T) {
+		fsys := &SSHFS{root: "/var/fixtures"}
+		cmd := fsys.Command("echo", "it's", "a $VAR")
+		assert.Equal(t, `cd '/var/fixtures' && exec 'echo' 'it'\''s' 'a $VAR'`, cmd.String())
+
+		cmd.Dir = "new-dir"
+		cmd.Env = []string{"A=1"}
+		assert.Equal(t, `cd '/var/fixtures/new-dir' && exec env 'A=1' 'echo' 'it'\''s' 'a $VAR'`, cmd.String())
+
+		cmd.Dir = "/tmp"
+		cmd.Env = nil
+		assert.Equal(t, `cd '/tmp' && exec 'echo' 'it'\''s' 'a $VAR'`, cmd.String())
+	})
+
+	t.Run("disconnected fs cannot run commands", func(t *testing.T) {
+		fsys := &SSHFS{root: "/var/fixtures"}
+		err := fsys.Command("true").Run()
+		assert.True(t, errors.Is(err, ErrDisconnected))
+	})
+
+	fsys, err := ConnectFromConfig("/var/fixtures", "fakehost")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fsys.Disconnect()
+
+	t.Run("run in fs root by default", func(t *testing.T) {
+		out, err := fsys.Command("pwd").Output()
+		assert.NoError(t, err)
+		assert.Equal(t, "/var/fixtures\n", string(out))
+	})
+
+	t.Run("run in given dir", func(t *testing.T) {
+		cmd := fsys.Command("ls")
+		cmd.Dir = "new-dir"
+		out, err := cmd.Output()
+		assert.NoError(t, err)
+		assert.Equal(t, "file1.txt\nfile2.txt\nfile3.txt\nfile4.txt\n", string(out))
+	})
+
+	t.Run("set environment", func(t *testing.T) {
+		cmd := fsys.Command("sh", "-c", "echo $GREETING")
+		cmd.Env = []string{"GREETING=ciao"}
+		out, err := cmd.Output()
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao\n", string(out))
+	})
+
+	t.Run("stream stdin, stdout and stderr", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		cmd := fsys.Command("sh", "-c", "cat; echo err >&2")
+		cmd.Stdin = strings.NewReader("ciao\n")
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		assert.NoError(t, cmd.Run())
+		assert.Equal(t, "ciao\n", stdout.String())
+		assert.Equal(t, "err\n", stderr.String())
+	})
+
+	t.Run("return exit codes as *ExitError", func(t *testing.T) {
+		_, err := fsys.Command("sh", "-c", "echo failed >&2; exit 3").Output()
+		var exitErr *ExitError
+		if assert.True(t, errors.As(err, &exitErr)) {
+			assert.Equal(t, 3, exitErr.ExitCode())
+			assert.Equal(t, "exit status 3", exitErr.Error())
+			assert.Equal(t, "failed\n", string(exitErr.Stderr))
+		}
+	})
+
+	t.Run("Wait returns an error when called again", func(t *testing.T) {
+		cmd := fsys.Command("true")
+		assert.NoError(t, cmd.Run())
+		assert.EqualError(t, cmd.Wait(), "sshfs: Wait was already called")
+
+		cmd = fsys.Command("true")
+		assert.NoError(t, cmd.Start())
+		assert.NoError(t, cmd.Wait())
+		assert.EqualError(t, cmd.Wait(), "sshfs: Wait was already called")
+	})
+
+	t.Run("Wait returns the error of Start", func(t *testing.T) {
+		cmd := fsys.Command("true")
+		_, err := cmd.StdoutPipe()
+		assert.NoError(t, err)
+		cmd.session.Close()
+
+		err = cmd.Start()
+		assert.Error(t, err)
+		assert.Nil(t, cmd.session)
+		assert.Equal(t, err, cmd.Wait())
+		assert.EqualError(t, cmd.Start(), "sshfs: already started")
+	})
+
+	t.Run("send signal on context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := fsys.CommandContext(ctx, "sleep", "10").Run()
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("allocate a PTY", func(t *testing.T) {
+		cmd := fsys.Command("echo", "ok")
+		cmd.PTY = &PTY{Width: 80, Height: 24}
+		out, err := cmd.Output()
+		assert.NoError(t, err)
+		assert.Contains(t, string(out), "ok")
+	})
+}
@@ -1,64 +1,79 @@
 package sshfs
 
 import (
+	"errors"
 	"io"
 	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/parro-it/vs/writefs"
 	"github.com/pkg/sftp"
-	"golang.org/x/crypto/ssh"
 )
 
 // SSHFS ...
 type SSHFS struct {
-	client        *sftp.Client
-	ownedSSHCient *ssh.Client
-	root          string
+	client *sftp.Client
+	conn   *connection
+	root   string
+	// view is true for the instances returned by Sub,
+	// that don't hold a reference to conn.
+	view bool
+	// dedicated is true when client is an sftp session
+	// opened only for this instance, that Disconnect closes.
+	dedicated bool
 }
 
 // OpenFile implements writefs.WriteFS
 func (fsys *SSHFS) OpenFile(name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	op := writefs.OpenFileOp(flag, perm)
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
 	}
 
 	fPath := fsys.resolvePath(name)
 
-	if flag&os.O_CREATE == os.O_CREATE &&
-		perm.IsDir() {
-		err := fsys.client.Mkdir(fPath)
-		if err != nil {
-			info, _ := fsys.client.Stat(fPath)
-			if info != nil {
-				return nil, fs.ErrExist
-			}
-			return nil, err
+	if op == "mkdir" {
+		if err := fsys.client.Mkdir(fPath); err != nil {
+			return nil, fsys.pathError(op, name, flag, err)
 		}
-		return nil, nil
+		// sftp servers create directories applying their
+		// umask: set the requested permissions explicitly.
+		return nil, fsys.pathError(op, name, flag, fsys.client.Chmod(fPath, perm.Perm()))
 	}
 
-	if flag == os.O_TRUNC {
+	if op == "remove" {
 		info, err := fsys.client.Stat(fPath)
 		if err != nil {
-			return nil, err
+			return nil, fsys.pathError(op, name, flag, err)
 		}
 		if info.IsDir() {
-			err := fsys.client.RemoveDirectory(fPath)
-			if err != nil {
-				err = fs.ErrInvalid
-			}
-			return nil, err
+			return nil, fsys.pathError(op, name, flag, fsys.client.RemoveDirectory(fPath))
 		}
-		return nil, fsys.client.Remove(fPath)
+		return nil, fsys.pathError(op, name, flag, fsys.client.Remove(fPath))
+	}
+
+	created := false
+	if flag&os.O_CREATE == os.O_CREATE {
+		_, err := fsys.client.Lstat(fPath)
+		created = errors.Is(err, fs.ErrNotExist)
 	}
 
 	f, err := fsys.client.OpenFile(fPath, flag)
 	if err != nil {
-		return nil, err
+		return nil, fsys.pathError(op, name, flag, err)
+	}
+
+	if created {
+		// sftp servers create files applying their umask:
+		// set the requested permissions before any data is written.
+		if err := f.Chmod(perm.Perm()); err != nil {
+			f.Close()
+			return nil, fsys.pathError(op, name, flag, err)
+		}
 	}
 
 	wrapper := fileWrapper{
@@ -73,15 +88,81 @@ func (fsys *SSHFS) OpenFile(name string, flag int, perm fs.FileMode) (writefs.Fi
 // Stat implements fs.StatFS
 func (fsys *SSHFS) Stat(name string) (fs.FileInfo, error) {
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fsys.client.Stat(fsys.resolvePath(name))
+	if err != nil {
+		return nil, fsys.pathError("stat", name, 0, err)
+	}
+	return info, nil
+}
+
+// StatVFS implements writefs.StatVFSFS
+// The sftp server must support the
+// statvfs@openssh.com extension.
+func (fsys *SSHFS) StatVFS(name string) (writefs.StatFSInfo, error) {
+	if !fs.ValidPath(name) {
+		return writefs.StatFSInfo{}, &fs.PathError{Op: "statvfs", Path: name, Err: fs.ErrInvalid}
+	}
+	st, err := fsys.client.StatVFS(fsys.resolvePath(name))
+	if err != nil {
+		return writefs.StatFSInfo{}, fsys.pathError("statvfs", name, 0, err)
+	}
+	return writefs.StatFSInfo{
+		TotalBytes:      st.TotalSpace(),
+		FreeBytes:       st.FreeSpace(),
+		AvailableBytes:  st.Bavail * st.Frsize,
+		TotalInodes:     st.Files,
+		FreeInodes:      st.Ffree,
+		AvailableInodes: st.Favail,
+	}, nil
+}
+
+// Chmod implements writefs.ChmodFS
+func (fsys *SSHFS) Chmod(name string, mode fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrInvalid}
+	}
+	return fsys.pathError("chmod", name, 0, fsys.client.Chmod(fsys.resolvePath(name), mode))
+}
+
+// Chtimes implements writefs.ChtimesFS
+func (fsys *SSHFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrInvalid}
+	}
+	return fsys.pathError("chtimes", name, 0, fsys.client.Chtimes(fsys.resolvePath(name), atime, mtime))
+}
+
+// Rename implements writefs.RenameFS
+// Existing files are replaced through the posix-rename
+// extension of OpenSSH servers, when available.
+func (fsys *SSHFS) Rename(oldname string, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	oldPath, newPath := fsys.resolvePath(oldname), fsys.resolvePath(newname)
+	err := fsys.client.PosixRename(oldPath, newPath)
+	var status *sftp.StatusError
+	if errors.As(err, &status) && status.Code == sshFxOpUnsupported {
+		err = fsys.client.Rename(oldPath, newPath)
 	}
-	return fsys.client.Stat(fsys.resolvePath(name))
+	if err != nil {
+		return writefs.NewLinkError("rename", oldname, newname, fsys.pathError("rename", oldname, 0, err))
+	}
+	return nil
+}
+
+// Root returns the path on the remote host
+// of the root directory of fsys.
+func (fsys *SSHFS) Root() string {
+	return fsys.root
 }
 
 // ReadFile implements fs.ReadFileFS
 func (fsys *SSHFS) ReadFile(name string) ([]byte, error) {
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
 	}
 
 	f, err := fsys.Open(name)
@@ -92,13 +173,27 @@ func (fsys *SSHFS) ReadFile(name string) ([]byte, error) {
 	return ioutil.ReadAll(f)
 }
 
-/*
 // Sub implements fs.SubFS
+// It returns a new *SSHFS rooted at dir, that is a view
+// on the connection of fsys. fsys keeps owning the
+// connection: the returned instance can be used until
+// fsys is disconnected, and its Disconnect method does
+// nothing, so that subs never need to be disconnected.
 func (fsys *SSHFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if fsys.conn == nil {
+		return nil, ErrDisconnected
+	}
 
-	return nil, nil
+	return &SSHFS{
+		client: fsys.client,
+		conn:   fsys.conn,
+		root:   fsys.resolvePath(dir),
+		view:   true,
+	}, nil
 }
-*/
 
 type fileWrapper struct {
 	*sftp.File
@@ -108,6 +203,15 @@ type fileWrapper struct {
 	cursor       int
 }
 
+// The embedded *sftp.File lets io.Copy transfer whole
+// files issuing concurrent requests, according to the
+// Concurrency and PacketSize options of the SSHFS
+// instance that opened them.
+var (
+	_ io.WriterTo   = &fileWrapper{}
+	_ io.ReaderFrom = &fileWrapper{}
+)
+
 func (f *fileWrapper) ReadDir(n int) ([]fs.DirEntry, error) {
 	if f.dirContent == nil {
 		files, err := f.fsys.client.ReadDir(f.resolvedPath)
@@ -148,12 +252,12 @@ func (f *fileWrapper) ReadDir(n int) ([]fs.DirEntry, error) {
 // Open implements fs.FS
 func (fsys *SSHFS) Open(name string) (fs.File, error) {
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
 	}
 
 	f, err := fsys.client.Open(fsys.resolvePath(name))
 	if err != nil {
-		return nil, err
+		return nil, fsys.pathError("open", name, os.O_RDONLY, err)
 	}
 
 	wrapper := fileWrapper{
@@ -179,12 +283,12 @@ func (fsys *SSHFS) resolvePath(name string) string {
 // ReadDir implements fs.ReadDirFS
 func (fsys *SSHFS) ReadDir(name string) ([]fs.DirEntry, error) {
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
 	}
 
 	files, err := fsys.client.ReadDir(fsys.resolvePath(name))
 	if err != nil {
-		return nil, err
+		return nil, fsys.pathError("readdir", name, 0, err)
 	}
 
 	sort.Slice(files, func(i, j int) bool {
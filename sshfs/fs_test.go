@@ -1,10 +1,22 @@
 package sshfs
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mikkeloscar/sshconfig"
+	"github.com/parro-it/vs/writefs"
 	"github.com/parro-it/vs/writefstest"
+	"github.com/pkg/sftp"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/ssh"
 )
@@ -21,10 +33,7 @@ func TestSSHFS(t *testing.T) {
 		fsys, err := ConnectFromConfig("/var/fixtures", "fakehost")
 		assert.NoError(t, err)
 
-		sess, err := fsys.ownedSSHCient.NewSession()
-		defer sess.Close()
-		assert.NoError(t, err)
-		err = sess.Run("rm -rf /var/fixtures/dir1 /var/fixtures/dirempty")
+		err = fsys.Command("rm", "-rf", "dir1", "dirempty").Run()
 		assert.NoError(t, err)
 
 		t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys))
@@ -61,4 +70,406 @@ func TestSSHFS(t *testing.T) {
 		})
 	})
 
+	t.Run("StatVFS reports disk usage", func(t *testing.T) {
+		fsys, err := ConnectFromConfig("/var/fixtures", "fakehost")
+		assert.NoError(t, err)
+		defer fsys.Disconnect()
+
+		info, err := writefs.StatVFS(fsys, "new-dir")
+		assert.NoError(t, err)
+		assert.Greater(t, info.TotalBytes, uint64(0))
+		assert.LessOrEqual(t, info.FreeBytes, info.TotalBytes)
+		assert.LessOrEqual(t, info.AvailableBytes, info.FreeBytes)
+	})
+
+	t.Run("Rename replaces existing files", func(t *testing.T) {
+		fsys, err := ConnectFromConfig("/var/fixtures", "fakehost")
+		assert.NoError(t, err)
+		defer fsys.Disconnect()
+
+		_, err = writefs.WriteFile(fsys, "afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		_, err = writefs.WriteFile(fsys, "bfile", []byte("miao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.Rename(fsys, "bfile", "afile"))
+		buf, err := fs.ReadFile(fsys, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "miao\n", string(buf))
+
+		err = writefs.Rename(fsys, "bfile", "cfile")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+		assert.NoError(t, writefs.Remove(fsys, "afile"))
+	})
+
+	t.Run("failures opening existing files", func(t *testing.T) {
+		fsys, err := ConnectFromConfig("/var/fixtures", "fakehost")
+		assert.NoError(t, err)
+		defer fsys.Disconnect()
+
+		_, err = writefs.WriteFile(fsys, "afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		defer writefs.Remove(fsys, "afile")
+
+		failure := &sftp.StatusError{Code: sshFxFailure}
+		err = fsys.pathError("open", "afile", os.O_WRONLY|os.O_CREATE|os.O_EXCL, failure)
+		assert.True(t, errors.Is(err, fs.ErrExist))
+
+		t.Run("are not ErrExist without O_EXCL", func(t *testing.T) {
+			err := fsys.pathError("open", "afile", os.O_WRONLY|os.O_CREATE, failure)
+			assert.False(t, errors.Is(err, fs.ErrExist))
+			assert.True(t, errors.Is(err, failure))
+		})
+
+		t.Run("are not inferred for other ops", func(t *testing.T) {
+			err := fsys.pathError("chmod", "afile", 0, failure)
+			assert.True(t, errors.Is(err, failure))
+		})
+	})
+
+	t.Run("Context operations", func(t *testing.T) {
+		fsys, err := ConnectFromConfig("/var/fixtures", "fakehost")
+		assert.NoError(t, err)
+		defer fsys.Disconnect()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		assert.NoError(t, fsys.Command("rm", "-rf", "ctxdir").Run())
+		assert.NoError(t, writefs.MkDirContext(ctx, fsys, "ctxdir", fs.FileMode(0755)))
+		f, err := writefs.OpenFileContext(ctx, fsys, "ctxdir/afile", os.O_WRONLY|os.O_CREATE, fs.FileMode(0644))
+		assert.NoError(t, err)
+		_, err = f.Write([]byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		info, err := writefs.StatContext(ctx, fsys, "ctxdir/afile")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), info.Size())
+		assert.NoError(t, writefs.RemoveContext(ctx, fsys, "ctxdir/afile"))
+		assert.NoError(t, writefs.RemoveContext(ctx, fsys, "ctxdir"))
+
+		t.Run("fail when the context is done", func(t *testing.T) {
+			cancelled, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := writefs.StatContext(cancelled, fsys, "new-dir")
+			assert.True(t, errors.Is(err, context.Canceled))
+		})
+
+		t.Run("abandon in-flight requests", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			release := make(chan struct{})
+			file := &closeRecorder{closed: make(chan struct{})}
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+			res := withContext(ctx, "open", "afile", func() callResult {
+				<-release
+				return callResult{file: file}
+			}, nil)
+			assert.True(t, errors.Is(res.err, context.Canceled))
+			assert.Nil(t, res.file)
+
+			close(release)
+			select {
+			case <-file.closed:
+			case <-time.After(time.Second):
+				t.Error("file opened after cancellation was not closed")
+			}
+		})
+
+		t.Run("revert directories created after cancellation", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			release := make(chan struct{})
+			undone := make(chan struct{})
+			undo := fsys.undoCreate("ctxdir")
+			mkdir := fsys.mkdirCall("ctxdir", fs.FileMode(0755))
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+			res := withContext(ctx, "mkdir", "ctxdir", func() callResult {
+				<-release
+				return mkdir()
+			}, func(res callResult) {
+				undo(res)
+				close(undone)
+			})
+			assert.True(t, errors.Is(res.err, context.Canceled))
+
+			close(release)
+			select {
+			case <-undone:
+			case <-time.After(5 * time.Second):
+				t.Error("directory created after cancellation was not removed")
+			}
+			_, err := fs.Stat(fsys, "ctxdir")
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+		})
+	})
+
+	t.Run("Hash computes checksums remotely", func(t *testing.T) {
+		fsys, err := ConnectFromConfig("/var/fixtures", "fakehost")
+		assert.NoError(t, err)
+		defer fsys.Disconnect()
+
+		for _, algo := range []string{writefs.MD5, writefs.SHA1, writefs.SHA256, writefs.SHA512} {
+			sum, err := writefs.Hash(fsys, "new-dir/file1.txt", algo)
+			assert.NoError(t, err)
+			expected, err := writefs.ReadHash(fsys, "new-dir/file1.txt", algo)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, sum)
+		}
+
+		_, err = writefs.Hash(fsys, "new-dir/unknown", writefs.SHA256)
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+		_, err = writefs.Hash(fsys, "new-dir", writefs.SHA256)
+		assert.True(t, errors.Is(err, writefs.ErrIsDir))
+
+		t.Run("HashRanges is equal to the one of the file read locally", func(t *testing.T) {
+			_, err := writefs.WriteFile(fsys, "ranges.txt", []byte("ciao, mondo\n"))
+			assert.NoError(t, err)
+			defer writefs.Remove(fsys, "ranges.txt")
+
+			sums, err := writefs.HashRanges(fsys, "ranges.txt", writefs.SHA256, 5)
+			assert.NoError(t, err)
+			expected, err := writefs.ReadHashRanges(fsys, "ranges.txt", writefs.SHA256, 5)
+			assert.NoError(t, err)
+			assert.Len(t, expected, 3)
+			assert.Equal(t, expected, sums)
+		})
+
+		t.Run("HashTree is equal to the one of the same tree read locally", func(t *testing.T) {
+			sum, err := writefs.HashTree(fsys, "new-dir", writefs.SHA256)
+			assert.NoError(t, err)
+			expected, err := writefs.HashTree(os.DirFS("/var/fixtures"), "new-dir", writefs.SHA256)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, sum)
+		})
+	})
+
+	t.Run("Sub", func(t *testing.T) {
+		fsys, err := Connect("/var/fixtures", hostCfg)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer fsys.Disconnect()
+
+		sub, err := fs.Sub(fsys, "new-dir")
+		assert.NoError(t, err)
+		subfs, ok := sub.(*SSHFS)
+		if !assert.True(t, ok) {
+			return
+		}
+		assert.Same(t, fsys.client, subfs.client)
+
+		t.Run("is rooted at dir", func(t *testing.T) {
+			buf, err := fs.ReadFile(sub, "file1.txt")
+			assert.NoError(t, err)
+			expected, err := fs.ReadFile(fsys, "new-dir/file1.txt")
+			assert.NoError(t, err)
+			assert.Equal(t, expected, buf)
+		})
+
+		t.Run("is writable", func(t *testing.T) {
+			_, err := writefs.WriteFile(sub, "subfile", []byte("ciao\n"))
+			assert.NoError(t, err)
+			buf, err := fs.ReadFile(fsys, "new-dir/subfile")
+			assert.NoError(t, err)
+			assert.Equal(t, "ciao\n", string(buf))
+			assert.NoError(t, writefs.Remove(sub, "subfile"))
+		})
+
+		t.Run("disconnecting it doesn't close the parent", func(t *testing.T) {
+			subfs.Disconnect()
+			_, err := fs.Stat(fsys, "new-dir/file1.txt")
+			assert.NoError(t, err)
+		})
+
+		t.Run("return error for invalid dir", func(t *testing.T) {
+			_, err := fsys.Sub("/etc")
+			assert.True(t, errors.Is(err, fs.ErrInvalid))
+		})
+
+		t.Run("disconnecting the parent closes the connection", func(t *testing.T) {
+			pool := &Pool{}
+			parent, err := pool.Connect("/var/fixtures", hostCfg)
+			if !assert.NoError(t, err) {
+				return
+			}
+			sub, err := fs.Sub(parent, "new-dir")
+			assert.NoError(t, err)
+			conn := parent.conn
+
+			parent.Disconnect()
+			assert.Equal(t, 0, pool.Len())
+			_, _, err = conn.ssh.SendRequest("keepalive@openssh.com", true, nil)
+			assert.Error(t, err)
+			_, err = fs.Stat(sub, "file1.txt")
+			assert.Error(t, err)
+		})
+	})
+
+	t.Run("Pool", func(t *testing.T) {
+		t.Run("shares the connection among instances for the same host", func(t *testing.T) {
+			pool := &Pool{}
+			fsys1, err := pool.ConnectFromConfig("/var/fixtures", "fakehost")
+			assert.NoError(t, err)
+			fsys2, err := pool.Connect("/var/fixtures/new-dir", hostCfg)
+			assert.NoError(t, err)
+
+			assert.Same(t, fsys1.conn, fsys2.conn)
+			assert.Same(t, fsys1.client, fsys2.client)
+			assert.Equal(t, 1, pool.Len())
+
+			fsys1.Disconnect()
+			assert.Equal(t, 1, pool.Len())
+
+			info, err := fsys2.Stat("file1.txt")
+			assert.NoError(t, err)
+			assert.Equal(t, "file1.txt", info.Name())
+
+			fsys2.Disconnect()
+			assert.Equal(t, 0, pool.Len())
+		})
+
+		t.Run("assigns sftp sessions in round robin", func(t *testing.T) {
+			pool := &Pool{Sessions: 2}
+			fsys1, err := pool.ConnectFromConfig("/var/fixtures", "fakehost")
+			assert.NoError(t, err)
+			fsys2, err := pool.ConnectFromConfig("/var/fixtures", "fakehost")
+			assert.NoError(t, err)
+			fsys3, err := pool.ConnectFromConfig("/var/fixtures", "fakehost")
+			assert.NoError(t, err)
+
+			assert.Same(t, fsys1.conn, fsys3.conn)
+			assert.NotSame(t, fsys1.client, fsys2.client)
+			assert.Same(t, fsys1.client, fsys3.client)
+
+			fsys1.Disconnect()
+			fsys2.Disconnect()
+			fsys3.Disconnect()
+			assert.Equal(t, 0, pool.Len())
+		})
+
+		t.Run("opens a dedicated sftp session for instances with options", func(t *testing.T) {
+			pool := &Pool{}
+			fsys1, err := pool.ConnectFromConfig("/var/fixtures", "fakehost")
+			assert.NoError(t, err)
+			fsys2, err := pool.ConnectFromConfig("/var/fixtures", "fakehost", Concurrency(16), PacketSize(32768))
+			assert.NoError(t, err)
+
+			assert.Same(t, fsys1.conn, fsys2.conn)
+			assert.NotSame(t, fsys1.client, fsys2.client)
+
+			client := fsys2.client
+			fsys2.Disconnect()
+			_, err = client.Getwd()
+			assert.Error(t, err)
+			_, err = fs.Stat(fsys1, "new-dir/file1.txt")
+			assert.NoError(t, err)
+
+			fsys1.Disconnect()
+			assert.Equal(t, 0, pool.Len())
+		})
+
+		t.Run("doesn't share connections authenticated with different keys", func(t *testing.T) {
+			config, err := hostToCfg(hostCfg)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.True(t, strings.HasPrefix(config.Identity, "SHA256:"))
+
+			other := *config
+			other.Identity = "SHA256:another-key"
+			assert.NotEqual(t, connectionKey(config), connectionKey(&other))
+		})
+	})
+
+	t.Run("Transfers", func(t *testing.T) {
+		fsys, err := ConnectFromConfig("/var/fixtures", "fakehost", Concurrency(8))
+		assert.NoError(t, err)
+		defer fsys.Disconnect()
+
+		content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+
+		t.Run("upload files with io.Copy", func(t *testing.T) {
+			f, err := writefs.OpenFile(fsys, "transfer.bin", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.FileMode(0644))
+			assert.NoError(t, err)
+			_, ok := f.(io.ReaderFrom)
+			assert.True(t, ok)
+			n, err := io.Copy(f, bytes.NewReader(content))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(content)), n)
+			assert.NoError(t, f.Close())
+		})
+
+		t.Run("download files with io.Copy", func(t *testing.T) {
+			f, err := fsys.Open("transfer.bin")
+			assert.NoError(t, err)
+			_, ok := f.(io.WriterTo)
+			assert.True(t, ok)
+			var buf bytes.Buffer
+			_, err = io.Copy(&buf, f)
+			assert.NoError(t, err)
+			assert.NoError(t, f.Close())
+			assert.Equal(t, content, buf.Bytes())
+		})
+
+		assert.NoError(t, writefs.Remove(fsys, "transfer.bin"))
+	})
+
+}
+
+// closeRecorder is a file that
+// records calls to its Close method.
+type closeRecorder struct {
+	writefs.FileWriter
+	closed chan struct{}
+}
+
+func (f *closeRecorder) Close() error {
+	close(f.closed)
+	return nil
+}
+
+func BenchmarkTransfer(b *testing.B) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+
+	for _, concurrency := range []int{1, 8, 64} {
+		fsys, err := ConnectFromConfig("/var/fixtures", "fakehost", Concurrency(concurrency))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("upload/concurrency=%d", concurrency), func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				f, err := writefs.OpenFile(fsys, "bench.bin", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.FileMode(0644))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(f, bytes.NewReader(content)); err != nil {
+					b.Fatal(err)
+				}
+				f.Close()
+			}
+		})
+
+		b.Run(fmt.Sprintf("download/concurrency=%d", concurrency), func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				f, err := fsys.Open("bench.bin")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(ioutil.Discard, f); err != nil {
+					b.Fatal(err)
+				}
+				f.Close()
+			}
+		})
+
+		writefs.Remove(fsys, "bench.bin")
+		fsys.Disconnect()
+	}
 }
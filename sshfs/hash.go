@@ -0,0 +1,136 @@
+package sshfs
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/parro-it/vs/writefs"
+)
+
+// hashCommands are the commands used to
+// compute checksums on the remote host.
+var hashCommands = map[string]string{
+	writefs.MD5:    "md5sum",
+	writefs.SHA1:   "sha1sum",
+	writefs.SHA256: "sha256sum",
+	writefs.SHA512: "sha512sum",
+}
+
+// Hash implements writefs.HashFS
+// The checksum is computed on the remote host by the
+// coreutils command for algo, e.g. sha256sum, so that
+// the file is not downloaded. When the command is not
+// available on the remote host, the content of the file
+// is streamed through the hash with writefs.ReadHash.
+func (fsys *SSHFS) Hash(name string, algo string) ([]byte, error) {
+	if err := fsys.checkHashable(name, algo); err != nil {
+		return nil, err
+	}
+
+	out, err := fsys.Command(hashCommands[algo], "-b", "--", name).Output()
+	if isCommandNotFound(err) {
+		return writefs.ReadHash(fsys, name, algo)
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: err}
+	}
+
+	sum, err := parseHashOutput(out)
+	if err != nil {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: err}
+	}
+	return sum, nil
+}
+
+// hashRangesScript prints the checksums of the consecutive
+// ranges of $2 bytes of the file $1, computed with command $3.
+// The file is read once by GNU split, that pipes each range
+// to a new instance of the command.
+const hashRangesScript = `exec split -b "$2" --filter="$3 -b" -- "$1"`
+
+// HashRanges implements writefs.RangeHashFS
+// The checksums are computed on the remote host, splitting
+// the file in ranges with GNU split and piping them to the
+// coreutils command for algo. When split or the command are
+// not available on the remote host, or split is not the GNU
+// one, the content of the file is streamed with
+// writefs.ReadHashRanges.
+func (fsys *SSHFS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: invalid range size %d", fs.ErrInvalid, size)
+	}
+	if err := fsys.checkHashable(name, algo); err != nil {
+		return nil, err
+	}
+
+	out, err := fsys.Command("sh", "-c", hashRangesScript, "sh",
+		name, strconv.FormatInt(size, 10), hashCommands[algo]).Output()
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return writefs.ReadHashRanges(fsys, name, algo, size)
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: err}
+	}
+
+	var sums [][]byte
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		sum, err := parseHashOutput([]byte(line))
+		if err != nil {
+			return nil, &fs.PathError{Op: "hash", Path: name, Err: err}
+		}
+		sums = append(sums, sum)
+	}
+	return sums, nil
+}
+
+// checkHashable returns an error if the checksum
+// of the named file cannot be computed with algo.
+func (fsys *SSHFS) checkHashable(name string, algo string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "hash", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, err := writefs.NewHash(algo); err != nil {
+		return err
+	}
+
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return writefs.NewPathError("hash", name, err)
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "hash", Path: name, Err: writefs.ErrIsDir}
+	}
+	return nil
+}
+
+// isCommandNotFound reports whether err is the
+// error of a remote command that was not found.
+func isCommandNotFound(err error) bool {
+	var exitErr *ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 127
+}
+
+// parseHashOutput parses the checksum from the
+// output of md5sum and similar commands, whose lines
+// are formatted as `<hex checksum> *<file name>`.
+// Lines of file names containing special characters
+// are prefixed with a backslash.
+func parseHashOutput(out []byte) ([]byte, error) {
+	fields := strings.Fields(strings.TrimPrefix(string(out), "\\"))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("unexpected checksum command output `%s`", out)
+	}
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected checksum command output `%s`", out)
+	}
+	return sum, nil
+}
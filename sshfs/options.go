@@ -0,0 +1,53 @@
+package sshfs
+
+import (
+	"github.com/pkg/sftp"
+)
+
+// Option configures the file transfers
+// of an SSHFS instance.
+type Option func(*options)
+
+type options struct {
+	concurrency int
+	packetSize  int
+}
+
+// Concurrency sets the maximum number of concurrent
+// requests issued while transferring a single file
+// with ReadFrom or WriteTo, e.g. through io.Copy.
+// Higher values improve throughput on high latency links.
+func Concurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// PacketSize sets the maximum size in bytes of the
+// data carried by each sftp request. The sftp
+// specification guarantees that servers support
+// packets of 32768 bytes: bigger sizes may be rejected.
+func PacketSize(n int) Option {
+	return func(o *options) {
+		o.packetSize = n
+	}
+}
+
+// clientOptions returns the sftp options that implement opts.
+// An SSHFS instance configured with some options uses a
+// dedicated sftp session, instead of a shared one.
+func clientOptions(opts []Option) []sftp.ClientOption {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var res []sftp.ClientOption
+	if o.concurrency > 0 {
+		res = append(res, sftp.MaxConcurrentRequestsPerFile(o.concurrency))
+	}
+	if o.packetSize > 0 {
+		res = append(res, sftp.MaxPacketUnchecked(o.packetSize))
+	}
+	return res
+}
@@ -0,0 +1,254 @@
+package sshfs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mikkeloscar/sshconfig"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// connection holds the transport shared by
+// one or more SSHFS instances. It is reference
+// counted: the sftp sessions and the owned ssh
+// clients are closed when the last SSHFS instance
+// using it disconnects.
+type connection struct {
+	lock sync.Mutex
+	// ssh is the client used as transport.
+	ssh *ssh.Client
+	// owned lists the clients to close when
+	// the connection is released by all its users,
+	// jump hosts first and ssh last.
+	owned []*ssh.Client
+	// sessions are the sftp sessions opened
+	// on ssh, assigned in round robin to users.
+	sessions    []*sftp.Client
+	maxSessions int
+	next        int
+	refs        int
+
+	pool *Pool
+	key  string
+}
+
+func newConnection(sshClient *ssh.Client, owned []*ssh.Client, maxSessions int) *connection {
+	if maxSessions < 1 {
+		maxSessions = 1
+	}
+	return &connection{
+		ssh:         sshClient,
+		owned:       owned,
+		maxSessions: maxSessions,
+	}
+}
+
+// acquire adds a user to the connection and
+// returns the sftp session it should use.
+// Users that specify sftp options get a dedicated session,
+// that they own and must close when they release the
+// connection: dedicated is true in that case.
+func (c *connection) acquire(opts []sftp.ClientOption) (session *sftp.Client, dedicated bool, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(opts) > 0 {
+		session, err = sftp.NewClient(c.ssh, opts...)
+		if err != nil {
+			return nil, false, err
+		}
+		dedicated = true
+	} else if len(c.sessions) < c.maxSessions {
+		session, err = sftp.NewClient(c.ssh)
+		if err != nil {
+			return nil, false, err
+		}
+		c.sessions = append(c.sessions, session)
+	} else {
+		session = c.sessions[c.next%len(c.sessions)]
+		c.next++
+	}
+
+	c.refs++
+	return session, dedicated, nil
+}
+
+// release removes a user from the connection,
+// closing it if it was the last one.
+func (c *connection) release() {
+	if c.pool != nil {
+		c.pool.lock.Lock()
+		defer c.pool.lock.Unlock()
+	}
+
+	c.lock.Lock()
+	c.refs--
+	last := c.refs <= 0
+	c.lock.Unlock()
+
+	if !last {
+		return
+	}
+	if c.pool != nil && c.pool.conns[c.key] == c {
+		delete(c.pool.conns, c.key)
+	}
+	c.close()
+}
+
+func (c *connection) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, session := range c.sessions {
+		session.Close()
+	}
+	c.sessions = nil
+	closeChain(c.owned)
+	c.owned = nil
+}
+
+func (c *connection) newFS(root string, opts []Option) (*SSHFS, error) {
+	client, dedicated, err := c.acquire(clientOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &SSHFS{
+		client:    client,
+		conn:      c,
+		root:      root,
+		dedicated: dedicated,
+	}, nil
+}
+
+// Pool shares a single SSH connection among
+// all SSHFS instances connected to the same host,
+// even if they use different roots.
+// Each shared connection opens up to Sessions
+// sftp sessions, assigned in round robin to
+// the SSHFS instances that use it, so that
+// they can transfer files in parallel.
+// Calling Disconnect on an SSHFS instance returned
+// by a Pool closes the shared connection only when
+// no other instance is using it.
+type Pool struct {
+	// Sessions is the maximum number of sftp
+	// sessions opened on each shared connection.
+	// Values lower than 1 are considered 1.
+	Sessions int
+
+	lock  sync.Mutex
+	conns map[string]*connection
+}
+
+// DefaultPool is the Pool used by ConnectFromConfig.
+var DefaultPool = &Pool{}
+
+// ConnectFromConfig returns a functioning instance of *SSHFS
+// using the info in ~/.ssh/config to create an SSH transport
+// layer, or reusing the one already connected to the same host.
+func (p *Pool) ConnectFromConfig(root string, sshHostName string, opts ...Option) (*SSHFS, error) {
+	err := initConfig()
+	if err != nil {
+		return nil, err
+	}
+	hostCfg, ok := cfg[sshHostName]
+	if !ok {
+		return nil, fmt.Errorf("host %s not found in ssh config", sshHostName)
+	}
+	return p.connect(root, hostCfg, opts)
+}
+
+// Connect returns a functioning instance of *SSHFS
+// using the given configuration to create an SSH transport
+// layer, or reusing the one already connected to the same host.
+func (p *Pool) Connect(root string, config *sshconfig.SSHHost, opts ...Option) (*SSHFS, error) {
+	hostCfg, err := hostToCfg(config)
+	if err != nil {
+		return nil, err
+	}
+	if hostCfg == nil {
+		return nil, fmt.Errorf("unvalid config provided")
+	}
+	return p.connect(root, hostCfg, opts)
+}
+
+// Len returns the number of connections
+// currently open in the pool.
+func (p *Pool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.conns)
+}
+
+func (p *Pool) connect(root string, config *hostCfg, opts []Option) (*SSHFS, error) {
+	key := connectionKey(config)
+
+	if fsys, err := p.reuse(key, root, opts); fsys != nil || err != nil {
+		return fsys, err
+	}
+
+	// dial without holding the lock, so that
+	// slow hosts do not block the whole pool.
+	chain, err := dial(config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.conns == nil {
+		p.conns = map[string]*connection{}
+	}
+	conn, exists := p.conns[key]
+	if exists {
+		// another goroutine connected to
+		// the same host in the meantime.
+		closeChain(chain)
+	} else {
+		conn = newConnection(chain[len(chain)-1], chain, p.Sessions)
+		conn.pool = p
+		conn.key = key
+	}
+
+	fsys, err := conn.newFS(root, opts)
+	if err != nil {
+		if !exists {
+			conn.close()
+		}
+		return nil, err
+	}
+	p.conns[key] = conn
+	return fsys, nil
+}
+
+func (p *Pool) reuse(key string, root string, opts []Option) (*SSHFS, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	conn, ok := p.conns[key]
+	if !ok {
+		return nil, nil
+	}
+	return conn.newFS(root, opts)
+}
+
+// connectionKey identifies the connections
+// that can be shared: the ones to the same host,
+// through the same proxies and authenticated
+// with the same credentials.
+func connectionKey(config *hostCfg) string {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s@%s", config.User, config.HostPort)
+	if config.Identity != "" {
+		fmt.Fprintf(&key, " identity %s", config.Identity)
+	}
+	if config.ProxyCommand != "" {
+		fmt.Fprintf(&key, " proxy-command %s", config.ProxyCommand)
+	}
+	for _, jump := range config.Jumps {
+		fmt.Fprintf(&key, " via %s", connectionKey(jump))
+	}
+	return key.String()
+}
@@ -0,0 +1,321 @@
+package sshfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dial connects to the host described by config,
+// tunnelling through each of its jump hosts in order.
+// It returns the whole chain of clients: the last
+// one is connected to the target host, the others
+// are the jump hosts used to reach it.
+// Only the first hop can use a ProxyCommand: the
+// following ones are reached through a tunnel.
+func dial(config *hostCfg) ([]*ssh.Client, error) {
+	hops := append(append([]*hostCfg{}, config.Jumps...), config)
+	for _, hop := range hops[1:] {
+		if hop.ProxyCommand != "" {
+			return nil, fmt.Errorf("cannot connect to %s: ProxyCommand cannot be used with a jump host", hop.HostPort)
+		}
+	}
+	chain := make([]*ssh.Client, 0, len(hops))
+
+	for idx, hop := range hops {
+		var client *ssh.Client
+		var err error
+		if idx == 0 {
+			client, err = dialDirect(hop)
+		} else {
+			client, err = dialThrough(chain[idx-1], hop)
+		}
+		if err != nil {
+			closeChain(chain)
+			return nil, fmt.Errorf("cannot connect to %s: %w", hop.HostPort, err)
+		}
+		chain = append(chain, client)
+	}
+
+	return chain, nil
+}
+
+// closeChain closes all clients in chain,
+// starting from the last one.
+func closeChain(chain []*ssh.Client) {
+	for idx := len(chain) - 1; idx >= 0; idx-- {
+		chain[idx].Close()
+	}
+}
+
+// dialDirect connects to the host described by config,
+// using its ProxyCommand as transport if one is configured.
+func dialDirect(config *hostCfg) (*ssh.Client, error) {
+	if config.ProxyCommand == "" {
+		return ssh.Dial("tcp", config.HostPort, config.ClientConfig)
+	}
+
+	conn, err := proxyCommandConn(config)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(conn, config)
+}
+
+// dialThrough connects to the host described by config,
+// opening a tunnel through the already connected jump client.
+func dialThrough(jump *ssh.Client, config *hostCfg) (*ssh.Client, error) {
+	conn, err := jump.Dial("tcp", config.HostPort)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(conn, config)
+}
+
+// newClient runs the ssh handshake on conn. Neither
+// tunnels nor ProxyCommand connections support deadlines:
+// conn is closed if the handshake doesn't complete
+// within the Timeout of config.
+func newClient(conn net.Conn, config *hostCfg) (*ssh.Client, error) {
+	var timer *time.Timer
+	if config.Timeout > 0 {
+		timer = time.AfterFunc(config.Timeout, func() { conn.Close() })
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, config.HostPort, config.ClientConfig)
+	if timer != nil && !timer.Stop() && err != nil {
+		err = fmt.Errorf("ssh handshake timed out after %s: %w", config.Timeout, err)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// expandProxyCommand replaces the tokens supported
+// in ProxyCommand directives with their values.
+func expandProxyCommand(command string, config *hostCfg) string {
+	host, port, err := net.SplitHostPort(config.HostPort)
+	if err != nil {
+		host = config.HostPort
+	}
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", host,
+		"%p", port,
+		"%r", config.User,
+	).Replace(command)
+}
+
+// proxyCommandConn starts the ProxyCommand configured
+// for config and returns a net.Conn that reads from its
+// standard output and writes to its standard input.
+func proxyCommandConn(config *hostCfg) (net.Conn, error) {
+	cmd := exec.Command("sh", "-c", expandProxyCommand(config.ProxyCommand, config))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &cmdConn{
+		Reader: stdout,
+		Writer: stdin,
+		cmd:    cmd,
+		stdin:  stdin,
+		addr:   cmdAddr(config.HostPort),
+	}, nil
+}
+
+// cmdConn is a net.Conn implementation
+// backed by the standard input and output
+// of a running command.
+type cmdConn struct {
+	io.Reader
+	io.Writer
+	cmd   *exec.Cmd
+	stdin io.Closer
+	addr  cmdAddr
+	once  sync.Once
+}
+
+// Close kills the command. It can be called
+// more than once, even concurrently.
+func (c *cmdConn) Close() error {
+	c.once.Do(func() {
+		c.stdin.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *cmdConn) LocalAddr() net.Addr                { return cmdAddr("proxy-command") }
+func (c *cmdConn) RemoteAddr() net.Addr               { return c.addr }
+func (c *cmdConn) SetDeadline(t time.Time) error      { return errDeadline }
+func (c *cmdConn) SetReadDeadline(t time.Time) error  { return errDeadline }
+func (c *cmdConn) SetWriteDeadline(t time.Time) error { return errDeadline }
+
+var errDeadline = errors.New("proxy-command: deadlines not supported")
+
+type cmdAddr string
+
+func (a cmdAddr) Network() string { return "proxy-command" }
+func (a cmdAddr) String() string  { return string(a) }
+
+// parseProxyJumps scans the content of an ssh config
+// file and returns the value of the ProxyJump directive
+// of every host that specifies one. The sshconfig package
+// does not support that directive, so it is read here.
+func parseProxyJumps(content string) map[string]string {
+	jumps := map[string]string{}
+	var hosts []string
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value := splitDirective(line)
+		switch strings.ToLower(key) {
+		case "host":
+			hosts = strings.Fields(value)
+		case "proxyjump":
+			for _, host := range hosts {
+				if _, exists := jumps[host]; !exists {
+					jumps[host] = value
+				}
+			}
+		}
+	}
+
+	return jumps
+}
+
+func splitDirective(line string) (string, string) {
+	idx := strings.IndexAny(line, " \t=")
+	if idx == -1 {
+		return line, ""
+	}
+	value := strings.TrimLeft(line[idx:], " \t=")
+	return line[:idx], strings.TrimSpace(value)
+}
+
+// jumpSpec is a single hop of a ProxyJump
+// directive, in the form [user@]host[:port]
+type jumpSpec struct {
+	User string
+	Host string
+	Port int
+}
+
+func parseJumpSpecs(value string) ([]jumpSpec, error) {
+	if value == "" || strings.EqualFold(value, "none") {
+		return nil, nil
+	}
+
+	var specs []jumpSpec
+	for _, hop := range strings.Split(value, ",") {
+		hop = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(hop), "ssh://"))
+		spec := jumpSpec{}
+		if idx := strings.LastIndex(hop, "@"); idx != -1 {
+			spec.User = hop[:idx]
+			hop = hop[idx+1:]
+		}
+		spec.Host = hop
+		if host, port, err := net.SplitHostPort(hop); err == nil {
+			p, err := strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port in ProxyJump `%s`: %w", value, err)
+			}
+			spec.Host = host
+			spec.Port = p
+		}
+		if spec.Host == "" {
+			return nil, fmt.Errorf("invalid ProxyJump `%s`", value)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// resolveJumps converts the hops of a ProxyJump directive
+// into the host configurations to tunnel through, in order.
+// Hops that name a host configured in hosts use that
+// configuration, and are preceded by the hops of the
+// ProxyJump of that host in proxyJumps, resolved recursively.
+// The other hops reuse the credentials of target.
+// visiting lists the hosts whose ProxyJump is being
+// resolved, to report loops as errors.
+func resolveJumps(value string, target *hostCfg, hosts map[string]*hostCfg, proxyJumps map[string]string, visiting []string) ([]*hostCfg, error) {
+	specs, err := parseJumpSpecs(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var jumps []*hostCfg
+	for _, spec := range specs {
+		known, isKnown := hosts[spec.Host]
+		if nested, ok := proxyJumps[spec.Host]; ok && isKnown {
+			for _, host := range visiting {
+				if host == spec.Host {
+					return nil, fmt.Errorf("ProxyJump loop: %s -> %s", strings.Join(visiting, " -> "), spec.Host)
+				}
+			}
+			chain, err := resolveJumps(nested, known, hosts, proxyJumps, append(visiting[:len(visiting):len(visiting)], spec.Host))
+			if err != nil {
+				return nil, err
+			}
+			jumps = append(jumps, chain...)
+		}
+
+		if isKnown && spec.User == "" && spec.Port == 0 {
+			// the jumps of known are already in the chain
+			hop := *known
+			hop.Jumps = nil
+			jumps = append(jumps, &hop)
+			continue
+		}
+
+		clientConfig := *target.ClientConfig
+		port := spec.Port
+		if isKnown {
+			clientConfig = *known.ClientConfig
+			host, knownPort, err := net.SplitHostPort(known.HostPort)
+			if err == nil {
+				spec.Host = host
+				if port == 0 {
+					port, _ = strconv.Atoi(knownPort)
+				}
+			}
+		}
+		if port == 0 {
+			port = 22
+		}
+		if spec.User != "" {
+			clientConfig.User = spec.User
+		}
+		jumps = append(jumps, &hostCfg{
+			ClientConfig: &clientConfig,
+			HostPort:     net.JoinHostPort(spec.Host, strconv.Itoa(port)),
+		})
+	}
+	return jumps, nil
+}
@@ -0,0 +1,201 @@
+package sshfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestProxy(t *testing.T) {
+	t.Run("parse ProxyJump directives from ssh config", func(t *testing.T) {
+		jumps := parseProxyJumps(`
+Host *
+    ServerAliveInterval 300
+
+Host bastion
+    HostName bastion.example.com
+    User admin
+
+# a comment
+Host node1 node2
+    HostName 10.0.0.1
+    ProxyJump bastion,jumper@other:2222
+
+Host node3
+    ProxyJump=none
+`)
+		assert.Equal(t, map[string]string{
+			"node1": "bastion,jumper@other:2222",
+			"node2": "bastion,jumper@other:2222",
+			"node3": "none",
+		}, jumps)
+	})
+
+	t.Run("parse jump specs", func(t *testing.T) {
+		specs, err := parseJumpSpecs("bastion, jumper@other:2222,ssh://root@third")
+		assert.NoError(t, err)
+		assert.Equal(t, []jumpSpec{
+			{Host: "bastion"},
+			{User: "jumper", Host: "other", Port: 2222},
+			{User: "root", Host: "third"},
+		}, specs)
+
+		specs, err = parseJumpSpecs("none")
+		assert.NoError(t, err)
+		assert.Nil(t, specs)
+
+		_, err = parseJumpSpecs("user@")
+		assert.Error(t, err)
+	})
+
+	t.Run("resolve jumps using known hosts", func(t *testing.T) {
+		target := &hostCfg{
+			ClientConfig: &ssh.ClientConfig{User: "andrea"},
+			HostPort:     "10.0.0.1:22",
+		}
+		bastion := &hostCfg{
+			ClientConfig: &ssh.ClientConfig{User: "admin"},
+			HostPort:     "bastion.example.com:22",
+		}
+		hosts := map[string]*hostCfg{"bastion": bastion, "node1": target}
+
+		jumps, err := resolveJumps("bastion,bastion:2200,jumper@other", target, hosts, nil, []string{"node1"})
+		assert.NoError(t, err)
+		if assert.Len(t, jumps, 3) {
+			assert.Equal(t, bastion, jumps[0])
+
+			assert.Equal(t, "bastion.example.com:2200", jumps[1].HostPort)
+			assert.Equal(t, "admin", jumps[1].User)
+
+			assert.Equal(t, "other:22", jumps[2].HostPort)
+			assert.Equal(t, "jumper", jumps[2].User)
+		}
+		assert.Equal(t, "andrea", target.User)
+	})
+
+	t.Run("resolve the jumps of jump hosts recursively", func(t *testing.T) {
+		host := func(hostPort string) *hostCfg {
+			return &hostCfg{ClientConfig: &ssh.ClientConfig{User: "andrea"}, HostPort: hostPort}
+		}
+		hosts := map[string]*hostCfg{
+			"node1":   host("10.0.0.1:22"),
+			"inner":   host("10.0.0.254:22"),
+			"bastion": host("bastion.example.com:22"),
+		}
+		proxyJumps := map[string]string{"node1": "inner", "inner": "bastion"}
+
+		jumps, err := resolveJumps("inner", hosts["node1"], hosts, proxyJumps, []string{"node1"})
+		assert.NoError(t, err)
+		var hostPorts []string
+		for _, jump := range jumps {
+			hostPorts = append(hostPorts, jump.HostPort)
+			assert.Empty(t, jump.Jumps)
+		}
+		assert.Equal(t, []string{"bastion.example.com:22", "10.0.0.254:22"}, hostPorts)
+
+		proxyJumps["bastion"] = "node1"
+		_, err = resolveJumps("inner", hosts["node1"], hosts, proxyJumps, []string{"node1"})
+		assert.EqualError(t, err, "ProxyJump loop: node1 -> inner -> bastion -> node1")
+	})
+
+	t.Run("connect through nested jump hosts", func(t *testing.T) {
+		dir := t.TempDir()
+		host := "    HostName localhost\n    IdentityFile /var/fixtures/private-key\n    User andrea.parodi\n    Port 2222\n"
+		config := "Host jump1\n" + host +
+			"Host jump2\n" + host + "    ProxyJump jump1\n" +
+			"Host target\n" + host + "    ProxyJump jump2\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte(config), 0644))
+
+		hosts, err := loadConfig(os.DirFS(dir), "config")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Len(t, hosts["target"].Jumps, 2)
+
+		fsys, err := connect("/var/fixtures", hosts["target"], nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer fsys.Disconnect()
+		_, err = fs.Stat(fsys, "new-dir")
+		assert.NoError(t, err)
+	})
+
+	t.Run("match hosts by all their aliases", func(t *testing.T) {
+		config := "Host node1 node2 *.internal\n    HostName localhost\n    IdentityFile /var/fixtures/private-key\n    Port 2222\n"
+		hosts, err := loadConfig(fstest.MapFS{"config": &fstest.MapFile{Data: []byte(config)}}, "config")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Same(t, hosts["node1"], hosts["node2"])
+		assert.NotContains(t, hosts, "*.internal")
+	})
+
+	t.Run("return an error for ProxyCommand of hops after the first", func(t *testing.T) {
+		config := &hostCfg{
+			ClientConfig: &ssh.ClientConfig{},
+			HostPort:     "node1:22",
+			ProxyCommand: "nc %h %p",
+			Jumps:        []*hostCfg{{ClientConfig: &ssh.ClientConfig{}, HostPort: "bastion:22"}},
+		}
+		_, err := dial(config)
+		assert.EqualError(t, err, "cannot connect to node1:22: ProxyCommand cannot be used with a jump host")
+	})
+
+	t.Run("close ProxyCommand connections when the handshake times out", func(t *testing.T) {
+		config := &hostCfg{
+			ClientConfig: &ssh.ClientConfig{Timeout: 100 * time.Millisecond, HostKeyCallback: ssh.InsecureIgnoreHostKey()},
+			HostPort:     "node1:22",
+			ProxyCommand: "sleep 10",
+		}
+		conn, err := proxyCommandConn(config)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Error(t, conn.SetDeadline(time.Now()))
+
+		start := time.Now()
+		_, err = newClient(conn, config)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "ssh handshake timed out after 100ms")
+		assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	})
+
+	t.Run("expand ProxyCommand tokens", func(t *testing.T) {
+		config := &hostCfg{
+			ClientConfig: &ssh.ClientConfig{User: "andrea"},
+			HostPort:     "node1:2222",
+		}
+		cmd := expandProxyCommand("ssh -W %h:%p -l %r bastion # 100%%", config)
+		assert.Equal(t, "ssh -W node1:2222 -l andrea bastion # 100%", cmd)
+	})
+
+	t.Run("ProxyCommand connection uses command stdin and stdout", func(t *testing.T) {
+		config := &hostCfg{
+			ClientConfig: &ssh.ClientConfig{},
+			HostPort:     "node1:22",
+			ProxyCommand: "cat",
+		}
+		conn, err := proxyCommandConn(config)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		assert.Equal(t, "node1:22", conn.RemoteAddr().String())
+
+		_, err = conn.Write([]byte("ciao"))
+		assert.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao", string(buf))
+	})
+}
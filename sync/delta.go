@@ -0,0 +1,129 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/parro-it/vs/diff"
+	"github.com/parro-it/vs/writefs"
+)
+
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// seekWriter implements io.WriterAt
+// for files that can seek.
+type seekWriter struct {
+	io.WriteSeeker
+}
+
+func (w seekWriter) WriteAt(buf []byte, off int64) (int, error) {
+	if _, err := w.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return w.Write(buf)
+}
+
+// writerAt returns an io.WriterAt that writes on f.
+func writerAt(f writefs.FileWriter) (io.WriterAt, bool) {
+	if w, ok := f.(io.WriterAt); ok {
+		return w, true
+	}
+	if w, ok := f.(io.WriteSeeker); ok {
+		return seekWriter{w}, true
+	}
+	return nil, false
+}
+
+// delta updates the named file in place, writing only
+// the blocks whose checksums differ from the ones of
+// the blocks of src. The checksums of the destination
+// file are computed by dst with writefs.HashRanges, so
+// that its content is never read. It returns false if
+// dst or the destination file don't support it.
+func (s *syncer) delta(name string, entry *diff.Entry) (bool, error) {
+	if _, ok := s.dst.(writefs.RangeHashFS); !ok {
+		return false, nil
+	}
+	h, err := writefs.NewHash(s.opts.Hash)
+	if err != nil {
+		return false, err
+	}
+	dstSums, err := writefs.HashRanges(s.dst, name, s.opts.Hash, s.opts.BlockSize)
+	if err != nil {
+		return false, err
+	}
+
+	dst, err := s.dst.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return false, err
+	}
+	w, isWriterAt := writerAt(dst)
+	t, isTruncater := dst.(truncater)
+	if !isWriterAt || !isTruncater {
+		dst.Close()
+		return false, nil
+	}
+
+	src, err := s.src.Open(name)
+	if err != nil {
+		dst.Close()
+		return false, err
+	}
+	defer src.Close()
+
+	buf := make([]byte, s.opts.BlockSize)
+	var off int64
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			h.Reset()
+			h.Write(buf[:n])
+			if i < len(dstSums) && bytes.Equal(h.Sum(nil), dstSums[i]) {
+				s.res.BytesMatched += int64(n)
+			} else if err := s.writeAt(w, buf[:n], off); err != nil {
+				dst.Close()
+				return false, err
+			}
+			off += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			dst.Close()
+			return false, err
+		}
+	}
+
+	if err := t.Truncate(off); err != nil {
+		dst.Close()
+		return false, err
+	}
+	if err := dst.Close(); err != nil {
+		return false, err
+	}
+	return true, s.setAttrs(name, entry)
+}
+
+// writeAt writes buf at off, splitting it in
+// chunks that respect the bandwidth limit.
+func (s *syncer) writeAt(w io.WriterAt, buf []byte, off int64) error {
+	chunk := s.limit.chunk()
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > chunk {
+			n = chunk
+		}
+		if _, err := w.WriteAt(buf[:n], off); err != nil {
+			return err
+		}
+		s.res.BytesSent += int64(n)
+		s.limit.wait(n)
+		buf = buf[n:]
+		off += int64(n)
+	}
+	return nil
+}
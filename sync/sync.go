@@ -0,0 +1,331 @@
+// Package sync makes a writable file system match
+// the content of another one, transferring only the
+// files that changed, like a one-way rsync.
+//
+//	res, err := sync.Tree(osfs.DirWriteFS("build"), remote, sync.Options{
+//		Delete:  true,
+//		Exclude: []string{"*.tmp"},
+//	})
+package sync
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/parro-it/vs/diff"
+	"github.com/parro-it/vs/writefs"
+)
+
+// DefaultBlockSize is the size of the blocks compared
+// by delta transfers of options that don't specify one.
+const DefaultBlockSize = 64 * 1024
+
+// Options configures a synchronization.
+type Options struct {
+	// Delete removes from the destination the
+	// entries that don't exist in the source.
+	// Excluded entries are never removed.
+	Delete bool
+	// DryRun computes the changes needed to
+	// synchronize the destination without applying them.
+	DryRun bool
+	// Checksum compares files by their checksum instead
+	// of by size and modification time. Checksums are
+	// computed remotely by file systems that implement
+	// writefs.HashFS.
+	Checksum bool
+	// Hash is the algorithm used to compute checksums,
+	// one of the writefs hash algorithms. It defaults
+	// to writefs.SHA256.
+	Hash string
+	// ModTimeWindow is the maximum difference between
+	// the modification times of two files considered
+	// equal. See diff.Options.
+	ModTimeWindow time.Duration
+	// Exclude are path.Match patterns of entries excluded
+	// from the synchronization. A pattern is matched both
+	// against the base name and the path of each entry.
+	Exclude []string
+	// BandwidthLimit is the maximum number of bytes
+	// per second written to the destination.
+	// Zero means no limit.
+	BandwidthLimit int64
+	// BlockSize is the size of the blocks compared by
+	// delta transfers. It defaults to DefaultBlockSize.
+	BlockSize int64
+}
+
+// Result describes a synchronization.
+type Result struct {
+	// Changes are the changes applied to the destination,
+	// or that would be applied for dry runs.
+	Changes []diff.Change
+	// BytesSent is the number of bytes written
+	// to the destination.
+	BytesSent int64
+	// BytesMatched is the number of bytes of modified files
+	// not transferred because the destination already had them.
+	BytesMatched int64
+}
+
+// Tree makes the tree rooted at dst match the one rooted
+// at src, creating, updating and optionally removing the
+// entries of dst that differ from src.
+//
+// Permissions and modification times of files are copied
+// when dst implements writefs.ChmodFS and writefs.ChtimesFS;
+// otherwise files always differ by modification time
+// unless Checksum is used.
+//
+// When dst implements writefs.RangeHashFS, modified files are
+// updated in place, transferring only the blocks whose checksums
+// differ from the ones dst computes, e.g. remotely. The
+// modification time is copied last, so a file left partially
+// updated by a failure differs from src until the next Tree.
+func Tree(src fs.FS, dst writefs.WriteFS, opts Options) (Result, error) {
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.BlockSize < 0 {
+		return Result{}, fmt.Errorf("%w: invalid block size %d", fs.ErrInvalid, opts.BlockSize)
+	}
+	if opts.Hash == "" {
+		opts.Hash = writefs.SHA256
+	}
+
+	compare := diff.BySizeModTime
+	if opts.Checksum {
+		compare = diff.ByHash
+	}
+	changes, err := diff.Trees(dst, src, diff.Options{
+		Compare:       compare,
+		Hash:          opts.Hash,
+		ModTimeWindow: opts.ModTimeWindow,
+		Ignore:        opts.Exclude,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	s := &syncer{
+		src:   src,
+		dst:   dst,
+		opts:  opts,
+		limit: newLimiter(opts.BandwidthLimit),
+	}
+	var removed []string
+	for _, c := range changes {
+		if c.Kind == diff.Removed {
+			if !opts.Delete {
+				continue
+			}
+			removed = append(removed, c.Path)
+		} else if !opts.DryRun {
+			if err := s.apply(c); err != nil {
+				return s.res, err
+			}
+		}
+		s.res.Changes = append(s.res.Changes, c)
+	}
+
+	if opts.DryRun {
+		return s.res, nil
+	}
+
+	// removed directories precede their
+	// content: remove them in reverse order.
+	for i := len(removed) - 1; i >= 0; i-- {
+		if err := writefs.Remove(dst, removed[i]); err != nil {
+			return s.res, err
+		}
+	}
+	return s.res, nil
+}
+
+type syncer struct {
+	src   fs.FS
+	dst   writefs.WriteFS
+	opts  Options
+	limit *limiter
+	res   Result
+}
+
+func (s *syncer) apply(c diff.Change) error {
+	switch c.Kind {
+	case diff.Added:
+		if c.New.Mode.IsDir() {
+			return writefs.MkDir(s.dst, c.Path, c.New.Mode.Perm())
+		}
+		return s.copyFile(c.Path, c.New)
+
+	case diff.ModeChanged:
+		return s.chmod(c.Path, c.New.Mode)
+
+	case diff.Modified:
+		if c.Old.Mode.IsDir() != c.New.Mode.IsDir() {
+			if err := s.removeAll(c.Path); err != nil {
+				return err
+			}
+			return s.copyTree(c.Path)
+		}
+		done, err := s.delta(c.Path, c.New)
+		if err != nil || done {
+			return err
+		}
+		return s.copyFile(c.Path, c.New)
+	}
+	return fmt.Errorf("unexpected change kind %s", c.Kind)
+}
+
+// copyFile copies the whole content of the named file.
+func (s *syncer) copyFile(name string, entry *diff.Entry) error {
+	src, err := s.src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := s.dst.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, s.limit.chunk())
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				dst.Close()
+				return err
+			}
+			s.res.BytesSent += int64(n)
+			s.limit.wait(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			dst.Close()
+			return err
+		}
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return s.setAttrs(name, entry)
+}
+
+// copyTree copies the named entry of src and,
+// if it's a directory, all of its content.
+func (s *syncer) copyTree(name string) error {
+	return fs.WalkDir(s.src, name, func(entryName string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entryName != name && s.excluded(entryName) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := &diff.Entry{Mode: info.Mode(), Size: info.Size(), ModTime: info.ModTime()}
+		if d.IsDir() {
+			return writefs.MkDir(s.dst, entryName, entry.Mode.Perm())
+		}
+		return s.copyFile(entryName, entry)
+	})
+}
+
+// removeAll removes the named entry of dst
+// and, if it's a directory, all of its content.
+func (s *syncer) removeAll(name string) error {
+	var names []string
+	err := fs.WalkDir(s.dst, name, func(entryName string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, entryName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		if err := writefs.Remove(s.dst, names[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncer) excluded(name string) bool {
+	return diff.Options{Ignore: s.opts.Exclude}.Ignored(name)
+}
+
+// setAttrs copies the permissions and the
+// modification time of a file to dst.
+func (s *syncer) setAttrs(name string, entry *diff.Entry) error {
+	if err := s.chmod(name, entry.Mode); err != nil {
+		return err
+	}
+	if _, ok := s.dst.(writefs.ChtimesFS); ok {
+		return writefs.Chtimes(s.dst, name, entry.ModTime, entry.ModTime)
+	}
+	return nil
+}
+
+func (s *syncer) chmod(name string, mode fs.FileMode) error {
+	if _, ok := s.dst.(writefs.ChmodFS); ok {
+		return writefs.Chmod(s.dst, name, mode.Perm())
+	}
+	return nil
+}
+
+// limiter limits the rate of writes to
+// a maximum number of bytes per second.
+type limiter struct {
+	rate  int64
+	start time.Time
+	sent  int64
+}
+
+func newLimiter(rate int64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: rate, start: time.Now()}
+}
+
+// chunk returns the maximum size of a single write.
+func (l *limiter) chunk() int {
+	const maxChunk = 32 * 1024
+	if l == nil || l.rate >= maxChunk*10 {
+		return maxChunk
+	}
+	// at least 10 writes per second, to
+	// keep the transfer rate smooth.
+	if l.rate < 10 {
+		return 1
+	}
+	return int(l.rate / 10)
+}
+
+// wait sleeps until writing n more bytes
+// respects the limit.
+func (l *limiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.sent += int64(n)
+	expected := time.Duration(float64(l.sent) / float64(l.rate) * float64(time.Second))
+	if d := expected - time.Since(l.start); d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,261 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/parro-it/vs/diff"
+	"github.com/parro-it/vs/faultfs"
+	"github.com/parro-it/vs/memfs"
+	"github.com/parro-it/vs/sshfs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree(t *testing.T) {
+	errBoom := errors.New("boom")
+	mtime := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	newSrc := func() *memfs.MapWriteFS {
+		src := memfs.New()
+		src.MapFS["afile"] = &fstest.MapFile{Data: []byte("ciao\n"), Mode: 0644, ModTime: mtime}
+		src.MapFS["secret"] = &fstest.MapFile{Data: []byte("secret\n"), Mode: 0600, ModTime: mtime}
+		src.MapFS["adir"] = &fstest.MapFile{Mode: fs.ModeDir | 0755, ModTime: mtime}
+		src.MapFS["adir/nested"] = &fstest.MapFile{Data: []byte("miao\n"), Mode: 0644, ModTime: mtime}
+		src.MapFS["adir/ignored.tmp"] = &fstest.MapFile{Data: []byte("tmp\n"), Mode: 0644, ModTime: mtime}
+		return src
+	}
+
+	changesOf := func(t *testing.T, src, dst fs.FS, opts diff.Options) []string {
+		changes, err := diff.Trees(dst, src, opts)
+		assert.NoError(t, err)
+		var res []string
+		for _, c := range changes {
+			res = append(res, c.String())
+		}
+		return res
+	}
+
+	t.Run("copies all files to an empty destination", func(t *testing.T) {
+		src := newSrc()
+		dst := memfs.New()
+		res, err := Tree(src, dst, Options{})
+		assert.NoError(t, err)
+		assert.Len(t, res.Changes, 5)
+		assert.Equal(t, int64(21), res.BytesSent)
+
+		assert.Empty(t, changesOf(t, src, dst, diff.Options{}))
+		assert.Empty(t, changesOf(t, src, dst, diff.Options{Compare: diff.ByHash}))
+
+		info, err := fs.Stat(dst, "secret")
+		assert.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+
+		t.Run("then transfers nothing", func(t *testing.T) {
+			res, err := Tree(src, dst, Options{})
+			assert.NoError(t, err)
+			assert.Empty(t, res.Changes)
+			assert.Equal(t, int64(0), res.BytesSent)
+		})
+	})
+
+	t.Run("updates modified files", func(t *testing.T) {
+		src := newSrc()
+		dst := memfs.New()
+		_, err := Tree(src, dst, Options{})
+		assert.NoError(t, err)
+
+		src.MapFS["afile"] = &fstest.MapFile{Data: []byte("ciao ciao\n"), Mode: 0640, ModTime: mtime.Add(time.Hour)}
+		src.MapFS["secret"].Mode = 0400
+		res, err := Tree(src, dst, Options{})
+		assert.NoError(t, err)
+		assert.Len(t, res.Changes, 2)
+
+		buf, err := fs.ReadFile(dst, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao ciao\n", string(buf))
+		assert.Empty(t, changesOf(t, src, dst, diff.Options{}))
+	})
+
+	t.Run("keeps extraneous files unless Delete is set", func(t *testing.T) {
+		src := newSrc()
+		dst := memfs.New()
+		_, err := writefs.WriteFile(dst, "extraneous", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.MkDir(dst, "olddir", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(dst, "olddir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		_, err = Tree(src, dst, Options{})
+		assert.NoError(t, err)
+		_, err = fs.Stat(dst, "extraneous")
+		assert.NoError(t, err)
+
+		res, err := Tree(src, dst, Options{Delete: true})
+		assert.NoError(t, err)
+		assert.Len(t, res.Changes, 3)
+		_, err = fs.Stat(dst, "extraneous")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+		_, err = fs.Stat(dst, "olddir")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("DryRun reports changes without applying them", func(t *testing.T) {
+		src := newSrc()
+		dst := memfs.New()
+		_, err := writefs.WriteFile(dst, "extraneous", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		res, err := Tree(src, dst, Options{DryRun: true, Delete: true})
+		assert.NoError(t, err)
+		assert.Len(t, res.Changes, 6)
+		assert.Equal(t, []string{"extraneous"}, keys(dst))
+	})
+
+	t.Run("Exclude skips matching entries on both sides", func(t *testing.T) {
+		src := newSrc()
+		dst := memfs.New()
+		_, err := writefs.WriteFile(dst, "keep.tmp", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		_, err = Tree(src, dst, Options{Delete: true, Exclude: []string{"*.tmp", "secret"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"adir", "adir/nested", "afile", "keep.tmp"}, keys(dst))
+	})
+
+	t.Run("Checksum detects changes with same size and mtime", func(t *testing.T) {
+		src := newSrc()
+		dst := memfs.New()
+		_, err := Tree(src, dst, Options{})
+		assert.NoError(t, err)
+
+		src.MapFS["afile"].Data = []byte("miao\n")
+		res, err := Tree(src, dst, Options{})
+		assert.NoError(t, err)
+		assert.Empty(t, res.Changes)
+
+		res, err = Tree(src, dst, Options{Checksum: true})
+		assert.NoError(t, err)
+		assert.Len(t, res.Changes, 1)
+		buf, err := fs.ReadFile(dst, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "miao\n", string(buf))
+	})
+
+	t.Run("replaces files with directories and vice versa", func(t *testing.T) {
+		src := newSrc()
+		dst := memfs.New()
+		_, err := writefs.WriteFile(dst, "adir", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.MkDir(dst, "afile", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(dst, "afile/nested", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		_, err = Tree(src, dst, Options{Exclude: []string{"*.tmp"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"adir", "adir/nested", "afile", "secret"}, keys(dst))
+		assert.Empty(t, changesOf(t, src, dst, diff.Options{Ignore: []string{"*.tmp"}}))
+	})
+
+	t.Run("transfers only changed blocks", func(t *testing.T) {
+		content := bytes.Repeat([]byte("0123456789"), 100)
+		src := memfs.New()
+		src.MapFS["big"] = &fstest.MapFile{Data: content, Mode: 0644, ModTime: mtime}
+		dst := memfs.New()
+		_, err := Tree(src, dst, Options{})
+		assert.NoError(t, err)
+
+		changed := append([]byte{}, content...)
+		copy(changed[250:], "CHANGED")
+		src.MapFS["big"] = &fstest.MapFile{Data: changed, Mode: 0644, ModTime: mtime.Add(time.Hour)}
+		res, err := Tree(src, dst, Options{BlockSize: 100})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(100), res.BytesSent)
+		assert.Equal(t, int64(900), res.BytesMatched)
+		buf, err := fs.ReadFile(dst, "big")
+		assert.NoError(t, err)
+		assert.Equal(t, changed, buf)
+
+		t.Run("and truncates shrunk files", func(t *testing.T) {
+			src.MapFS["big"] = &fstest.MapFile{Data: changed[:450], Mode: 0644, ModTime: mtime.Add(2 * time.Hour)}
+			res, err := Tree(src, dst, Options{BlockSize: 100})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(50), res.BytesSent)
+			assert.Equal(t, int64(400), res.BytesMatched)
+			buf, err := fs.ReadFile(dst, "big")
+			assert.NoError(t, err)
+			assert.Equal(t, changed[:450], buf)
+		})
+
+		t.Run("without reading the destination files", func(t *testing.T) {
+			copy(changed[50:], "AGAIN")
+			src.MapFS["big"] = &fstest.MapFile{Data: changed[:450], Mode: 0644, ModTime: mtime.Add(3 * time.Hour)}
+			res, err := Tree(src, faultfs.New(dst, 42, faultfs.Fault{Op: "read", Err: errBoom}), Options{BlockSize: 100})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(100), res.BytesSent)
+			buf, err := fs.ReadFile(dst, "big")
+			assert.NoError(t, err)
+			assert.Equal(t, changed[:450], buf)
+		})
+
+		t.Run("limiting the bandwidth of writes", func(t *testing.T) {
+			copy(changed[150:], "LIMITED")
+			src.MapFS["big"] = &fstest.MapFile{Data: changed[:450], Mode: 0644, ModTime: mtime.Add(4 * time.Hour)}
+			start := time.Now()
+			res, err := Tree(src, dst, Options{BlockSize: 100, BandwidthLimit: 200})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(100), res.BytesSent)
+			assert.GreaterOrEqual(t, int64(time.Since(start)), int64(450*time.Millisecond))
+		})
+	})
+
+	t.Run("BandwidthLimit limits the transfer rate", func(t *testing.T) {
+		src := memfs.New()
+		src.MapFS["big"] = &fstest.MapFile{Data: make([]byte, 5000), Mode: 0644, ModTime: mtime}
+		dst := memfs.New()
+		start := time.Now()
+		_, err := Tree(src, dst, Options{BandwidthLimit: 10000})
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(450*time.Millisecond))
+	})
+
+	t.Run("pushes trees to SSHFS", func(t *testing.T) {
+		remote, err := sshfs.ConnectFromConfig("/var/fixtures", "fakehost")
+		assert.NoError(t, err)
+		defer remote.Disconnect()
+		assert.NoError(t, remote.Command("rm", "-rf", "synced").Run())
+		assert.NoError(t, writefs.MkDir(remote, "synced", fs.FileMode(0755)))
+		dst, err := writefs.Sub(remote, "synced")
+		assert.NoError(t, err)
+
+		src := newSrc()
+		src.MapFS["big"] = &fstest.MapFile{Data: bytes.Repeat([]byte("0123456789"), 100), Mode: 0644, ModTime: mtime}
+		_, err = Tree(src, dst, Options{})
+		assert.NoError(t, err)
+		assert.Empty(t, changesOf(t, src, dst, diff.Options{Compare: diff.BySizeModTimeAndHash}))
+
+		copy(src.MapFS["big"].Data[500:], "CHANGED")
+		src.MapFS["big"].ModTime = mtime.Add(time.Hour)
+		res, err := Tree(src, dst, Options{BlockSize: 100})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(100), res.BytesSent)
+		assert.Empty(t, changesOf(t, src, dst, diff.Options{Compare: diff.ByHash}))
+
+		assert.NoError(t, remote.Command("rm", "-rf", "synced").Run())
+	})
+}
+
+func keys(fsys *memfs.MapWriteFS) []string {
+	var res []string
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if name != "." {
+			res = append(res, name)
+		}
+		return err
+	})
+	return res
+}
@@ -1,21 +1,25 @@
 package syncfs
 
 import (
+	"context"
 	"io/fs"
 	"sync"
+	"time"
 
 	"github.com/parro-it/vs/writefs"
 )
 
 type fsT struct {
-	lock   sync.Mutex
+	// lock is shared with the
+	// file systems returned by Sub
+	lock   *sync.Mutex
 	wrapfs fs.FS
 }
 
 // New ...
 func New(fsys fs.FS) fs.FS {
 	return &fsT{
-		lock:   sync.Mutex{},
+		lock:   &sync.Mutex{},
 		wrapfs: fsys,
 	}
 }
@@ -27,9 +31,22 @@ var (
 	_ fs.ReadDirFS  = &fsT{}
 	_ fs.GlobFS     = &fsT{}
 
-	_ writefs.WriteFS  = &fsT{}
-	_ writefs.RemoveFS = &fsT{}
-	_ writefs.MkDirFS  = &fsT{}
+	_ writefs.WriteFS     = &fsT{}
+	_ writefs.RemoveFS    = &fsT{}
+	_ writefs.MkDirFS     = &fsT{}
+	_ writefs.StatVFSFS   = &fsT{}
+	_ writefs.HashFS      = &fsT{}
+	_ writefs.RangeHashFS = &fsT{}
+	_ writefs.ChmodFS     = &fsT{}
+	_ writefs.ChtimesFS   = &fsT{}
+	_ writefs.WatchFS     = &fsT{}
+	_ writefs.ReadLinkFS  = &fsT{}
+	_ writefs.RenameFS    = &fsT{}
+
+	_ writefs.OpenFileContextFS = &fsT{}
+	_ writefs.MkDirContextFS    = &fsT{}
+	_ writefs.RemoveContextFS   = &fsT{}
+	_ writefs.StatContextFS     = &fsT{}
 )
 
 // MkDir implements writefs.MkDirFS
@@ -54,6 +71,96 @@ func (fsys *fsT) OpenFile(name string, flag int, perm fs.FileMode) (writefs.File
 	return writefs.OpenFile(fsys.wrapfs, name, flag, perm)
 }
 
+// StatVFS implements writefs.StatVFSFS
+func (fsys *fsT) StatVFS(name string) (writefs.StatFSInfo, error) {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.StatVFS(fsys.wrapfs, name)
+}
+
+// Hash implements writefs.HashFS
+func (fsys *fsT) Hash(name string, algo string) ([]byte, error) {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.Hash(fsys.wrapfs, name, algo)
+}
+
+// HashRanges implements writefs.RangeHashFS
+func (fsys *fsT) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.HashRanges(fsys.wrapfs, name, algo, size)
+}
+
+// Chmod implements writefs.ChmodFS
+func (fsys *fsT) Chmod(name string, mode fs.FileMode) error {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.Chmod(fsys.wrapfs, name, mode)
+}
+
+// Chtimes implements writefs.ChtimesFS
+func (fsys *fsT) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.Chtimes(fsys.wrapfs, name, atime, mtime)
+}
+
+// Rename implements writefs.RenameFS
+func (fsys *fsT) Rename(oldname string, newname string) error {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.Rename(fsys.wrapfs, oldname, newname)
+}
+
+// ReadLink implements writefs.ReadLinkFS
+func (fsys *fsT) ReadLink(name string) (string, error) {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.ReadLink(fsys.wrapfs, name)
+}
+
+// Watch implements writefs.WatchFS
+// File systems that don't implement writefs.WatchFS
+// are polled through fsys, so that scans are
+// serialized with the other operations.
+func (fsys *fsT) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	if _, ok := fsys.wrapfs.(writefs.WatchFS); !ok {
+		return writefs.PollWatch(ctx, fsys, name, recursive, writefs.DefaultPollInterval)
+	}
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.Watch(ctx, fsys.wrapfs, name, recursive)
+}
+
+// OpenFileContext implements writefs.OpenFileContextFS
+func (fsys *fsT) OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.OpenFileContext(ctx, fsys.wrapfs, name, flag, perm)
+}
+
+// MkDirContext implements writefs.MkDirContextFS
+func (fsys *fsT) MkDirContext(ctx context.Context, name string, perm fs.FileMode) error {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.MkDirContext(ctx, fsys.wrapfs, name, perm)
+}
+
+// RemoveContext implements writefs.RemoveContextFS
+func (fsys *fsT) RemoveContext(ctx context.Context, name string) error {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.RemoveContext(ctx, fsys.wrapfs, name)
+}
+
+// StatContext implements writefs.StatContextFS
+func (fsys *fsT) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	fsys.lock.Lock()
+	defer fsys.lock.Unlock()
+	return writefs.StatContext(ctx, fsys.wrapfs, name)
+}
+
 // Stat implements fs.StatFS
 func (fsys *fsT) Stat(name string) (fs.FileInfo, error) {
 	fsys.lock.Lock()
@@ -69,10 +176,19 @@ func (fsys *fsT) ReadFile(name string) ([]byte, error) {
 }
 
 // Sub implements fs.SubFS
+// The returned file system is writable and
+// shares the lock of fsys.
 func (fsys *fsT) Sub(dir string) (fs.FS, error) {
 	fsys.lock.Lock()
 	defer fsys.lock.Unlock()
-	return fs.Sub(fsys.wrapfs, dir)
+	sub, err := writefs.Sub(fsys.wrapfs, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &fsT{
+		lock:   fsys.lock,
+		wrapfs: sub,
+	}, nil
 }
 
 // Open implements fs.FS
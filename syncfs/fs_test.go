@@ -14,6 +14,8 @@ func TestSyncFS(t *testing.T) {
 		t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys.(writefs.WriteFS)))
 	})
 
+	t.Run("Sub returns a writable fs", writefstest.TestSub(New(memfs.New()), "adir"))
+
 	t.Run("All methods returns factory error if any", func(t *testing.T) {
 
 	})
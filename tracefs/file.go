@@ -0,0 +1,40 @@
+package tracefs
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/parro-it/vs/internal/wrap"
+	"github.com/parro-it/vs/writefs"
+)
+
+// file traces the calls to
+// the methods of an open file.
+type file struct {
+	fsys *fsT
+	name string
+}
+
+var _ wrap.Hooks = file{}
+
+// newFile wraps f, so that the calls to
+// its methods are traced by fsys.
+func newFile(fsys *fsT, name string, f fs.File) writefs.FileWriter {
+	return wrap.NewFile(f, name, file{fsys: fsys, name: name})
+}
+
+// Transfer implements wrap.Hooks
+func (f file) Transfer(op wrap.Op, buf []byte, do func([]byte) (int, error)) (int, error) {
+	_, span := f.fsys.start(context.Background(), "File."+string(op), f.name)
+	n, err := do(buf)
+	span.End(int64(n), err)
+	return n, err
+}
+
+// Call implements wrap.Hooks
+func (f file) Call(op wrap.Op, do func() error) error {
+	_, span := f.fsys.start(context.Background(), "File."+string(op), f.name)
+	err := do()
+	span.End(0, err)
+	return err
+}
@@ -0,0 +1,278 @@
+// Package tracefs provides a file system wrapper
+// that traces the calls to the file system it wraps,
+// and to the files it opens, through a Tracer.
+package tracefs
+
+import (
+	"context"
+	"io/fs"
+	"time"
+
+	"github.com/parro-it/vs/internal/wrap"
+	"github.com/parro-it/vs/mountedfs"
+	"github.com/parro-it/vs/writefs"
+)
+
+type fsT struct {
+	tracer Tracer
+	mount  string
+	wrapfs fs.FS
+}
+
+// New returns a file system that traces the calls to
+// fsys with tracer. When tracer is nil, Nop is used.
+func New(fsys fs.FS, tracer Tracer) fs.FS {
+	return NewMount("", fsys, tracer)
+}
+
+// NewMount returns a file system that traces the calls
+// to fsys with tracer, using mount as the Mount of the
+// traced calls. When tracer is nil, Nop is used.
+func NewMount(mount string, fsys fs.FS, tracer Tracer) fs.FS {
+	if tracer == nil {
+		tracer = Nop
+	}
+	return &fsT{
+		tracer: tracer,
+		mount:  mount,
+		wrapfs: fsys,
+	}
+}
+
+// Mounted returns a copy of mfs whose file systems
+// trace their calls with tracer, using the names they
+// are mounted with as the Mount of the traced calls.
+// The paths of the calls are relative to the
+// mounted file systems.
+func Mounted(mfs mountedfs.MountedFS, tracer Tracer) mountedfs.MountedFS {
+	traced := mountedfs.MountedFS{}
+	for mount, fsys := range mfs {
+		traced[mount] = NewMount(mount, fsys, tracer)
+	}
+	return traced
+}
+
+var (
+	_ fs.StatFS     = &fsT{}
+	_ fs.ReadFileFS = &fsT{}
+	_ fs.SubFS      = &fsT{}
+	_ fs.ReadDirFS  = &fsT{}
+	_ fs.GlobFS     = &fsT{}
+
+	_ writefs.WriteFS     = &fsT{}
+	_ writefs.RemoveFS    = &fsT{}
+	_ writefs.MkDirFS     = &fsT{}
+	_ writefs.StatVFSFS   = &fsT{}
+	_ writefs.HashFS      = &fsT{}
+	_ writefs.RangeHashFS = &fsT{}
+	_ writefs.ChmodFS     = &fsT{}
+	_ writefs.ChtimesFS   = &fsT{}
+	_ writefs.WatchFS     = &fsT{}
+	_ writefs.ReadLinkFS  = &fsT{}
+	_ writefs.RenameFS    = &fsT{}
+
+	_ writefs.OpenFileContextFS = &fsT{}
+	_ writefs.MkDirContextFS    = &fsT{}
+	_ writefs.RemoveContextFS   = &fsT{}
+	_ writefs.StatContextFS     = &fsT{}
+)
+
+// start starts the span of op on the named file.
+func (fsys *fsT) start(ctx context.Context, op string, name string) (context.Context, Span) {
+	return fsys.tracer.Start(ctx, Call{
+		Mount: fsys.mount,
+		Op:    op,
+		Path:  name,
+		Start: time.Now(),
+	})
+}
+
+// MkDir implements writefs.MkDirFS
+func (fsys *fsT) MkDir(name string, perm fs.FileMode) error {
+	_, span := fsys.start(context.Background(), "MkDir", name)
+	err := writefs.MkDir(fsys.wrapfs, name, perm)
+	span.End(0, err)
+	return err
+}
+
+// Remove implements writefs.RemoveFS
+func (fsys *fsT) Remove(name string) error {
+	_, span := fsys.start(context.Background(), "Remove", name)
+	err := writefs.Remove(fsys.wrapfs, name)
+	span.End(0, err)
+	return err
+}
+
+// OpenFile implements writefs.WriteFS
+// Calls to the returned file are traced.
+func (fsys *fsT) OpenFile(name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	_, span := fsys.start(context.Background(), "OpenFile", name)
+	f, err := writefs.OpenFile(fsys.wrapfs, name, flag, perm)
+	span.End(0, err)
+	if err != nil || f == nil {
+		return f, err
+	}
+	return newFile(fsys, name, f), nil
+}
+
+// StatVFS implements writefs.StatVFSFS
+func (fsys *fsT) StatVFS(name string) (writefs.StatFSInfo, error) {
+	_, span := fsys.start(context.Background(), "StatVFS", name)
+	info, err := writefs.StatVFS(fsys.wrapfs, name)
+	span.End(0, err)
+	return info, err
+}
+
+// Hash implements writefs.HashFS
+func (fsys *fsT) Hash(name string, algo string) ([]byte, error) {
+	_, span := fsys.start(context.Background(), "Hash", name)
+	sum, err := writefs.Hash(fsys.wrapfs, name, algo)
+	span.End(0, err)
+	return sum, err
+}
+
+// HashRanges implements writefs.RangeHashFS
+func (fsys *fsT) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	_, span := fsys.start(context.Background(), "HashRanges", name)
+	sums, err := writefs.HashRanges(fsys.wrapfs, name, algo, size)
+	span.End(0, err)
+	return sums, err
+}
+
+// Chmod implements writefs.ChmodFS
+func (fsys *fsT) Chmod(name string, mode fs.FileMode) error {
+	_, span := fsys.start(context.Background(), "Chmod", name)
+	err := writefs.Chmod(fsys.wrapfs, name, mode)
+	span.End(0, err)
+	return err
+}
+
+// Chtimes implements writefs.ChtimesFS
+func (fsys *fsT) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	_, span := fsys.start(context.Background(), "Chtimes", name)
+	err := writefs.Chtimes(fsys.wrapfs, name, atime, mtime)
+	span.End(0, err)
+	return err
+}
+
+// Rename implements writefs.RenameFS
+// The span of the call reports oldname as its path.
+func (fsys *fsT) Rename(oldname string, newname string) error {
+	_, span := fsys.start(context.Background(), "Rename", oldname)
+	err := writefs.Rename(fsys.wrapfs, oldname, newname)
+	span.End(0, err)
+	return err
+}
+
+// ReadLink implements writefs.ReadLinkFS
+func (fsys *fsT) ReadLink(name string) (string, error) {
+	_, span := fsys.start(context.Background(), "ReadLink", name)
+	target, err := writefs.ReadLink(fsys.wrapfs, name)
+	span.End(0, err)
+	return target, err
+}
+
+// Watch implements writefs.WatchFS
+// Only the call that starts watching is traced,
+// and the scans of the file systems that are polled.
+func (fsys *fsT) Watch(ctx context.Context, name string, recursive bool) (<-chan writefs.Event, error) {
+	ctx, span := fsys.start(ctx, "Watch", name)
+	events, err := wrap.Watch(ctx, fsys, fsys.wrapfs, name, recursive)
+	span.End(0, err)
+	return events, err
+}
+
+// OpenFileContext implements writefs.OpenFileContextFS
+// Calls to the returned file are traced.
+func (fsys *fsT) OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (writefs.FileWriter, error) {
+	ctx, span := fsys.start(ctx, "OpenFile", name)
+	f, err := writefs.OpenFileContext(ctx, fsys.wrapfs, name, flag, perm)
+	span.End(0, err)
+	if err != nil || f == nil {
+		return f, err
+	}
+	return newFile(fsys, name, f), nil
+}
+
+// MkDirContext implements writefs.MkDirContextFS
+func (fsys *fsT) MkDirContext(ctx context.Context, name string, perm fs.FileMode) error {
+	ctx, span := fsys.start(ctx, "MkDir", name)
+	err := writefs.MkDirContext(ctx, fsys.wrapfs, name, perm)
+	span.End(0, err)
+	return err
+}
+
+// RemoveContext implements writefs.RemoveContextFS
+func (fsys *fsT) RemoveContext(ctx context.Context, name string) error {
+	ctx, span := fsys.start(ctx, "Remove", name)
+	err := writefs.RemoveContext(ctx, fsys.wrapfs, name)
+	span.End(0, err)
+	return err
+}
+
+// StatContext implements writefs.StatContextFS
+func (fsys *fsT) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	ctx, span := fsys.start(ctx, "Stat", name)
+	info, err := writefs.StatContext(ctx, fsys.wrapfs, name)
+	span.End(0, err)
+	return info, err
+}
+
+// Stat implements fs.StatFS
+func (fsys *fsT) Stat(name string) (fs.FileInfo, error) {
+	_, span := fsys.start(context.Background(), "Stat", name)
+	info, err := fs.Stat(fsys.wrapfs, name)
+	span.End(0, err)
+	return info, err
+}
+
+// ReadFile implements fs.ReadFileFS
+func (fsys *fsT) ReadFile(name string) ([]byte, error) {
+	_, span := fsys.start(context.Background(), "ReadFile", name)
+	buf, err := fs.ReadFile(fsys.wrapfs, name)
+	span.End(int64(len(buf)), err)
+	return buf, err
+}
+
+// Sub implements fs.SubFS
+// The returned file system is writable, and traces
+// its calls with the tracer and the mount of fsys.
+func (fsys *fsT) Sub(dir string) (fs.FS, error) {
+	sub, err := writefs.Sub(fsys.wrapfs, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &fsT{
+		tracer: fsys.tracer,
+		mount:  fsys.mount,
+		wrapfs: sub,
+	}, nil
+}
+
+// Open implements fs.FS
+// Calls to the returned file are traced.
+func (fsys *fsT) Open(name string) (fs.File, error) {
+	_, span := fsys.start(context.Background(), "Open", name)
+	f, err := fsys.wrapfs.Open(name)
+	span.End(0, err)
+	if err != nil {
+		return nil, err
+	}
+	return newFile(fsys, name, f), nil
+}
+
+// ReadDir implements fs.ReadDirFS
+func (fsys *fsT) ReadDir(name string) ([]fs.DirEntry, error) {
+	_, span := fsys.start(context.Background(), "ReadDir", name)
+	entries, err := fs.ReadDir(fsys.wrapfs, name)
+	span.End(0, err)
+	return entries, err
+}
+
+// Glob implements fs.GlobFS
+func (fsys *fsT) Glob(pattern string) ([]string, error) {
+	_, span := fsys.start(context.Background(), "Glob", pattern)
+	matches, err := fs.Glob(fsys.wrapfs, pattern)
+	span.End(0, err)
+	return matches, err
+}
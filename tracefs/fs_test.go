@@ -0,0 +1,170 @@
+package tracefs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/parro-it/vs/memfs"
+	"github.com/parro-it/vs/mountedfs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// record is a span ended by a recorder.
+type record struct {
+	Call
+	Bytes int64
+	Err   error
+}
+
+// recorder is a Tracer that records
+// the spans it starts once they end.
+type recorder struct {
+	lock    sync.Mutex
+	records []record
+}
+
+func (r *recorder) Start(ctx context.Context, call Call) (context.Context, Span) {
+	return ctx, spanFunc(func(bytes int64, err error) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.records = append(r.records, record{Call: call, Bytes: bytes, Err: err})
+	})
+}
+
+type spanFunc func(bytes int64, err error)
+
+func (f spanFunc) End(bytes int64, err error) {
+	f(bytes, err)
+}
+
+// ops returns the mount, op, path, bytes and
+// error of the records, ignoring start times.
+func (r *recorder) ops() []record {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var res []record
+	for _, rec := range r.records {
+		res = append(res, record{
+			Call:  Call{Mount: rec.Mount, Op: rec.Op, Path: rec.Path},
+			Bytes: rec.Bytes,
+			Err:   rec.Err,
+		})
+	}
+	return res
+}
+
+func TestTraceFS(t *testing.T) {
+	t.Run("pass writefstest.TestFS", func(t *testing.T) {
+		fsys := New(memfs.New(), nil)
+		t.Run("Pass writefstest.TestFS", writefstest.TestFS(fsys.(writefs.WriteFS)))
+	})
+
+	t.Run("traces calls and handles", func(t *testing.T) {
+		tracer := &recorder{}
+		fsys := New(memfs.New(), tracer)
+
+		assert.NoError(t, writefs.MkDir(fsys, "adir", fs.FileMode(0755)))
+		f, err := writefs.OpenFile(fsys, "adir/afile", os.O_CREATE|os.O_WRONLY, fs.FileMode(0644))
+		assert.NoError(t, err)
+		_, err = f.Write([]byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		buf, err := fs.ReadFile(fsys, "adir/afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao\n", string(buf))
+		_, err = fs.Stat(fsys, "missing")
+		assert.Error(t, err)
+		assert.NoError(t, writefs.Remove(fsys, "adir/afile"))
+
+		records := tracer.ops()
+		assert.Equal(t, []record{
+			{Call: Call{Op: "MkDir", Path: "adir"}},
+			{Call: Call{Op: "OpenFile", Path: "adir/afile"}},
+			{Call: Call{Op: "File.Write", Path: "adir/afile"}, Bytes: 5},
+			{Call: Call{Op: "File.Close", Path: "adir/afile"}},
+			{Call: Call{Op: "ReadFile", Path: "adir/afile"}, Bytes: 5},
+			{Call: Call{Op: "Stat", Path: "missing"}, Err: records[5].Err},
+			{Call: Call{Op: "Remove", Path: "adir/afile"}},
+		}, records)
+		assert.True(t, errors.Is(records[5].Err, fs.ErrNotExist))
+	})
+
+	t.Run("traces reads on open files", func(t *testing.T) {
+		tracer := &recorder{}
+		mem := memfs.New()
+		_, err := writefs.WriteFile(mem, "afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		fsys := New(mem, tracer)
+
+		f, err := fsys.Open("afile")
+		assert.NoError(t, err)
+		buf := make([]byte, 3)
+		_, err = f.Read(buf)
+		assert.NoError(t, err)
+		_, err = f.(io.Seeker).Seek(0, io.SeekStart)
+		assert.NoError(t, err)
+		_, err = f.(io.ReaderAt).ReadAt(buf[:2], 3)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		entries, err := fs.ReadDir(fsys, ".")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		assert.Equal(t, []record{
+			{Call: Call{Op: "Open", Path: "afile"}},
+			{Call: Call{Op: "File.Read", Path: "afile"}, Bytes: 3},
+			{Call: Call{Op: "File.Seek", Path: "afile"}},
+			{Call: Call{Op: "File.ReadAt", Path: "afile"}, Bytes: 2},
+			{Call: Call{Op: "File.Close", Path: "afile"}},
+			{Call: Call{Op: "ReadDir", Path: "."}},
+		}, tracer.ops())
+	})
+
+	t.Run("composes with mountedfs", func(t *testing.T) {
+		tracer := &recorder{}
+		fsys := Mounted(mountedfs.MountedFS{
+			"mem1": memfs.New(),
+			"mem2": memfs.New(),
+		}, tracer)
+
+		_, err := writefs.WriteFile(fsys, "mem1/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.MkDir(fsys, "mem2/adir", fs.FileMode(0755)))
+
+		assert.Equal(t, []record{
+			{Call: Call{Mount: "mem1", Op: "OpenFile", Path: "afile"}},
+			{Call: Call{Mount: "mem1", Op: "File.Write", Path: "afile"}, Bytes: 5},
+			{Call: Call{Mount: "mem1", Op: "File.Close", Path: "afile"}},
+			{Call: Call{Mount: "mem2", Op: "OpenFile", Path: "adir"}},
+		}, tracer.ops())
+	})
+
+	t.Run("logs structured lines", func(t *testing.T) {
+		var out bytes.Buffer
+		fsys := NewMount("remote", memfs.New(), NewLogger(&out))
+
+		_, err := writefs.WriteFile(fsys, "a file", []byte("ciao\n"))
+		assert.NoError(t, err)
+		_, err = fs.Stat(fsys, "missing")
+		assert.Error(t, err)
+
+		lines := regexp.MustCompile(`(?m)^time=\S+ op=(\S+) mount=remote path=("[^"]*"|\S+) duration=\S+ bytes=(\d+)(?: err=(.*))?$`).
+			FindAllStringSubmatch(out.String(), -1)
+		assert.Len(t, lines, 4)
+		assert.Equal(t, []string{"OpenFile", `"a file"`, "0", ""}, lines[0][1:])
+		assert.Equal(t, []string{"File.Write", `"a file"`, "5", ""}, lines[1][1:])
+		assert.Equal(t, []string{"File.Close", `"a file"`, "0", ""}, lines[2][1:])
+		assert.Equal(t, []string{"Stat", "missing", "0"}, lines[3][1:4])
+		assert.Contains(t, lines[3][4], "missing: file does not exist")
+	})
+}
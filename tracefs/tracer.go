@@ -0,0 +1,122 @@
+package tracefs
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Call describes a call traced by a file system.
+type Call struct {
+	// Mount is the name of the traced file system,
+	// or an empty string if it has none.
+	Mount string
+	// Op is the name of the called method. Methods of
+	// open files are prefixed with "File.", as in "File.Read".
+	Op string
+	// Path is the name of the file passed to the method,
+	// or of the open file. It's the pattern for Glob.
+	Path string
+	// Start is the time the call started.
+	Start time.Time
+}
+
+// Tracer starts a span for each call
+// traced by a file system.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts the span of call, and returns it
+	// along with a context derived from ctx that carries
+	// it. The returned context is passed to the wrapped
+	// file system by the methods that accept one.
+	Start(ctx context.Context, call Call) (context.Context, Span)
+}
+
+// Span is the trace of a single call.
+type Span interface {
+	// End ends the span, recording the bytes
+	// transferred by the call and the error it returned.
+	End(bytes int64, err error)
+}
+
+// Nop is a Tracer that discards all spans.
+var Nop Tracer = nopTracer{}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, call Call) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(bytes int64, err error) {}
+
+// NewLogger returns a Tracer that writes a line to w at
+// the end of each span, with key=value pairs as in:
+//
+//	time=2021-06-01T10:00:00.000Z op=File.Read mount=remote path=adir/afile duration=1.2ms bytes=512
+//
+// The mount key is omitted for file systems without a name,
+// and an err key is added for calls that return an error.
+// Values are quoted when they contain spaces, quotes or
+// the equal sign.
+func NewLogger(w io.Writer) Tracer {
+	return &logger{w: w}
+}
+
+type logger struct {
+	// lock serializes the writes to w
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *logger) Start(ctx context.Context, call Call) (context.Context, Span) {
+	return ctx, &logSpan{logger: l, call: call}
+}
+
+type logSpan struct {
+	logger *logger
+	call   Call
+}
+
+func (s *logSpan) End(bytes int64, err error) {
+	var line strings.Builder
+	field := func(key string, value string) {
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(key)
+		line.WriteByte('=')
+		line.WriteString(logValue(value))
+	}
+
+	field("time", s.call.Start.UTC().Format(time.RFC3339Nano))
+	field("op", s.call.Op)
+	if s.call.Mount != "" {
+		field("mount", s.call.Mount)
+	}
+	field("path", s.call.Path)
+	field("duration", time.Since(s.call.Start).String())
+	field("bytes", strconv.FormatInt(bytes, 10))
+	if err != nil {
+		field("err", err.Error())
+	}
+	line.WriteByte('\n')
+
+	s.logger.lock.Lock()
+	defer s.logger.lock.Unlock()
+	io.WriteString(s.logger.w, line.String())
+}
+
+// logValue returns value, quoted if needed
+// to be parsed back from a log line.
+func logValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,42 @@
+package writefs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChFS(t *testing.T) {
+	roFS := fstest.MapFS{}
+	chfs := &testChFS{testWriteFS{roFS, nil}, ""}
+
+	t.Run("Chmod calls fsys.Chmod for ChmodFS instances", func(t *testing.T) {
+		chfs.changed = ""
+		err := Chmod(chfs, "adir/afile", fs.FileMode(0600))
+		assert.NoError(t, err)
+		assert.Equal(t, "adir/afile", chfs.changed)
+	})
+
+	t.Run("Chmod return error for other fs.FS", func(t *testing.T) {
+		err := Chmod(roFS, "adir/afile", fs.FileMode(0600))
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+		assert.Equal(t, "invalid argument: fsys does not support change of permissions", err.Error())
+	})
+
+	t.Run("Chtimes calls fsys.Chtimes for ChtimesFS instances", func(t *testing.T) {
+		chfs.changed = ""
+		err := Chtimes(chfs, "adir/afile", time.Now(), time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, "adir/afile", chfs.changed)
+	})
+
+	t.Run("Chtimes return error for other fs.FS", func(t *testing.T) {
+		err := Chtimes(roFS, "adir/afile", time.Now(), time.Now())
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+		assert.Equal(t, "invalid argument: fsys does not support change of times", err.Error())
+	})
+}
@@ -0,0 +1,24 @@
+package writefs
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// ChmodFS is the interface implemented by a file system
+// that can change the permissions of its files.
+type ChmodFS interface {
+	fs.FS
+	Chmod(name string, mode fs.FileMode) error
+}
+
+// Chmod changes the permissions of the named file to mode.
+// If fsys implements ChmodFS, Chmod calls fsys.Chmod.
+// Otherwise Chmod returns an error.
+func Chmod(fsys fs.FS, name string, mode fs.FileMode) error {
+	if fsys, ok := fsys.(ChmodFS); ok {
+		return fsys.Chmod(name, mode)
+	}
+
+	return fmt.Errorf("%w: fsys does not support change of permissions", fs.ErrInvalid)
+}
@@ -0,0 +1,27 @@
+package writefs
+
+import (
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// ChtimesFS is the interface implemented by a file system
+// that can change the access and modification times
+// of its files.
+type ChtimesFS interface {
+	fs.FS
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+}
+
+// Chtimes changes the access and modification
+// times of the named file.
+// If fsys implements ChtimesFS, Chtimes calls fsys.Chtimes.
+// Otherwise Chtimes returns an error.
+func Chtimes(fsys fs.FS, name string, atime time.Time, mtime time.Time) error {
+	if fsys, ok := fsys.(ChtimesFS); ok {
+		return fsys.Chtimes(name, atime, mtime)
+	}
+
+	return fmt.Errorf("%w: fsys does not support change of times", fs.ErrInvalid)
+}
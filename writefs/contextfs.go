@@ -0,0 +1,135 @@
+package writefs
+
+import (
+	"context"
+	"io/fs"
+)
+
+// OpenFileContextFS is the interface implemented by a file
+// system whose OpenFile can be cancelled by a context.
+// Cancellation stops waiting for the operation, that
+// may still complete after the error is returned.
+type OpenFileContextFS interface {
+	fs.FS
+	OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (FileWriter, error)
+}
+
+// MkDirContextFS is the interface implemented by a file
+// system whose MkDir can be cancelled by a context.
+// Cancellation stops waiting for the operation, that
+// may still complete after the error is returned.
+type MkDirContextFS interface {
+	fs.FS
+	MkDirContext(ctx context.Context, name string, perm fs.FileMode) error
+}
+
+// RemoveContextFS is the interface implemented by a file
+// system whose Remove can be cancelled by a context.
+// Cancellation stops waiting for the operation, that
+// may still complete after the error is returned.
+type RemoveContextFS interface {
+	fs.FS
+	RemoveContext(ctx context.Context, name string) error
+}
+
+// StatContextFS is the interface implemented by a file
+// system whose Stat can be cancelled by a context.
+// Cancellation stops waiting for the operation, that
+// may still complete after the error is returned.
+type StatContextFS interface {
+	fs.FS
+	StatContext(ctx context.Context, name string) (fs.FileInfo, error)
+}
+
+// contextErr returns a *fs.PathError wrapping
+// the error of ctx, or nil if ctx is not done.
+func contextErr(ctx context.Context, op string, name string) error {
+	if err := ctx.Err(); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// OpenFileContext is like OpenFile, but it fails with
+// an error wrapping ctx.Err() when ctx is done.
+// If fsys implements OpenFileContextFS, OpenFileContext
+// calls fsys.OpenFileContext. Otherwise OpenFileContext
+// checks ctx before and after calling OpenFile, closing
+// the opened file if ctx is done meanwhile.
+func OpenFileContext(ctx context.Context, fsys fs.FS, name string, flag int, perm fs.FileMode) (FileWriter, error) {
+	if fsys, ok := fsys.(OpenFileContextFS); ok {
+		return fsys.OpenFileContext(ctx, name, flag, perm)
+	}
+	if err := contextErr(ctx, "open", name); err != nil {
+		return nil, err
+	}
+	f, err := OpenFile(fsys, name, flag, perm)
+	if cerr := contextErr(ctx, "open", name); cerr != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, cerr
+	}
+	return f, err
+}
+
+// MkDirContext is like MkDir, but it fails with
+// an error wrapping ctx.Err() when ctx is done.
+// If fsys implements MkDirContextFS, MkDirContext
+// calls fsys.MkDirContext. Otherwise MkDirContext
+// checks ctx before and after calling MkDir: when the
+// error is returned after the call, the directory
+// could have been created.
+func MkDirContext(ctx context.Context, fsys fs.FS, name string, perm fs.FileMode) error {
+	if fsys, ok := fsys.(MkDirContextFS); ok {
+		return fsys.MkDirContext(ctx, name, perm)
+	}
+	if err := contextErr(ctx, "mkdir", name); err != nil {
+		return err
+	}
+	err := MkDir(fsys, name, perm)
+	if cerr := contextErr(ctx, "mkdir", name); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// RemoveContext is like Remove, but it fails with
+// an error wrapping ctx.Err() when ctx is done.
+// If fsys implements RemoveContextFS, RemoveContext
+// calls fsys.RemoveContext. Otherwise RemoveContext
+// checks ctx before and after calling Remove: when the
+// error is returned after the call, the file could
+// have been removed.
+func RemoveContext(ctx context.Context, fsys fs.FS, name string) error {
+	if fsys, ok := fsys.(RemoveContextFS); ok {
+		return fsys.RemoveContext(ctx, name)
+	}
+	if err := contextErr(ctx, "remove", name); err != nil {
+		return err
+	}
+	err := Remove(fsys, name)
+	if cerr := contextErr(ctx, "remove", name); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// StatContext is like fs.Stat, but it fails with
+// an error wrapping ctx.Err() when ctx is done.
+// If fsys implements StatContextFS, StatContext
+// calls fsys.StatContext. Otherwise StatContext
+// checks ctx before and after calling fs.Stat.
+func StatContext(ctx context.Context, fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys, ok := fsys.(StatContextFS); ok {
+		return fsys.StatContext(ctx, name)
+	}
+	if err := contextErr(ctx, "stat", name); err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(fsys, name)
+	if cerr := contextErr(ctx, "stat", name); cerr != nil {
+		return nil, cerr
+	}
+	return info, err
+}
@@ -0,0 +1,66 @@
+package writefs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("StatContext calls fsys.StatContext for StatContextFS instances", func(t *testing.T) {
+		statfs := &testStatContextFS{testWriteFS{fstest.MapFS{}, nil}, ""}
+		_, err := StatContext(cancelled, statfs, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "afile", statfs.statted)
+	})
+
+	t.Run("fallbacks call the plain operations", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"afile": &fstest.MapFile{Data: []byte("ciao\n")},
+		}
+		ctx := context.Background()
+		info, err := StatContext(ctx, fsys, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), info.Size())
+
+		f, err := OpenFileContext(ctx, fsys, "afile", os.O_RDONLY, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		_, err = StatContext(ctx, fsys, "unknown")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+		err = MkDirContext(ctx, fsys, "adir", fs.FileMode(0755))
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+
+	t.Run("fallbacks fail when the context is done", func(t *testing.T) {
+		removefs := &testRemoveFS{testWriteFS{fstest.MapFS{}, nil}, ""}
+		err := RemoveContext(cancelled, removefs, "afile")
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, "", removefs.removed)
+
+		mkdirfs := &testMkDirFS{testWriteFS{fstest.MapFS{}, nil}, ""}
+		err = MkDirContext(cancelled, mkdirfs, "adir", fs.FileMode(0755))
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, "", mkdirfs.created)
+
+		_, err = OpenFileContext(cancelled, testWriteFS{fstest.MapFS{}, nil}, "afile", os.O_RDONLY, 0)
+		assert.True(t, errors.Is(err, context.Canceled))
+
+		_, err = StatContext(cancelled, fstest.MapFS{}, "afile")
+		var pathErr *fs.PathError
+		if assert.True(t, errors.As(err, &pathErr)) {
+			assert.Equal(t, "stat", pathErr.Op)
+			assert.Equal(t, "afile", pathErr.Path)
+			assert.Equal(t, context.Canceled, pathErr.Err)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+//go:build !plan9
+// +build !plan9
+
+package writefs
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+var errnoSentinels = map[syscall.Errno]error{
+	syscall.ENOENT:    fs.ErrNotExist,
+	syscall.EEXIST:    fs.ErrExist,
+	syscall.EACCES:    fs.ErrPermission,
+	syscall.EPERM:     fs.ErrPermission,
+	syscall.EINVAL:    fs.ErrInvalid,
+	syscall.ENOTEMPTY: ErrNotEmpty,
+	syscall.EISDIR:    ErrIsDir,
+	syscall.ENOTDIR:   ErrNotDir,
+	syscall.EXDEV:     ErrCrossDevice,
+}
+
+// errnoSentinel returns the sentinel error
+// matching the errno value wrapped by err.
+func errnoSentinel(err error) (error, bool) {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return nil, false
+	}
+	sentinel, ok := errnoSentinels[errno]
+	return sentinel, ok
+}
@@ -0,0 +1,7 @@
+package writefs
+
+// errnoSentinel returns false: plan9
+// has no errno values to translate.
+func errnoSentinel(err error) (error, bool) {
+	return nil, false
+}
@@ -0,0 +1,125 @@
+package writefs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Errors returned by file systems, in addition to the
+// fs.Err* ones. They are wrapped in *fs.PathError, like
+// the standard ones.
+var (
+	// ErrNotEmpty is returned when removing
+	// a directory that is not empty.
+	ErrNotEmpty = errors.New("directory not empty")
+	// ErrIsDir is returned when a file
+	// operation is applied to a directory.
+	ErrIsDir = errors.New("is a directory")
+	// ErrNotDir is returned when a directory operation
+	// is applied to a file, or when a file is used as
+	// a parent directory.
+	ErrNotDir = errors.New("not a directory")
+	// ErrCrossDevice is returned when an operation
+	// would move a file between different devices.
+	ErrCrossDevice = errors.New("cross-device link")
+)
+
+// errorCodes lists the codes returned by ErrorCode,
+// along with the sentinels they classify.
+var errorCodes = []struct {
+	code     string
+	sentinel error
+}{
+	{"not_exist", fs.ErrNotExist},
+	{"exist", fs.ErrExist},
+	{"permission", fs.ErrPermission},
+	{"not_empty", ErrNotEmpty},
+	{"is_dir", ErrIsDir},
+	{"not_dir", ErrNotDir},
+	{"cross_device", ErrCrossDevice},
+	{"invalid", fs.ErrInvalid},
+	{"closed", fs.ErrClosed},
+}
+
+// ErrorCode returns a code classifying err by the
+// fs.Err* or writefs.Err* sentinel error it matches,
+// e.g. "not_exist" for fs.ErrNotExist, or an empty
+// string if err matches none of them.
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.sentinel) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// CodeError returns the sentinel error classified
+// by code, as returned by ErrorCode, or nil if
+// code is unknown.
+func CodeError(code string) error {
+	for _, c := range errorCodes {
+		if c.code == code {
+			return c.sentinel
+		}
+	}
+	return nil
+}
+
+// OpenFileOp returns the name of the operation
+// performed by OpenFile with flag and perm, to be
+// used as the Op of the errors it returns:
+// "mkdir" for directory creations, "remove" for
+// removals and "open" for all other calls.
+func OpenFileOp(flag int, perm fs.FileMode) string {
+	if flag&os.O_CREATE == os.O_CREATE && perm.IsDir() {
+		return "mkdir"
+	}
+	if flag == os.O_TRUNC {
+		return "remove"
+	}
+	return "open"
+}
+
+// NewPathError returns a *fs.PathError describing the
+// failure of op on the named file, or nil if err is nil.
+// Path errors and link errors wrapped by err are replaced,
+// and errno values are translated to the fs.Err* and
+// writefs.Err* sentinel errors, so that the returned
+// error is independent of the platform and of the
+// underlying path of the file.
+func NewPathError(op string, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	switch {
+	case errors.As(err, &pathErr):
+		err = pathErr.Err
+	case errors.As(err, &linkErr):
+		err = linkErr.Err
+	case errors.As(err, &syscallErr):
+		err = syscallErr.Err
+	}
+
+	if sentinel, ok := errnoSentinel(err); ok {
+		err = sentinel
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// NewLinkError returns an *os.LinkError describing the
+// failure of op on the oldname and newname files, or nil
+// if err is nil. The error wrapped by err is replaced and
+// translated as NewPathError does.
+func NewLinkError(op string, oldname string, newname string, err error) error {
+	if err == nil {
+		return nil
+	}
+	pathErr := NewPathError(op, oldname, err).(*fs.PathError)
+	return &os.LinkError{Op: op, Old: oldname, New: newname, Err: pathErr.Err}
+}
@@ -0,0 +1,82 @@
+package writefs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("sentinels don't wrap fs.ErrInvalid", func(t *testing.T) {
+		for _, err := range []error{ErrNotEmpty, ErrIsDir, ErrNotDir, ErrCrossDevice} {
+			assert.False(t, errors.Is(err, fs.ErrInvalid))
+		}
+		assert.Equal(t, "directory not empty", ErrNotEmpty.Error())
+	})
+
+	t.Run("ErrorCode classifies errors by sentinel", func(t *testing.T) {
+		err := &fs.PathError{Op: "remove", Path: "adir", Err: ErrNotEmpty}
+		assert.Equal(t, "not_empty", ErrorCode(err))
+		assert.Equal(t, "invalid", ErrorCode(fs.ErrInvalid))
+		assert.Equal(t, "", ErrorCode(errors.New("boom")))
+		assert.Equal(t, "", ErrorCode(nil))
+
+		assert.Equal(t, ErrNotEmpty, CodeError("not_empty"))
+		assert.Nil(t, CodeError("unknown"))
+	})
+
+	t.Run("OpenFileOp", func(t *testing.T) {
+		assert.Equal(t, "mkdir", OpenFileOp(os.O_CREATE, fs.ModeDir|0755))
+		assert.Equal(t, "remove", OpenFileOp(os.O_TRUNC, 0))
+		assert.Equal(t, "open", OpenFileOp(os.O_RDONLY, 0))
+		assert.Equal(t, "open", OpenFileOp(os.O_WRONLY|os.O_TRUNC, 0644))
+		assert.Equal(t, "open", OpenFileOp(os.O_WRONLY|os.O_CREATE, 0644))
+	})
+
+	t.Run("NewPathError returns nil for nil errors", func(t *testing.T) {
+		assert.NoError(t, NewPathError("open", "afile", nil))
+	})
+
+	t.Run("NewPathError replaces path errors", func(t *testing.T) {
+		err := NewPathError("open", "afile", &fs.PathError{Op: "openat", Path: "/root/afile", Err: syscall.ENOENT})
+		var pathErr *fs.PathError
+		assert.True(t, errors.As(err, &pathErr))
+		assert.Equal(t, "open", pathErr.Op)
+		assert.Equal(t, "afile", pathErr.Path)
+		assert.Equal(t, fs.ErrNotExist, pathErr.Err)
+		assert.Equal(t, "open afile: file does not exist", err.Error())
+	})
+
+	t.Run("NewPathError translates errno values", func(t *testing.T) {
+		err := NewPathError("remove", "adir", &os.SyscallError{Syscall: "rmdir", Err: syscall.ENOTEMPTY})
+		assert.True(t, errors.Is(err, ErrNotEmpty))
+
+		err = NewPathError("rename", "afile", &os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: syscall.EXDEV})
+		assert.True(t, errors.Is(err, ErrCrossDevice))
+
+		err = NewPathError("open", "adir", syscall.EISDIR)
+		assert.True(t, errors.Is(err, ErrIsDir))
+	})
+
+	t.Run("NewPathError keeps other errors", func(t *testing.T) {
+		cause := errors.New("boom")
+		err := NewPathError("open", "afile", cause)
+		assert.True(t, errors.Is(err, cause))
+		assert.Equal(t, "open afile: boom", err.Error())
+	})
+
+	t.Run("NewLinkError replaces link errors", func(t *testing.T) {
+		assert.NoError(t, NewLinkError("rename", "afile", "bfile", nil))
+
+		err := NewLinkError("rename", "afile", "bdir/bfile", &os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: syscall.EXDEV})
+		var linkErr *os.LinkError
+		assert.True(t, errors.As(err, &linkErr))
+		assert.Equal(t, "afile", linkErr.Old)
+		assert.Equal(t, "bdir/bfile", linkErr.New)
+		assert.True(t, errors.Is(err, ErrCrossDevice))
+	})
+}
@@ -1,8 +1,10 @@
 package writefs
 
 import (
+	"context"
 	"io/fs"
 	"testing/fstest"
+	"time"
 )
 
 type testWriteFS struct {
@@ -57,7 +59,96 @@ func (w testFileWriter) Stat() (fs.FileInfo, error) {
 // OpenFile ...
 func (fsys testWriteFS) OpenFile(name string, flag int, perm fs.FileMode) (FileWriter, error) {
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: OpenFileOp(flag, perm), Path: name, Err: fs.ErrInvalid}
 	}
 	return testFileWriter{}, fsys.expectedErr
 }
+
+type testStatVFSFS struct {
+	testWriteFS
+	info StatFSInfo
+}
+
+var _ StatVFSFS = &testStatVFSFS{}
+
+func (fsys *testStatVFSFS) StatVFS(name string) (StatFSInfo, error) {
+	return fsys.info, nil
+}
+
+type testHashFS struct {
+	testWriteFS
+	hashed string
+}
+
+var _ HashFS = &testHashFS{}
+
+func (fsys *testHashFS) Hash(name string, algo string) ([]byte, error) {
+	fsys.hashed = name
+	return []byte(algo), nil
+}
+
+type testChFS struct {
+	testWriteFS
+	changed string
+}
+
+var (
+	_ ChmodFS   = &testChFS{}
+	_ ChtimesFS = &testChFS{}
+)
+
+func (fsys *testChFS) Chmod(name string, mode fs.FileMode) error {
+	fsys.changed = name
+	return nil
+}
+
+func (fsys *testChFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	fsys.changed = name
+	return nil
+}
+
+type testRenameFS struct {
+	testWriteFS
+	renamed string
+}
+
+var _ RenameFS = &testRenameFS{}
+
+func (fsys *testRenameFS) Rename(oldname string, newname string) error {
+	fsys.renamed = oldname + " " + newname
+	return nil
+}
+
+var _ RangeHashFS = &testHashFS{}
+
+func (fsys *testHashFS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	fsys.hashed = name
+	return [][]byte{[]byte(algo)}, nil
+}
+
+type testWatchFS struct {
+	testWriteFS
+	watched string
+}
+
+var _ WatchFS = &testWatchFS{}
+
+func (fsys *testWatchFS) Watch(ctx context.Context, name string, recursive bool) (<-chan Event, error) {
+	fsys.watched = name
+	events := make(chan Event, 1)
+	events <- Event{Op: OpCreate, Path: name}
+	close(events)
+	return events, nil
+}
+
+type testStatContextFS struct {
+	testWriteFS
+	statted string
+}
+
+var _ StatContextFS = &testStatContextFS{}
+
+func (fsys *testStatContextFS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	fsys.statted = name
+	return nil, nil
+}
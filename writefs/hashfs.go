@@ -0,0 +1,209 @@
+package writefs
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// Hash algorithms supported by Hash and HashTree.
+const (
+	MD5    = "md5"
+	SHA1   = "sha1"
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+// NewHash returns a new hash.Hash computing
+// the checksum with the named algorithm.
+func NewHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported hash algorithm `%s`", fs.ErrInvalid, algo)
+}
+
+// HashFS is the interface implemented by a file system
+// that can compute the checksum of its files without
+// reading them through Open, e.g. remotely.
+type HashFS interface {
+	fs.FS
+	Hash(name string, algo string) ([]byte, error)
+}
+
+// Hash returns the checksum of the content of the named
+// file, computed with the algo hash algorithm.
+// If fsys implements HashFS, Hash calls fsys.Hash.
+// Otherwise Hash calls ReadHash.
+func Hash(fsys fs.FS, name string, algo string) ([]byte, error) {
+	if fsys, ok := fsys.(HashFS); ok {
+		return fsys.Hash(name, algo)
+	}
+	return ReadHash(fsys, name, algo)
+}
+
+// ReadHash returns the checksum of the content of
+// the named file, streaming it through the algo hash
+// algorithm. File systems can use ReadHash
+// to implement HashFS when they cannot do better.
+func ReadHash(fsys fs.FS, name string, algo string) ([]byte, error) {
+	h, err := NewHash(algo)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: ErrIsDir}
+	}
+
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// RangeHashFS is the interface implemented by a file system
+// that can compute the checksums of consecutive ranges
+// of its files without reading them through Open.
+type RangeHashFS interface {
+	fs.FS
+	HashRanges(name string, algo string, size int64) ([][]byte, error)
+}
+
+// HashRanges returns the checksums of the consecutive
+// ranges of size bytes the content of the named file is
+// divided in, computed with the algo hash algorithm.
+// The last range is shorter than size when the file size
+// is not a multiple of it.
+// If fsys implements RangeHashFS, HashRanges calls fsys.HashRanges.
+// Otherwise HashRanges calls ReadHashRanges.
+func HashRanges(fsys fs.FS, name string, algo string, size int64) ([][]byte, error) {
+	if fsys, ok := fsys.(RangeHashFS); ok {
+		return fsys.HashRanges(name, algo, size)
+	}
+	return ReadHashRanges(fsys, name, algo, size)
+}
+
+// ReadHashRanges returns the checksums of the consecutive
+// ranges of size bytes of the named file, streaming its
+// content through the algo hash algorithm. File systems can
+// use ReadHashRanges to implement RangeHashFS when they
+// cannot do better.
+func ReadHashRanges(fsys fs.FS, name string, algo string, size int64) ([][]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: invalid range size %d", fs.ErrInvalid, size)
+	}
+	h, err := NewHash(algo)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: ErrIsDir}
+	}
+
+	var sums [][]byte
+	for {
+		h.Reset()
+		n, err := io.CopyN(h, f, size)
+		if n > 0 {
+			sums = append(sums, h.Sum(nil))
+		}
+		if err == io.EOF {
+			return sums, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// HashTree returns a Merkle-style digest of the
+// directory tree rooted at dir, computed with the algo
+// hash algorithm. The digest of a file is its checksum,
+// as returned by Hash; the digest of a directory is the
+// checksum of the kind, name and digest of all its
+// entries, in lexical order.
+// Two trees have the same digest if they contain the same
+// files with the same content, so their digests can be
+// compared without reading the files when their file
+// systems implement HashFS.
+// Modes and modification times are not part of the digest.
+func HashTree(fsys fs.FS, dir string, algo string) ([]byte, error) {
+	if _, err := NewHash(algo); err != nil {
+		return nil, err
+	}
+
+	info, err := fs.Stat(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return Hash(fsys, dir, algo)
+	}
+	return hashDir(fsys, dir, algo)
+}
+
+func hashDir(fsys fs.FS, dir string, algo string) ([]byte, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	h, _ := NewHash(algo)
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+
+		var kind byte
+		var digest []byte
+		if entry.IsDir() {
+			kind = 'd'
+			digest, err = hashDir(fsys, name, algo)
+		} else {
+			kind = 'f'
+			digest, err = Hash(fsys, name, algo)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		h.Write([]byte{kind})
+		h.Write([]byte(entry.Name()))
+		h.Write([]byte{0})
+		h.Write(digest)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,119 @@
+package writefs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashFS(t *testing.T) {
+	roFS := fstest.MapFS{
+		"adir/afile":        &fstest.MapFile{Data: []byte("ciao\n")},
+		"adir/bdir/another": &fstest.MapFile{Data: []byte("miao\n")},
+	}
+
+	t.Run("Hash calls fsys.Hash for HashFS instances", func(t *testing.T) {
+		hashfs := &testHashFS{testWriteFS{roFS, nil}, ""}
+		sum, err := Hash(hashfs, "adir/afile", SHA256)
+		assert.NoError(t, err)
+		assert.Equal(t, "adir/afile", hashfs.hashed)
+		assert.Equal(t, []byte(SHA256), sum)
+	})
+
+	t.Run("Hash streams the content of files for other fs.FS", func(t *testing.T) {
+		sum, err := Hash(roFS, "adir/afile", SHA256)
+		assert.NoError(t, err)
+		expected := sha256.Sum256([]byte("ciao\n"))
+		assert.Equal(t, expected[:], sum)
+	})
+
+	t.Run("Hash return error for unknown algorithms", func(t *testing.T) {
+		_, err := Hash(roFS, "adir/afile", "crc")
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+		assert.Equal(t, "invalid argument: unsupported hash algorithm `crc`", err.Error())
+	})
+
+	t.Run("Hash return error for directories", func(t *testing.T) {
+		_, err := Hash(roFS, "adir", SHA256)
+		assert.True(t, errors.Is(err, ErrIsDir))
+	})
+
+	t.Run("Hash return error for missing files", func(t *testing.T) {
+		_, err := Hash(roFS, "adir/unknown", SHA256)
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("HashRanges streams the content of files for other fs.FS", func(t *testing.T) {
+		sums, err := HashRanges(roFS, "adir/afile", SHA256, 2)
+		assert.NoError(t, err)
+		expected := [][32]byte{
+			sha256.Sum256([]byte("ci")),
+			sha256.Sum256([]byte("ao")),
+			sha256.Sum256([]byte("\n")),
+		}
+		if assert.Len(t, sums, 3) {
+			for i, sum := range sums {
+				assert.Equal(t, expected[i][:], sum)
+			}
+		}
+
+		_, err = HashRanges(roFS, "adir/afile", SHA256, 0)
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+
+	t.Run("HashRanges calls fsys.HashRanges for RangeHashFS instances", func(t *testing.T) {
+		hashfs := &testHashFS{testWriteFS{roFS, nil}, ""}
+		sums, err := HashRanges(hashfs, "adir/afile", SHA256, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, "adir/afile", hashfs.hashed)
+		assert.Equal(t, [][]byte{[]byte(SHA256)}, sums)
+	})
+
+	t.Run("HashTree", func(t *testing.T) {
+		sum, err := HashTree(roFS, "adir", SHA256)
+		assert.NoError(t, err)
+		assert.Len(t, hex.EncodeToString(sum), 64)
+
+		t.Run("is equal for trees with the same content", func(t *testing.T) {
+			other := fstest.MapFS{
+				"root/afile":        &fstest.MapFile{Data: []byte("ciao\n"), Mode: 0600},
+				"root/bdir/another": &fstest.MapFile{Data: []byte("miao\n")},
+			}
+			otherSum, err := HashTree(other, "root", SHA256)
+			assert.NoError(t, err)
+			assert.Equal(t, sum, otherSum)
+		})
+
+		t.Run("changes when a file content changes", func(t *testing.T) {
+			other := fstest.MapFS{
+				"adir/afile":        &fstest.MapFile{Data: []byte("ciao\n")},
+				"adir/bdir/another": &fstest.MapFile{Data: []byte("bau\n")},
+			}
+			otherSum, err := HashTree(other, "adir", SHA256)
+			assert.NoError(t, err)
+			assert.NotEqual(t, sum, otherSum)
+		})
+
+		t.Run("changes when a file is renamed", func(t *testing.T) {
+			other := fstest.MapFS{
+				"adir/afile":        &fstest.MapFile{Data: []byte("ciao\n")},
+				"adir/bdir/renamed": &fstest.MapFile{Data: []byte("miao\n")},
+			}
+			otherSum, err := HashTree(other, "adir", SHA256)
+			assert.NoError(t, err)
+			assert.NotEqual(t, sum, otherSum)
+		})
+
+		t.Run("of a file is its hash", func(t *testing.T) {
+			fileSum, err := HashTree(roFS, "adir/afile", SHA256)
+			assert.NoError(t, err)
+			expected := sha256.Sum256([]byte("ciao\n"))
+			assert.Equal(t, expected[:], fileSum)
+		})
+	})
+}
@@ -0,0 +1,38 @@
+package writefs
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// ReadLinkFS is the interface implemented by a file
+// system that can read the target of symbolic links.
+type ReadLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// ReadLink returns the target of the named symbolic link.
+// If fsys implements ReadLinkFS, ReadLink calls fsys.ReadLink.
+// Otherwise, if fs.Stat reports the named file as a symbolic
+// link, as it does for file systems that don't follow links,
+// ReadLink returns its content. Otherwise ReadLink returns
+// an error.
+func ReadLink(fsys fs.FS, name string) (string, error) {
+	if fsys, ok := fsys.(ReadLinkFS); ok {
+		return fsys.ReadLink(name)
+	}
+
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return "", fmt.Errorf("%w: fsys does not support symbolic links", fs.ErrInvalid)
+	}
+	target, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	return string(target), nil
+}
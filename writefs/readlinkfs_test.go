@@ -0,0 +1,38 @@
+package writefs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadLink(t *testing.T) {
+	fsys := fstest.MapFS{
+		"adir/afile": &fstest.MapFile{Data: []byte("ciao\n")},
+		"adir/alink": &fstest.MapFile{Data: []byte("afile"), Mode: fs.ModeSymlink | 0777},
+	}
+
+	t.Run("returns the target of symbolic links", func(t *testing.T) {
+		target, err := ReadLink(fsys, "adir/alink")
+		assert.NoError(t, err)
+		assert.Equal(t, "afile", target)
+	})
+
+	t.Run("fails for other files", func(t *testing.T) {
+		_, err := ReadLink(fsys, "adir/afile")
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+		_, err = ReadLink(fsys, "adir/missing")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("works through Sub", func(t *testing.T) {
+		sub, err := NewSub(fsys, "adir")
+		assert.NoError(t, err)
+		target, err := ReadLink(sub, "alink")
+		assert.NoError(t, err)
+		assert.Equal(t, "afile", target)
+	})
+}
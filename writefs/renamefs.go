@@ -0,0 +1,25 @@
+package writefs
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// RenameFS is the interface implemented by a file
+// system that can rename its files.
+type RenameFS interface {
+	fs.FS
+	Rename(oldname string, newname string) error
+}
+
+// Rename renames oldname to newname, replacing
+// newname if it's an existing file.
+// If fsys implements RenameFS, Rename calls fsys.Rename.
+// Otherwise Rename returns an error.
+func Rename(fsys fs.FS, oldname string, newname string) error {
+	if fsys, ok := fsys.(RenameFS); ok {
+		return fsys.Rename(oldname, newname)
+	}
+
+	return fmt.Errorf("%w: fsys does not support renaming files", fs.ErrInvalid)
+}
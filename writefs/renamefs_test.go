@@ -0,0 +1,34 @@
+package writefs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameFS(t *testing.T) {
+	roFS := fstest.MapFS{}
+	renamefs := &testRenameFS{testWriteFS{roFS, nil}, ""}
+
+	t.Run("Rename calls fsys.Rename for RenameFS instances", func(t *testing.T) {
+		err := Rename(renamefs, "adir/afile", "adir/bfile")
+		assert.NoError(t, err)
+		assert.Equal(t, "adir/afile adir/bfile", renamefs.renamed)
+	})
+
+	t.Run("Rename return error for other fs.FS", func(t *testing.T) {
+		err := Rename(roFS, "adir/afile", "adir/bfile")
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+		assert.Equal(t, "invalid argument: fsys does not support renaming files", err.Error())
+	})
+
+	t.Run("subFS prefixes both names", func(t *testing.T) {
+		sub, err := NewSub(renamefs, "adir")
+		assert.NoError(t, err)
+		assert.NoError(t, Rename(sub, "afile", "bfile"))
+		assert.Equal(t, "adir/afile adir/bfile", renamefs.renamed)
+	})
+}
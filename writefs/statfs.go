@@ -0,0 +1,47 @@
+package writefs
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// StatFSInfo describes the disk usage of
+// the file system that contains a file.
+type StatFSInfo struct {
+	// TotalBytes is the size of the file system.
+	TotalBytes uint64
+	// FreeBytes is the free space on the file system.
+	FreeBytes uint64
+	// AvailableBytes is the free space available
+	// to unprivileged users, it could be
+	// less than FreeBytes.
+	AvailableBytes uint64
+	// TotalInodes is the maximum number
+	// of files on the file system.
+	TotalInodes uint64
+	// FreeInodes is the number of files
+	// that could still be created.
+	FreeInodes uint64
+	// AvailableInodes is the number of files that
+	// could still be created by unprivileged users.
+	AvailableInodes uint64
+}
+
+// StatVFSFS is the interface implemented by a file system
+// that can report its disk usage.
+type StatVFSFS interface {
+	fs.FS
+	StatVFS(name string) (StatFSInfo, error)
+}
+
+// StatVFS returns the disk usage of the file system
+// that contains the named file.
+// If fsys implements StatVFSFS, StatVFS calls fsys.StatVFS.
+// Otherwise StatVFS returns an error.
+func StatVFS(fsys fs.FS, name string) (StatFSInfo, error) {
+	if fsys, ok := fsys.(StatVFSFS); ok {
+		return fsys.StatVFS(name)
+	}
+
+	return StatFSInfo{}, fmt.Errorf("%w: fsys does not support file system statistics", fs.ErrInvalid)
+}
@@ -0,0 +1,29 @@
+package writefs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatVFS(t *testing.T) {
+	roFS := fstest.MapFS{}
+
+	t.Run("StatVFS calls fsys.StatVFS for StatVFSFS instances", func(t *testing.T) {
+		info := StatFSInfo{TotalBytes: 100, FreeBytes: 42, AvailableBytes: 40}
+		statfs := &testStatVFSFS{testWriteFS{roFS, nil}, info}
+		actual, err := StatVFS(statfs, ".")
+		assert.NoError(t, err)
+		assert.Equal(t, info, actual)
+	})
+
+	t.Run("StatVFS return error for other fs.FS", func(t *testing.T) {
+		_, err := StatVFS(roFS, ".")
+		assert.Error(t, err)
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+		assert.Equal(t, "invalid argument: fsys does not support file system statistics", err.Error())
+	})
+}
@@ -0,0 +1,376 @@
+package writefs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+)
+
+// SubWriteFS is the interface implemented by a file system
+// whose Sub method returns a writable file system.
+type SubWriteFS interface {
+	WriteFS
+	fs.SubFS
+}
+
+// Sub returns a WriteFS corresponding to the subtree rooted at fsys's dir.
+// If fsys implements fs.SubFS and its Sub method returns a WriteFS,
+// Sub returns it. Otherwise Sub returns the WriteFS built by NewSub.
+func Sub(fsys fs.FS, dir string) (WriteFS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		if fsys, ok := fsys.(WriteFS); ok {
+			return fsys, nil
+		}
+	}
+	if fsys, ok := fsys.(fs.SubFS); ok {
+		sub, err := fsys.Sub(dir)
+		if err != nil {
+			return nil, err
+		}
+		if sub, ok := sub.(WriteFS); ok {
+			return sub, nil
+		}
+	}
+	return NewSub(fsys, dir)
+}
+
+// NewSub returns a WriteFS corresponding to the subtree
+// rooted at fsys's dir, without calling the Sub method of fsys.
+// The returned file system prefixes dir to the names passed
+// to all its methods, including OpenFile, MkDir and Remove,
+// and then calls the corresponding function of this package
+// or of io/fs on fsys.
+// File systems can use NewSub to implement fs.SubFS.
+func NewSub(fsys fs.FS, dir string) (WriteFS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if sub, ok := fsys.(*subFS); ok {
+		// avoid nesting wrappers
+		return &subFS{sub.fsys, path.Join(sub.dir, dir)}, nil
+	}
+	return &subFS{fsys, dir}, nil
+}
+
+type subFS struct {
+	fsys fs.FS
+	dir  string
+}
+
+var (
+	_ fs.StatFS     = &subFS{}
+	_ fs.ReadFileFS = &subFS{}
+	_ fs.SubFS      = &subFS{}
+	_ fs.ReadDirFS  = &subFS{}
+	_ fs.GlobFS     = &subFS{}
+
+	_ WriteFS     = &subFS{}
+	_ RemoveFS    = &subFS{}
+	_ MkDirFS     = &subFS{}
+	_ StatVFSFS   = &subFS{}
+	_ HashFS      = &subFS{}
+	_ RangeHashFS = &subFS{}
+	_ ChmodFS     = &subFS{}
+	_ ChtimesFS   = &subFS{}
+	_ WatchFS     = &subFS{}
+	_ ReadLinkFS  = &subFS{}
+	_ RenameFS    = &subFS{}
+
+	_ OpenFileContextFS = &subFS{}
+	_ MkDirContextFS    = &subFS{}
+	_ RemoveContextFS   = &subFS{}
+	_ StatContextFS     = &subFS{}
+)
+
+// fullName maps name to the fully-qualified name dir/name.
+func (fsys *subFS) fullName(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(fsys.dir, name), nil
+}
+
+// shorten maps name, which should start with dir, back to the suffix after dir.
+func (fsys *subFS) shorten(name string) (rel string, ok bool) {
+	if name == fsys.dir {
+		return ".", true
+	}
+	if fsys.dir == "." {
+		return name, true
+	}
+	if len(name) >= len(fsys.dir)+2 && name[len(fsys.dir)] == '/' && name[:len(fsys.dir)] == fsys.dir {
+		return name[len(fsys.dir)+1:], true
+	}
+	return "", false
+}
+
+// fixErr shortens any reported names in PathErrors
+// and LinkErrors by stripping dir.
+func (fsys *subFS) fixErr(err error) error {
+	var e *fs.PathError
+	if errors.As(err, &e) {
+		if short, ok := fsys.shorten(e.Path); ok {
+			e.Path = short
+		}
+	}
+	var le *os.LinkError
+	if errors.As(err, &le) {
+		if short, ok := fsys.shorten(le.Old); ok {
+			le.Old = short
+		}
+		if short, ok := fsys.shorten(le.New); ok {
+			le.New = short
+		}
+	}
+	return err
+}
+
+// Open implements fs.FS
+func (fsys *subFS) Open(name string) (fs.File, error) {
+	full, err := fsys.fullName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.fsys.Open(full)
+	return f, fsys.fixErr(err)
+}
+
+// OpenFile implements WriteFS
+func (fsys *subFS) OpenFile(name string, flag int, perm fs.FileMode) (FileWriter, error) {
+	full, err := fsys.fullName(OpenFileOp(flag, perm), name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := OpenFile(fsys.fsys, full, flag, perm)
+	return f, fsys.fixErr(err)
+}
+
+// MkDir implements MkDirFS
+func (fsys *subFS) MkDir(name string, perm fs.FileMode) error {
+	full, err := fsys.fullName("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return fsys.fixErr(MkDir(fsys.fsys, full, perm))
+}
+
+// Remove implements RemoveFS
+func (fsys *subFS) Remove(name string) error {
+	full, err := fsys.fullName("remove", name)
+	if err != nil {
+		return err
+	}
+	return fsys.fixErr(Remove(fsys.fsys, full))
+}
+
+// OpenFileContext implements OpenFileContextFS
+func (fsys *subFS) OpenFileContext(ctx context.Context, name string, flag int, perm fs.FileMode) (FileWriter, error) {
+	full, err := fsys.fullName(OpenFileOp(flag, perm), name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := OpenFileContext(ctx, fsys.fsys, full, flag, perm)
+	return f, fsys.fixErr(err)
+}
+
+// MkDirContext implements MkDirContextFS
+func (fsys *subFS) MkDirContext(ctx context.Context, name string, perm fs.FileMode) error {
+	full, err := fsys.fullName("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return fsys.fixErr(MkDirContext(ctx, fsys.fsys, full, perm))
+}
+
+// RemoveContext implements RemoveContextFS
+func (fsys *subFS) RemoveContext(ctx context.Context, name string) error {
+	full, err := fsys.fullName("remove", name)
+	if err != nil {
+		return err
+	}
+	return fsys.fixErr(RemoveContext(ctx, fsys.fsys, full))
+}
+
+// StatContext implements StatContextFS
+func (fsys *subFS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	full, err := fsys.fullName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := StatContext(ctx, fsys.fsys, full)
+	return info, fsys.fixErr(err)
+}
+
+// StatVFS implements StatVFSFS
+func (fsys *subFS) StatVFS(name string) (StatFSInfo, error) {
+	full, err := fsys.fullName("statvfs", name)
+	if err != nil {
+		return StatFSInfo{}, err
+	}
+	info, err := StatVFS(fsys.fsys, full)
+	return info, fsys.fixErr(err)
+}
+
+// Hash implements HashFS
+func (fsys *subFS) Hash(name string, algo string) ([]byte, error) {
+	full, err := fsys.fullName("hash", name)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := Hash(fsys.fsys, full, algo)
+	return sum, fsys.fixErr(err)
+}
+
+// HashRanges implements RangeHashFS
+func (fsys *subFS) HashRanges(name string, algo string, size int64) ([][]byte, error) {
+	full, err := fsys.fullName("hash", name)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := HashRanges(fsys.fsys, full, algo, size)
+	return sums, fsys.fixErr(err)
+}
+
+// Chmod implements ChmodFS
+func (fsys *subFS) Chmod(name string, mode fs.FileMode) error {
+	full, err := fsys.fullName("chmod", name)
+	if err != nil {
+		return err
+	}
+	return fsys.fixErr(Chmod(fsys.fsys, full, mode))
+}
+
+// Chtimes implements ChtimesFS
+func (fsys *subFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	full, err := fsys.fullName("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return fsys.fixErr(Chtimes(fsys.fsys, full, atime, mtime))
+}
+
+// ReadLink implements ReadLinkFS
+// Targets are returned unchanged, and absolute
+// or relative targets that point outside dir
+// are not resolved.
+func (fsys *subFS) ReadLink(name string) (string, error) {
+	full, err := fsys.fullName("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := ReadLink(fsys.fsys, full)
+	return target, fsys.fixErr(err)
+}
+
+// Rename implements RenameFS
+func (fsys *subFS) Rename(oldname string, newname string) error {
+	fullOld, err := fsys.fullName("rename", oldname)
+	if err != nil {
+		return err
+	}
+	fullNew, err := fsys.fullName("rename", newname)
+	if err != nil {
+		return err
+	}
+	return fsys.fixErr(Rename(fsys.fsys, fullOld, fullNew))
+}
+
+// Watch implements WatchFS
+func (fsys *subFS) Watch(ctx context.Context, name string, recursive bool) (<-chan Event, error) {
+	full, err := fsys.fullName("watch", name)
+	if err != nil {
+		return nil, err
+	}
+	events, err := Watch(ctx, fsys.fsys, full, recursive)
+	if err != nil {
+		return nil, fsys.fixErr(err)
+	}
+
+	res := make(chan Event)
+	go func() {
+		defer close(res)
+		for ev := range events {
+			short, ok := fsys.shorten(ev.Path)
+			if !ok {
+				continue
+			}
+			ev.Path = short
+			select {
+			case res <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return res, nil
+}
+
+// Stat implements fs.StatFS
+func (fsys *subFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := fsys.fullName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(fsys.fsys, full)
+	return info, fsys.fixErr(err)
+}
+
+// ReadFile implements fs.ReadFileFS
+func (fsys *subFS) ReadFile(name string) ([]byte, error) {
+	full, err := fsys.fullName("read", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(fsys.fsys, full)
+	return data, fsys.fixErr(err)
+}
+
+// ReadDir implements fs.ReadDirFS
+func (fsys *subFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := fsys.fullName("read", name)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := fs.ReadDir(fsys.fsys, full)
+	return dir, fsys.fixErr(err)
+}
+
+// Glob implements fs.GlobFS
+func (fsys *subFS) Glob(pattern string) ([]string, error) {
+	// Check pattern is well-formed.
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if pattern == "." {
+		return []string{"."}, nil
+	}
+
+	full := path.Join(fsys.dir, pattern)
+	list, err := fs.Glob(fsys.fsys, full)
+	for i, name := range list {
+		name, ok := fsys.shorten(name)
+		if !ok {
+			return nil, errors.New("invalid result from inner fsys Glob: " + name + " not in " + fsys.dir)
+		}
+		list[i] = name
+	}
+	return list, fsys.fixErr(err)
+}
+
+// Sub implements fs.SubFS
+func (fsys *subFS) Sub(dir string) (fs.FS, error) {
+	if dir == "." {
+		return fsys, nil
+	}
+	full, err := fsys.fullName("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	return &subFS{fsys.fsys, full}, nil
+}
@@ -0,0 +1,111 @@
+package writefs_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/parro-it/vs/memfs"
+	"github.com/parro-it/vs/writefs"
+	"github.com/parro-it/vs/writefstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSub(t *testing.T) {
+	t.Run("Sub of a WriteFS pass writefstest.TestFS", func(t *testing.T) {
+		fsys := memfs.New()
+		assert.NoError(t, writefs.MkDir(fsys, "root", fs.FileMode(0755)))
+		sub, err := writefs.NewSub(fsys, "root")
+		assert.NoError(t, err)
+		t.Run("Pass writefstest.TestFS", writefstest.TestFS(sub))
+
+		_, err = fs.Stat(fsys, "root/dir1/file1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Sub rewrite paths of mutations", func(t *testing.T) {
+		fsys := memfs.New()
+		assert.NoError(t, writefs.MkDir(fsys, "root", fs.FileMode(0755)))
+		sub, err := writefs.Sub(fsys, "root")
+		assert.NoError(t, err)
+
+		assert.NoError(t, writefs.MkDir(sub, "adir", fs.FileMode(0755)))
+		_, err = writefs.WriteFile(sub, "adir/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		buf, err := fs.ReadFile(fsys, "root/adir/afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao\n", string(buf))
+
+		matches, err := fs.Glob(sub, "adir/*")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"adir/afile"}, matches)
+
+		assert.NoError(t, writefs.Remove(sub, "adir/afile"))
+		_, err = fs.Stat(fsys, "root/adir/afile")
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+
+	t.Run("Sub of Sub doesn't nest wrappers", func(t *testing.T) {
+		fsys := memfs.New()
+		assert.NoError(t, writefs.MkDir(fsys, "a", fs.FileMode(0755)))
+		assert.NoError(t, writefs.MkDir(fsys, "a/b", fs.FileMode(0755)))
+		_, err := writefs.WriteFile(fsys, "a/b/afile", []byte("ciao\n"))
+		assert.NoError(t, err)
+
+		sub, err := writefs.Sub(fsys, "a")
+		assert.NoError(t, err)
+		subsub, err := writefs.Sub(sub, "b")
+		assert.NoError(t, err)
+
+		buf, err := fs.ReadFile(subsub, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao\n", string(buf))
+	})
+
+	t.Run("Sub of read only fs is a read only WriteFS", func(t *testing.T) {
+		roFS := fstest.MapFS{
+			"adir/afile": &fstest.MapFile{Data: []byte("ciao\n")},
+		}
+		sub, err := writefs.Sub(roFS, "adir")
+		assert.NoError(t, err)
+
+		buf, err := fs.ReadFile(sub, "afile")
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao\n", string(buf))
+
+		_, err = writefs.WriteFile(sub, "afile", []byte("miao\n"))
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+
+	t.Run("Sub strips dir from errors path", func(t *testing.T) {
+		sub, err := writefs.Sub(fstest.MapFS{}, "adir")
+		assert.NoError(t, err)
+		_, err = fs.Stat(sub, "unknown")
+		var pathErr *fs.PathError
+		if assert.True(t, errors.As(err, &pathErr)) {
+			assert.Equal(t, "unknown", pathErr.Path)
+		}
+	})
+
+	t.Run("Sub rewrite paths of watched events", func(t *testing.T) {
+		fsys := memfs.New()
+		assert.NoError(t, writefs.MkDir(fsys, "root", fs.FileMode(0755)))
+		sub, err := writefs.Sub(fsys, "root")
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := writefs.Watch(ctx, sub, ".", true)
+		assert.NoError(t, err)
+		assert.NoError(t, writefs.MkDir(fsys, "root/adir", fs.FileMode(0755)))
+		assert.Equal(t, writefs.Event{Op: writefs.OpCreate, Path: "adir"}, <-events)
+	})
+
+	t.Run("Sub return error for invalid dir", func(t *testing.T) {
+		_, err := writefs.Sub(fstest.MapFS{}, "/adir")
+		assert.True(t, errors.Is(err, fs.ErrInvalid))
+	})
+}
@@ -0,0 +1,240 @@
+package writefs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Op is a set of file system operations
+// that originated an Event.
+type Op uint32
+
+// Operations reported by watchers.
+const (
+	// OpCreate is reported when a file or directory is created.
+	OpCreate Op = 1 << iota
+	// OpWrite is reported when the content of a file changes.
+	OpWrite
+	// OpRemove is reported when a file or directory is removed.
+	OpRemove
+	// OpRename is reported for the old name of a renamed file
+	// or directory. The new name is reported with OpCreate.
+	OpRename
+	// OpChmod is reported when the permissions or
+	// the times of a file or directory change.
+	OpChmod
+)
+
+var opNames = []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD"}
+
+func (op Op) String() string {
+	var names []string
+	for i, name := range opNames {
+		if op&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("Op(%d)", uint32(op))
+	}
+	return strings.Join(names, "|")
+}
+
+// Event describes a change to a file or directory.
+type Event struct {
+	Op Op
+	// Path is the name of the changed file,
+	// relative to the root of the watched fs.
+	Path string
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Path
+}
+
+// Matches reports whether the event concerns name,
+// or a direct child of name or, if recursive, any
+// entry of the tree rooted at name.
+func (e Event) Matches(name string, recursive bool) bool {
+	if e.Path == name {
+		return true
+	}
+	if recursive {
+		return name == "." || strings.HasPrefix(e.Path, name+"/")
+	}
+	return path.Dir(e.Path) == name
+}
+
+// WatchFS is the interface implemented by a file
+// system that can notify changes to its files.
+type WatchFS interface {
+	fs.FS
+	Watch(ctx context.Context, name string, recursive bool) (<-chan Event, error)
+}
+
+// DefaultPollInterval is the interval between two
+// scans of the file systems watched by Watch with PollWatch.
+const DefaultPollInterval = time.Second
+
+// Watch returns a channel that receives an Event
+// for every change to the named file or, if it's a
+// directory, to its direct entries or, when recursive is
+// true, to all the entries of the tree rooted at it.
+// The channel is closed when ctx is done.
+// If fsys implements WatchFS, Watch calls fsys.Watch.
+// Otherwise Watch calls PollWatch with DefaultPollInterval.
+func Watch(ctx context.Context, fsys fs.FS, name string, recursive bool) (<-chan Event, error) {
+	if fsys, ok := fsys.(WatchFS); ok {
+		return fsys.Watch(ctx, name, recursive)
+	}
+	return PollWatch(ctx, fsys, name, recursive, DefaultPollInterval)
+}
+
+// PollWatch watches the named file like Watch does,
+// scanning fsys every interval and reporting the
+// differences with the previous scan. Files are compared
+// by size, modification time and mode. Renames are reported
+// as the removal of the old name and the creation of the new one.
+// File systems can use PollWatch to implement WatchFS
+// when they cannot do better.
+func PollWatch(ctx context.Context, fsys fs.FS, name string, recursive bool, interval time.Duration) (<-chan Event, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "watch", Path: name, Err: fs.ErrInvalid}
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: invalid poll interval %s", fs.ErrInvalid, interval)
+	}
+
+	prev, err := scan(fsys, name, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			curr, err := scan(fsys, name, recursive)
+			if err != nil {
+				// the watched file could have been removed:
+				// report all of its entries as removed.
+				curr = snapshot{}
+			}
+			for _, ev := range prev.diff(curr) {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			prev = curr
+		}
+	}()
+	return events, nil
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// snapshot is the state of the files
+// of a watched tree, indexed by name.
+type snapshot map[string]fileState
+
+func scan(fsys fs.FS, name string, recursive bool) (snapshot, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	res := snapshot{name: stateOf(info)}
+	if !info.IsDir() {
+		return res, nil
+	}
+
+	if !recursive {
+		entries, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			res[path.Join(name, entry.Name())] = stateOf(info)
+		}
+		return res, nil
+	}
+
+	err = fs.WalkDir(fsys, name, func(entryName string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// entries removed while walking are
+			// reported by the next scan.
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			res[entryName] = stateOf(info)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func stateOf(info fs.FileInfo) fileState {
+	return fileState{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+}
+
+// diff returns the events that turn s in other,
+// sorted by path.
+func (s snapshot) diff(other snapshot) []Event {
+	var events []Event
+	for name, state := range other {
+		prev, ok := s[name]
+		if !ok {
+			events = append(events, Event{Op: OpCreate, Path: name})
+			continue
+		}
+		if prev.mode.Type() != state.mode.Type() {
+			events = append(events, Event{Op: OpRemove, Path: name}, Event{Op: OpCreate, Path: name})
+			continue
+		}
+
+		var op Op
+		if !state.mode.IsDir() && (prev.size != state.size || !prev.modTime.Equal(state.modTime)) {
+			op |= OpWrite
+		}
+		if prev.mode != state.mode {
+			op |= OpChmod
+		}
+		if op != 0 {
+			events = append(events, Event{Op: op, Path: name})
+		}
+	}
+	for name := range s {
+		if _, ok := other[name]; !ok {
+			events = append(events, Event{Op: OpRemove, Path: name})
+		}
+	}
+	// stable, to keep removals before
+	// creations of the same path
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+	return events
+}
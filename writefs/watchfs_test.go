@@ -0,0 +1,111 @@
+package writefs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// nextEvents receives events until count
+// are received or no event arrives for a second.
+func nextEvents(events <-chan Event, count int) []string {
+	var res []string
+	for len(res) < count {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return res
+			}
+			res = append(res, ev.String())
+		case <-time.After(time.Second):
+			return res
+		}
+	}
+	return res
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("Watch calls fsys.Watch for WatchFS instances", func(t *testing.T) {
+		watchfs := &testWatchFS{testWriteFS{fstest.MapFS{}, nil}, ""}
+		events, err := Watch(context.Background(), watchfs, "adir", true)
+		assert.NoError(t, err)
+		assert.Equal(t, "adir", watchfs.watched)
+		assert.Equal(t, []string{"CREATE adir"}, nextEvents(events, 2))
+	})
+
+	t.Run("Op String joins operation names", func(t *testing.T) {
+		assert.Equal(t, "WRITE|CHMOD", (OpWrite | OpChmod).String())
+		assert.Equal(t, "Op(0)", Op(0).String())
+	})
+
+	t.Run("Event Matches", func(t *testing.T) {
+		ev := Event{Op: OpCreate, Path: "adir/nested/afile"}
+		assert.True(t, ev.Matches("adir/nested/afile", false))
+		assert.True(t, ev.Matches("adir/nested", false))
+		assert.False(t, ev.Matches("adir", false))
+		assert.True(t, ev.Matches("adir", true))
+		assert.True(t, ev.Matches(".", true))
+		assert.False(t, ev.Matches("adi", true))
+		assert.True(t, Event{Op: OpCreate, Path: "afile"}.Matches(".", false))
+	})
+
+	t.Run("PollWatch reports the differences between scans", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "watchfs")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, "adir"), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "adir/afile"), []byte("ciao\n"), 0644))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := PollWatch(ctx, os.DirFS(dir), ".", true, 10*time.Millisecond)
+		assert.NoError(t, err)
+
+		// a single write, to avoid that a scan
+		// happens between truncation and write.
+		f, err := os.OpenFile(filepath.Join(dir, "adir/afile"), os.O_WRONLY|os.O_APPEND, 0)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte("ciao\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		assert.Equal(t, []string{"WRITE adir/afile"}, nextEvents(events, 1))
+
+		assert.NoError(t, os.Rename(filepath.Join(dir, "adir/afile"), filepath.Join(dir, "bfile")))
+		assert.Equal(t, []string{"REMOVE adir/afile", "CREATE bfile"}, nextEvents(events, 2))
+
+		assert.NoError(t, os.Chmod(filepath.Join(dir, "bfile"), 0600))
+		assert.Equal(t, []string{"CHMOD bfile"}, nextEvents(events, 1))
+
+		cancel()
+		_, ok := <-events
+		assert.False(t, ok)
+	})
+
+	t.Run("PollWatch watches only direct entries when not recursive", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "watchfs")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, "adir"), 0755))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := PollWatch(ctx, os.DirFS(dir), ".", false, 10*time.Millisecond)
+		assert.NoError(t, err)
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "adir/nested"), []byte("ciao\n"), 0644))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "afile"), []byte("ciao\n"), 0644))
+		assert.Equal(t, []string{"CREATE afile"}, nextEvents(events, 2))
+	})
+
+	t.Run("PollWatch return error for missing files", func(t *testing.T) {
+		_, err := PollWatch(context.Background(), fstest.MapFS{}, "missing", false, time.Second)
+		assert.Error(t, err)
+		_, err = PollWatch(context.Background(), fstest.MapFS{}, ".", false, 0)
+		assert.Error(t, err)
+	})
+}
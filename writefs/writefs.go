@@ -31,7 +31,7 @@ func (f ReadOnlyWriteFile) Write(p []byte) (n int, err error) {
 // OpenFile ...
 func OpenFile(fsInst fs.FS, name string, flag int, perm fs.FileMode) (FileWriter, error) {
 	if !fs.ValidPath(name) {
-		return nil, &fs.PathError{}
+		return nil, &fs.PathError{Op: OpenFileOp(flag, perm), Path: name, Err: fs.ErrInvalid}
 	}
 
 	if fs, ok := fsInst.(WriteFS); ok {
@@ -46,7 +46,11 @@ func OpenFile(fsInst fs.FS, name string, flag int, perm fs.FileMode) (FileWriter
 		return ReadOnlyWriteFile{file}, nil
 	}
 
-	return nil, fmt.Errorf("file system does not support write: %w", fs.ErrInvalid)
+	return nil, &fs.PathError{
+		Op:   OpenFileOp(flag, perm),
+		Path: name,
+		Err:  fmt.Errorf("%w: file system does not support write", fs.ErrInvalid),
+	}
 }
 
 // WriteFile ...
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"io/fs"
 	"os"
+	"path"
 	"strings"
+	"sync"
 	"testing"
 	"testing/fstest"
 	"time"
@@ -13,9 +15,61 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// Clock is a clock whose time is advanced by TestFS.
+// File systems under test can stamp their files with it,
+// e.g. through memfs.WithClock, so that TestFS can check
+// their exact modification times.
+type Clock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// NewClock returns a Clock set to a fixed time.
+func NewClock() *Clock {
+	return &Clock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// advance moves the clock forward by
+// a minute and returns its new time.
+func (c *Clock) advance() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(time.Minute)
+	return c.now
+}
+
+// Option configures TestFS.
+type Option func(*config)
+
+type config struct {
+	clock *Clock
+}
+
+// WithClock tells TestFS that fsys stamps the modification
+// times of its files with clock. Without it, the modification
+// times are not checked, because the clock of fsys could
+// differ from the one of the test.
+func WithClock(clock *Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = clock
+	}
+}
+
 // TestFS returns a function that test given writefs.WriteFS
 // with common operation, like fstest.TestFS does for readonly FSs
-func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
+func TestFS(fsys writefs.WriteFS, opts ...Option) func(t *testing.T) {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	return func(t *testing.T) {
 		dirs := []string{
 			"dir1",
@@ -71,6 +125,25 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 			assert.Nil(t, info)
 		}
 
+		// stamp advances the clock of fsys, if any,
+		// and returns the time it's set to.
+		stamp := func() time.Time {
+			if cfg.clock == nil {
+				return time.Time{}
+			}
+			return cfg.clock.advance()
+		}
+
+		checkModTime := func(t *testing.T, file string, expected time.Time) {
+			if cfg.clock == nil {
+				t.Skip("the clock of fsys is not known")
+			}
+			info, err := fs.Stat(fsys, file)
+			if assert.NoError(t, err) {
+				assert.True(t, expected.Equal(info.ModTime()), "expected modtime %v, got %v", expected, info.ModTime())
+			}
+		}
+
 		checkDirCreated := func(t *testing.T, dir string) {
 			fileNotExists(t, dir)
 
@@ -103,12 +176,16 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 
 			// nested dir return error
 			f, err := writefs.OpenFile(fsys, "dir1/adir/nested", os.O_CREATE, fs.FileMode(0755)|fs.ModeDir)
-			assert.Error(t, err)
 			assert.Nil(t, f)
-			assert.True(t, errors.Is(err, fs.ErrNotExist))
+			checkPathError(t, err, "mkdir", "dir1/adir/nested", fs.ErrNotExist)
 
 			checkDirCreated(t, "dir1/adir")
 			checkDirCreated(t, "dir1/adir/nested")
+
+			// existing dir return error
+			f, err = writefs.OpenFile(fsys, "dir1/adir", os.O_CREATE, fs.FileMode(0755)|fs.ModeDir)
+			assert.Nil(t, f)
+			checkPathError(t, err, "mkdir", "dir1/adir", fs.ErrExist)
 		})
 
 		t.Run("OpenFile return *PathError on bad paths", func(t *testing.T) {
@@ -130,15 +207,18 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 			assert.Nil(t, f)
 
 			fileNotExists(t, file)
+
+			// missing file return error
+			f, err = writefs.OpenFile(fsys, file, os.O_TRUNC, 0)
+			assert.Nil(t, f)
+			checkPathError(t, err, "remove", file, fs.ErrNotExist)
 		})
 
 		t.Run("remove directories with OpenFile - nested and not recursively", func(t *testing.T) {
 			// non empty dir return error
 			f, err := writefs.OpenFile(fsys, "dir1/adir", os.O_TRUNC, 0)
-			assert.Error(t, err)
 			assert.Nil(t, f)
-			assert.True(t, errors.Is(err, fs.ErrInvalid))
-			//assert.True(t, errors.Is(err, &fs.PathError{}))
+			checkPathError(t, err, "remove", "dir1/adir", writefs.ErrNotEmpty)
 
 			checkDirRemoved(t, "dir1/adir/nested")
 			checkDirRemoved(t, "dir1/adir")
@@ -149,6 +229,7 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 			assert.True(t, err == nil || errors.Is(err, fs.ErrNotExist))
 			fileNotExists(t, file)
 
+			modTime := stamp()
 			f, err := writefs.OpenFile(fsys, file, os.O_CREATE|os.O_WRONLY, fs.FileMode(0644))
 			if assert.NoError(t, err) {
 				assert.NotNil(t, f)
@@ -160,11 +241,8 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 				assert.NoError(t, err)
 			}
 
-			t.Run("set modtime to now", func(t *testing.T) {
-				info, err := fs.Stat(fsys, file)
-				if assert.NoError(t, err) {
-					assert.Less(t, time.Now().Sub(info.ModTime()), time.Second)
-				}
+			t.Run("set modtime", func(t *testing.T) {
+				checkModTime(t, file, modTime)
 			})
 			t.Run("set content", func(t *testing.T) {
 				buf := []byte("ciao\n")
@@ -183,6 +261,7 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 
 			fileExists(t, file)
 
+			modTime := stamp()
 			f, err := writefs.OpenFile(fsys, file, os.O_WRONLY, fs.FileMode(0644))
 			if assert.NoError(t, err) {
 				assert.NotNil(t, f)
@@ -195,10 +274,7 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 			}
 
 			t.Run("updates modtime", func(t *testing.T) {
-				info, err := fs.Stat(fsys, file)
-				if assert.NoError(t, err) {
-					assert.Less(t, time.Now().Sub(info.ModTime()), time.Second)
-				}
+				checkModTime(t, file, modTime)
 			})
 			t.Run("update content", func(t *testing.T) {
 				actual, err := fs.ReadFile(fsys, file)
@@ -215,6 +291,7 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 
 			fileExists(t, file)
 
+			modTime := stamp()
 			f, err := writefs.OpenFile(fsys, file, os.O_WRONLY|os.O_TRUNC, fs.FileMode(0644))
 			if assert.NoError(t, err) {
 				assert.NotNil(t, f)
@@ -227,10 +304,7 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 			}
 
 			t.Run("updates modtime", func(t *testing.T) {
-				info, err := fs.Stat(fsys, file)
-				if assert.NoError(t, err) {
-					assert.Less(t, time.Now().Sub(info.ModTime()), time.Second)
-				}
+				checkModTime(t, file, modTime)
 			})
 			t.Run("set content", func(t *testing.T) {
 				actual, err := fs.ReadFile(fsys, file)
@@ -248,6 +322,7 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 
 			fileExists(t, file)
 
+			modTime := stamp()
 			f, err := writefs.OpenFile(fsys, file, os.O_WRONLY|os.O_APPEND, fs.FileMode(0644))
 			if assert.NoError(t, err) {
 				assert.NotNil(t, f)
@@ -260,10 +335,7 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 			}
 
 			t.Run("updates modtime", func(t *testing.T) {
-				info, err := fs.Stat(fsys, file)
-				if assert.NoError(t, err) {
-					assert.Less(t, time.Now().Sub(info.ModTime()), time.Second)
-				}
+				checkModTime(t, file, modTime)
 			})
 			t.Run("updates content", func(t *testing.T) {
 				actual, err := fs.ReadFile(fsys, file)
@@ -272,10 +344,79 @@ func TestFS(fsys writefs.WriteFS) func(t *testing.T) {
 			})
 		})
 
+		t.Run("create files with the requested permissions", func(t *testing.T) {
+			file := "dir1/secretfile"
+			err := writefs.Remove(fsys, file)
+			assert.True(t, err == nil || errors.Is(err, fs.ErrNotExist))
+
+			f, err := writefs.OpenFile(fsys, file, os.O_CREATE|os.O_WRONLY, fs.FileMode(0600))
+			if assert.NoError(t, err) {
+				_, err = f.Write([]byte("secret\n"))
+				assert.NoError(t, err)
+				assert.NoError(t, f.Close())
+			}
+
+			info, err := fs.Stat(fsys, file)
+			if assert.NoError(t, err) {
+				assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+			}
+
+			t.Run("don't change permissions of existing files", func(t *testing.T) {
+				f, err := writefs.OpenFile(fsys, file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fs.FileMode(0644))
+				if assert.NoError(t, err) {
+					assert.NoError(t, f.Close())
+				}
+				info, err := fs.Stat(fsys, file)
+				if assert.NoError(t, err) {
+					assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+				}
+			})
+
+			assert.NoError(t, writefs.Remove(fsys, file))
+		})
+
+		t.Run("create directories with the requested permissions", func(t *testing.T) {
+			dir := "dir1/secretdir"
+			err := writefs.Remove(fsys, dir)
+			assert.True(t, err == nil || errors.Is(err, fs.ErrNotExist))
+
+			err = writefs.MkDir(fsys, dir, fs.FileMode(0700))
+			assert.NoError(t, err)
+
+			info, err := fs.Stat(fsys, dir)
+			if assert.NoError(t, err) {
+				assert.True(t, info.IsDir())
+				assert.Equal(t, fs.FileMode(0700), info.Mode().Perm())
+			}
+
+			assert.NoError(t, writefs.Remove(fsys, dir))
+		})
+
 		t.Run("opening non existing files", func(t *testing.T) {
 			f, err := writefs.OpenFile(fsys, "unkfile", os.O_WRONLY, fs.FileMode(0644))
-			assert.Error(t, err)
-			assert.True(t, errors.Is(err, fs.ErrNotExist))
+			checkPathError(t, err, "open", "unkfile", fs.ErrNotExist)
+			assert.Nil(t, f)
+		})
+
+		t.Run("opening existing files exclusively", func(t *testing.T) {
+			f, err := writefs.OpenFile(fsys, "dir1/file1", os.O_WRONLY|os.O_CREATE|os.O_EXCL, fs.FileMode(0644))
+			checkPathError(t, err, "open", "dir1/file1", fs.ErrExist)
+			assert.Nil(t, f)
+		})
+
+		t.Run("opening directories for write", func(t *testing.T) {
+			f, err := writefs.OpenFile(fsys, "dir1", os.O_WRONLY, fs.FileMode(0644))
+			checkPathError(t, err, "open", "dir1", writefs.ErrIsDir)
+			assert.Nil(t, f)
+		})
+
+		t.Run("creating files in files", func(t *testing.T) {
+			f, err := writefs.OpenFile(fsys, "dir1/file1/afile", os.O_WRONLY|os.O_CREATE, fs.FileMode(0644))
+			checkPathError(t, err, "open", "dir1/file1/afile", writefs.ErrNotDir)
+			assert.Nil(t, f)
+
+			f, err = writefs.OpenFile(fsys, "dir1/file1/adir", os.O_CREATE, fs.FileMode(0755)|fs.ModeDir)
+			checkPathError(t, err, "mkdir", "dir1/file1/adir", writefs.ErrNotDir)
 			assert.Nil(t, f)
 		})
 		/*
@@ -315,6 +456,43 @@ func checkBadPath(t *testing.T, file string, desc string, open func(string) erro
 	}
 
 	for _, b := range bad {
-		assert.Error(t, open(b))
+		checkPathError(t, open(b), "", b, fs.ErrInvalid)
+	}
+}
+
+// checkPathError checks that err is a *fs.PathError for
+// the named file that wraps target. When op is not empty,
+// it also checks the operation reported by the error.
+func checkPathError(t *testing.T, err error, op string, name string, target error) {
+	var pathErr *fs.PathError
+	if !assert.True(t, errors.As(err, &pathErr), "expected *fs.PathError, got %#v", err) {
+		return
+	}
+	if op != "" {
+		assert.Equal(t, op, pathErr.Op)
+	}
+	assert.Equal(t, name, pathErr.Path)
+	assert.True(t, errors.Is(err, target), "expected %v, got %v", target, err)
+}
+
+// TestSub returns a function that tests that the
+// file system returned by fs.Sub for dir is writable,
+// and that writes through it are visible in fsys.
+// dir is created if it doesn't exist.
+func TestSub(fsys fs.FS, dir string) func(t *testing.T) {
+	return func(t *testing.T) {
+		err := writefs.MkDir(fsys, dir, fs.FileMode(0755))
+		assert.True(t, err == nil || errors.Is(err, fs.ErrExist))
+
+		sub, err := fs.Sub(fsys, dir)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = writefs.WriteFile(sub, "subfile", []byte("ciao\n"))
+		assert.NoError(t, err)
+		buf, err := fs.ReadFile(fsys, path.Join(dir, "subfile"))
+		assert.NoError(t, err)
+		assert.Equal(t, "ciao\n", string(buf))
+		assert.NoError(t, writefs.Remove(sub, "subfile"))
 	}
 }